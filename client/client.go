@@ -0,0 +1,403 @@
+// Package client implements the device side of JT/T 808: a terminal dialing a platform, running the registration
+// and authentication, sending heartbeats and location reports and answering the commands of the platform.
+// It's meant for simulators, load tests and protocol converters.
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ryan961/jtt"
+	"github.com/ryan961/jtt/segment"
+)
+
+// DefaultHeartbeatInterval is the default interval of the heartbeats (0x0002) sent to the platform.
+const DefaultHeartbeatInterval = 30 * time.Second
+
+// State is the connection state of a client.
+type State int
+
+const (
+	// StateDisconnected means the client isn't connected, e.g. waiting to reconnect.
+	StateDisconnected State = iota
+	// StateConnecting means the client is dialing the platform, registering or authenticating.
+	StateConnecting
+	// StateOnline means the client is authenticated, messages can be sent.
+	StateOnline
+)
+
+func (s State) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateOnline:
+		return "online"
+	}
+	return "unknown"
+}
+
+// Client is a terminal connected to a platform. It's safe for concurrent use.
+//
+// Run keeps the terminal connected: it dials the platform, registers (0x0100) if the terminal has no auth code,
+// authenticates (0x0102), sends heartbeats (0x0002) and reconnects after the connection is lost. Locations
+// reported while offline are buffered and uploaded in batches (0x0704) once the terminal is back online.
+// Platform commands are dispatched to the handlers registered with Handle and answered with a general reply.
+type Client struct {
+	phone           string
+	version         jtt.VersionType
+	registration    *jtt.T808_0x0100
+	imei            string
+	softwareVersion string
+	codec           *jtt.Codec
+	serials         jtt.SerialGenerator
+	retry           RetryPolicy
+	writeTimeout    time.Duration
+	reconnectMin    time.Duration
+	reconnectMax    time.Duration
+	bufferSize      int
+	batchSize       int
+	onAuthCode      func(code string)
+	onState         func(state State, err error)
+	onError         func(err error)
+
+	segmentsMu  sync.Mutex
+	segments    *segment.Pool
+	ownSegments bool
+
+	handlersMu sync.RWMutex
+	handlers   map[jtt.MsgID]Handler
+
+	mu               sync.RWMutex
+	state            State
+	conn             *conn
+	authCode         string
+	heartbeat        time.Duration
+	heartbeatChanged chan struct{}
+
+	locationsMu sync.Mutex
+	locations   []jtt.T808_0x0200
+	dropped     int
+
+	running atomic.Bool
+}
+
+// New creates the client of the terminal with the phone number.
+func New(phoneNumber string, opts ...Option) *Client {
+	c := &Client{
+		phone:            phoneNumber,
+		retry:            DefaultRetryPolicy,
+		writeTimeout:     10 * time.Second,
+		reconnectMin:     time.Second,
+		reconnectMax:     time.Minute,
+		bufferSize:       1000,
+		batchSize:        20,
+		heartbeat:        DefaultHeartbeatInterval,
+		handlers:         make(map[jtt.MsgID]Handler),
+		heartbeatChanged: make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.codec == nil {
+		c.codec = jtt.NewCodec()
+	}
+	if c.serials == nil {
+		c.serials = jtt.NewMemorySerialGenerator()
+	}
+	return c
+}
+
+// PhoneNumber returns the phone number of the terminal.
+func (c *Client) PhoneNumber() string { return c.phone }
+
+// Version returns the protocol version of the terminal.
+func (c *Client) Version() jtt.VersionType { return c.version }
+
+// State returns the connection state of the client.
+func (c *Client) State() State {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.state
+}
+
+// AuthCode returns the auth code of the terminal, empty until the terminal registered.
+func (c *Client) AuthCode() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.authCode
+}
+
+// HeartbeatInterval returns the interval of the heartbeats sent to the platform.
+func (c *Client) HeartbeatInterval() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.heartbeat
+}
+
+// SetHeartbeatInterval sets the interval of the heartbeats sent to the platform, 0 disables heartbeats.
+// It's also set by the ParamHeartbeatInterval of the parameters received in 0x8103.
+func (c *Client) SetHeartbeatInterval(interval time.Duration) {
+	c.mu.Lock()
+	c.heartbeat = interval
+	c.mu.Unlock()
+	select {
+	case c.heartbeatChanged <- struct{}{}:
+	default:
+	}
+}
+
+// Run keeps the client connected to the platform at the address until ctx is done, reconnecting with an
+// exponential backoff after the connection is lost. It returns ctx.Err() when ctx is done, or the error that
+// prevents the terminal from going online: ErrRegistrationRequired, a *RegisterError or ErrAuthFailed.
+func (c *Client) Run(ctx context.Context, network, addr string) error {
+	if !c.running.CompareAndSwap(false, true) {
+		return ErrRunning
+	}
+	defer c.running.Store(false)
+	defer c.releaseSegments()
+
+	var backoff time.Duration
+	for {
+		online, err := c.connect(ctx, network, addr)
+		if ctx.Err() != nil {
+			c.setState(StateDisconnected, nil)
+			return ctx.Err()
+		}
+		c.setState(StateDisconnected, err)
+		var registerErr *RegisterError
+		if errors.Is(err, ErrRegistrationRequired) || errors.Is(err, ErrAuthFailed) || errors.As(err, &registerErr) {
+			return err
+		}
+
+		if online {
+			backoff = 0
+		}
+		backoff = min(max(2*backoff, c.reconnectMin), c.reconnectMax)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// connect runs a single connection to the platform, online reports whether the terminal was authenticated.
+func (c *Client) connect(ctx context.Context, network, addr string) (online bool, err error) {
+	c.setState(StateConnecting, nil)
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return false, err
+	}
+
+	cn := newConn(c, nc)
+	stop := context.AfterFunc(ctx, func() { cn.close(ctx.Err()) })
+	defer stop()
+	cn.start(ctx)
+	c.mu.Lock()
+	c.conn = cn
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		cn.close(err)
+		cn.wait()
+	}()
+
+	if err := c.login(ctx, cn); err != nil {
+		return false, err
+	}
+	c.setState(StateOnline, nil)
+	return true, c.keepAlive(ctx, cn)
+}
+
+// login registers the terminal if it has no auth code and authenticates it.
+func (c *Client) login(ctx context.Context, cn *conn) error {
+	authCode := c.AuthCode()
+	registered := false
+	if authCode == "" {
+		var err error
+		if authCode, err = c.register(ctx, cn); err != nil {
+			return err
+		}
+		registered = true
+	}
+
+	err := c.authenticate(ctx, cn, authCode)
+	var replyErr *ReplyError
+	if errors.As(err, &replyErr) && !registered {
+		// the stored auth code is stale, register again
+		c.setAuthCode("")
+		if authCode, err = c.register(ctx, cn); err != nil {
+			return err
+		}
+		err = c.authenticate(ctx, cn, authCode)
+	}
+	if errors.As(err, &replyErr) {
+		return errors.Join(ErrAuthFailed, err)
+	}
+	return err
+}
+
+func (c *Client) register(ctx context.Context, cn *conn) (string, error) {
+	if c.registration == nil {
+		return "", ErrRegistrationRequired
+	}
+	registration := *c.registration
+	reply, err := cn.request(ctx, &jtt.Message{Header: &jtt.MsgHeader{}, Body: &registration})
+	if err != nil {
+		return "", err
+	}
+	body, ok := reply.Body.(*jtt.T808_0x8100)
+	if !ok {
+		return "", &ReplyError{MsgID: jtt.MsgT808_0x0100, Result: jtt.ReplyResultFailure}
+	}
+	if body.Result != jtt.RegisterResultSuccess {
+		return "", &RegisterError{Result: body.Result}
+	}
+	c.setAuthCode(body.AuthCode)
+	return body.AuthCode, nil
+}
+
+func (c *Client) authenticate(ctx context.Context, cn *conn, authCode string) error {
+	_, err := cn.request(ctx, &jtt.Message{Header: &jtt.MsgHeader{}, Body: &jtt.T808_0x0102{
+		AuthCode:        authCode,
+		IMEI:            c.imei,
+		SoftwareVersion: c.softwareVersion,
+	}})
+	return err
+}
+
+// keepAlive sends heartbeats and uploads the buffered locations until the connection is closed.
+func (c *Client) keepAlive(ctx context.Context, cn *conn) error {
+	c.flushLocations(ctx, cn)
+
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	reset := func() {
+		if ticker != nil {
+			ticker.Stop()
+			ticker, tick = nil, nil
+		}
+		if interval := c.HeartbeatInterval(); interval > 0 {
+			ticker = time.NewTicker(interval)
+			tick = ticker.C
+		}
+	}
+	reset()
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-cn.done:
+			return cn.err()
+		case <-c.heartbeatChanged:
+			reset()
+		case <-tick:
+			if err := cn.send(&jtt.Message{Header: &jtt.MsgHeader{}, Body: &jtt.T808_0x0002{}}); err != nil {
+				return err
+			}
+			c.flushLocations(ctx, cn)
+		}
+	}
+}
+
+// online returns the connection of the authenticated client.
+func (c *Client) online() (*conn, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.state != StateOnline || c.conn == nil {
+		return nil, ErrOffline
+	}
+	return c.conn, nil
+}
+
+// Send sends a message body to the platform without waiting for its reply.
+func (c *Client) Send(msg jtt.Msg) error {
+	return c.Write(&jtt.Message{Header: &jtt.MsgHeader{}, Body: msg})
+}
+
+// Write sends a message to the platform without waiting for its reply. Missing header fields are filled from
+// the client: the phone number, the protocol version (also set on jtt.VersionedMsg bodies) and, if the serial
+// number is 0, the next serial number of the terminal. Bodies longer than a single packet are segmented.
+func (c *Client) Write(m *jtt.Message) error {
+	cn, err := c.online()
+	if err != nil {
+		return err
+	}
+	return cn.send(m)
+}
+
+// Request sends a message body to the platform and waits for its reply: the platform general reply (0x8001),
+// or the dedicated response of the message (0x8800 for 0x0801). A general reply other than success ends the
+// request with a *ReplyError. The message is retransmitted following the client's RetryPolicy, Request returns
+// ErrNoReply once it's exhausted.
+//
+// The packets of a segmented message requested again by the platform (0x8003, 0x8800) are retransmitted
+// while the request is waiting for its reply.
+func (c *Client) Request(ctx context.Context, msg jtt.Msg) (*jtt.Message, error) {
+	cn, err := c.online()
+	if err != nil {
+		return nil, err
+	}
+	return cn.request(ctx, &jtt.Message{Header: &jtt.MsgHeader{}, Body: msg})
+}
+
+// segmentPool returns the pool reassembling the segmented commands, created on first use.
+func (c *Client) segmentPool() *segment.Pool {
+	c.segmentsMu.Lock()
+	defer c.segmentsMu.Unlock()
+	if c.segments == nil {
+		c.segments = segment.NewPool(segment.WithInitialCapacity(16))
+		c.ownSegments = true
+	}
+	return c.segments
+}
+
+// releaseSegments closes the pool created by the client.
+func (c *Client) releaseSegments() {
+	c.segmentsMu.Lock()
+	defer c.segmentsMu.Unlock()
+	if c.ownSegments {
+		_ = c.segments.Close()
+		c.segments, c.ownSegments = nil, false
+	}
+}
+
+func (c *Client) setAuthCode(code string) {
+	c.mu.Lock()
+	c.authCode = code
+	c.mu.Unlock()
+	if code != "" && c.onAuthCode != nil {
+		c.onAuthCode(code)
+	}
+}
+
+func (c *Client) setState(state State, err error) {
+	c.mu.Lock()
+	changed := c.state != state
+	c.state = state
+	c.mu.Unlock()
+	if changed && c.onState != nil {
+		c.onState(state, err)
+	}
+}
+
+func (c *Client) reportError(err error) {
+	if c.onError != nil && err != nil {
+		c.onError(err)
+	}
+}
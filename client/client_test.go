@@ -0,0 +1,371 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryan961/jtt"
+	"github.com/ryan961/jtt/server"
+)
+
+const testPhone = "13812345678"
+
+var testRegistration = &jtt.T808_0x0100{ManufacturerID: "ABCDE", TerminalModel: "M1", TerminalID: "T1", PlateNumber: "A12345"}
+
+// platform is a server with an open terminal directory.
+type platform struct {
+	srv       *server.Server
+	router    *server.Router
+	directory *server.MemoryDirectory
+	addr      string
+}
+
+func startPlatform(t *testing.T, opts ...server.Option) *platform {
+	t.Helper()
+	p := &platform{router: server.NewRouter(), directory: server.NewMemoryDirectory(true)}
+	p.srv = server.New(server.NewAuthFlow(p.directory, p.router), append([]server.Option{server.WithAutoReply(true)}, opts...)...)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = p.srv.Serve(ln) }()
+	t.Cleanup(func() { _ = p.srv.Close() })
+	p.addr = ln.Addr().String()
+	return p
+}
+
+// runClient runs the client against the platform until the test ends.
+func runClient(t *testing.T, c *Client, p *platform) <-chan error {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- c.Run(ctx, "tcp", p.addr) }()
+	t.Cleanup(func() {
+		cancel()
+		<-errs
+	})
+	return errs
+}
+
+// waitOnline waits until the terminal is authenticated on the platform and returns its session.
+func waitOnline(t *testing.T, c *Client, p *platform) *server.Session {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if session, ok := p.srv.Session(c.PhoneNumber()); ok && session.Authenticated() && c.State() == StateOnline {
+			return session
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("client not online, state %s", c.State())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestClient_RegisterAndAuthenticate(t *testing.T) {
+	p := startPlatform(t)
+	codes := make(chan string, 1)
+	registration := &jtt.T808_0x0100{
+		ManufacturerID: "ABCDEFGHIJK",
+		TerminalModel:  "M1",
+		TerminalID:     "T1234567890123456789012345678X",
+		PlateNumber:    "A12345",
+	}
+	c := New(testPhone, WithVersion(jtt.Version2019), WithRegistration(registration),
+		WithAuthInfo("123456789012345", "1.0.0"),
+		WithAuthCodeHandler(func(code string) { codes <- code }))
+	runClient(t, c, p)
+	session := waitOnline(t, c, p)
+
+	code := <-codes
+	terminal, ok := p.directory.Terminal(testPhone)
+	if !ok || terminal.AuthCode != code || c.AuthCode() != code {
+		t.Errorf("auth code = %q, directory %+v", c.AuthCode(), terminal)
+	}
+	if terminal.IMEI != "123456789012345" || session.Version() != jtt.Version2019 {
+		t.Errorf("unexpected terminal %+v, version %d", terminal, session.Version())
+	}
+}
+
+func TestClient_StaleAuthCode(t *testing.T) {
+	p := startPlatform(t)
+	c := New(testPhone, WithAuthCode("stale"), WithRegistration(testRegistration))
+	runClient(t, c, p)
+	waitOnline(t, c, p)
+
+	if terminal, _ := p.directory.Terminal(testPhone); c.AuthCode() == "stale" || terminal.AuthCode != c.AuthCode() {
+		t.Errorf("auth code = %q, want the code of the new registration %q", c.AuthCode(), terminal.AuthCode)
+	}
+}
+
+func TestClient_RegistrationRejected(t *testing.T) {
+	p := startPlatform(t)
+	p.directory.Provision(server.Terminal{TerminalID: "T1", PlateNumber: "OTHER"})
+	c := New(testPhone, WithRegistration(testRegistration))
+
+	err := c.Run(context.Background(), "tcp", p.addr)
+	var registerErr *RegisterError
+	if !errors.As(err, &registerErr) || registerErr.Result != jtt.RegisterResultVehicleNotFound {
+		t.Errorf("Run = %v, want registration rejected", err)
+	}
+	if err := New(testPhone).Run(context.Background(), "tcp", p.addr); !errors.Is(err, ErrRegistrationRequired) {
+		t.Errorf("Run = %v, want %v", err, ErrRegistrationRequired)
+	}
+}
+
+func TestClient_Heartbeat(t *testing.T) {
+	p := startPlatform(t)
+	heartbeats := make(chan struct{}, 10)
+	p.router.HandleFunc(jtt.MsgT808_0x0002, func(ctx context.Context, req *server.Request) error {
+		heartbeats <- struct{}{}
+		return nil
+	})
+	c := New(testPhone, WithRegistration(testRegistration), WithHeartbeat(20*time.Millisecond))
+	runClient(t, c, p)
+	waitOnline(t, c, p)
+
+	for range 2 {
+		select {
+		case <-heartbeats:
+		case <-time.After(2 * time.Second):
+			t.Fatal("no heartbeat")
+		}
+	}
+}
+
+func TestClient_Commands(t *testing.T) {
+	p := startPlatform(t)
+	c := New(testPhone, WithRegistration(testRegistration), WithHeartbeat(0))
+	c.HandleFunc(jtt.MsgT808_0x8201, func(ctx context.Context, cmd *Command) error {
+		return cmd.Respond(&jtt.T808_0x0201{ReplyMsgSerialNo: cmd.Message.Header.SerialNumber, LocationInfo: &jtt.T808_0x0200{Speed: 60}})
+	})
+	runClient(t, c, p)
+	session := waitOnline(t, c, p)
+	ctx := context.Background()
+
+	// parameters are acknowledged and the heartbeat interval applied
+	params := []*jtt.Param{(&jtt.Param{}).SetHeartbeatInterval(45)}
+	if _, err := session.Request(ctx, &jtt.T808_0x8103{Params: params}); err != nil {
+		t.Fatalf("0x8103: %v", err)
+	}
+	if interval := c.HeartbeatInterval(); interval != 45*time.Second {
+		t.Errorf("HeartbeatInterval = %s, want 45s", interval)
+	}
+
+	// a command with a dedicated response
+	reply, err := session.Request(ctx, &jtt.T808_0x8201{})
+	if err != nil {
+		t.Fatalf("0x8201: %v", err)
+	}
+	if location, ok := reply.Body.(*jtt.T808_0x0201); !ok || location.LocationInfo.Speed != 60 {
+		t.Errorf("0x8201 reply = %+v, want the 0x0201 response", reply.Body)
+	}
+
+	// commands without a handler aren't supported
+	_, err = session.Request(ctx, &jtt.T808_0x8300{})
+	var replyErr *server.ReplyError
+	if !errors.As(err, &replyErr) || replyErr.Result != jtt.ReplyResultUnsupported {
+		t.Errorf("0x8300 = %v, want unsupported", err)
+	}
+}
+
+func TestClient_Request(t *testing.T) {
+	p := startPlatform(t)
+	p.router.HandleFunc(jtt.MsgT808_0x0200, func(ctx context.Context, req *server.Request) error { return nil })
+	c := New(testPhone, WithRegistration(testRegistration), WithHeartbeat(0))
+	if _, err := c.Request(context.Background(), &jtt.T808_0x0200{}); !errors.Is(err, ErrOffline) {
+		t.Errorf("Request offline = %v, want %v", err, ErrOffline)
+	}
+	runClient(t, c, p)
+	waitOnline(t, c, p)
+
+	reply, err := c.Request(context.Background(), &jtt.T808_0x0200{})
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if body, ok := reply.Body.(*jtt.T808_0x8001); !ok || body.ReplyMsgID != jtt.MsgT808_0x0200 {
+		t.Errorf("Request = %+v, want the general reply", reply.Body)
+	}
+
+	// messages without a handler are rejected by the platform
+	_, err = c.Request(context.Background(), &jtt.T808_0x0301{})
+	var replyErr *ReplyError
+	if !errors.As(err, &replyErr) || replyErr.Result != jtt.ReplyResultUnsupported {
+		t.Errorf("Request = %v, want unsupported", err)
+	}
+}
+
+func TestClient_BufferedLocations(t *testing.T) {
+	p := startPlatform(t)
+	batches := make(chan *jtt.T808_0x0704, 4)
+	p.router.HandleFunc(jtt.MsgT808_0x0704, func(ctx context.Context, req *server.Request) error {
+		batches <- req.Message.Body.(*jtt.T808_0x0704)
+		return nil
+	})
+	c := New(testPhone, WithRegistration(testRegistration), WithHeartbeat(0), WithLocationBuffer(4), WithBatchSize(2))
+	for speed := range uint16(5) {
+		if err := c.ReportLocation(&jtt.T808_0x0200{Speed: speed}); err != nil {
+			t.Fatalf("ReportLocation: %v", err)
+		}
+	}
+	if c.Buffered() != 4 || c.Dropped() != 1 {
+		t.Fatalf("Buffered = %d, Dropped = %d, want 4 and 1", c.Buffered(), c.Dropped())
+	}
+
+	runClient(t, c, p)
+	var speeds []uint16
+	for len(speeds) < 4 {
+		select {
+		case batch := <-batches:
+			if batch.Type != 1 || len(batch.Locations) != 2 {
+				t.Errorf("unexpected batch %+v", batch)
+			}
+			for _, location := range batch.Locations {
+				speeds = append(speeds, location.Speed)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("buffered locations not uploaded, got %v", speeds)
+		}
+	}
+	if speeds[0] != 1 || speeds[3] != 4 {
+		t.Errorf("uploaded speeds %v, want [1 2 3 4]", speeds)
+	}
+	if n := c.Buffered(); n != 0 {
+		t.Errorf("Buffered = %d after upload", n)
+	}
+}
+
+func TestClient_Reconnect(t *testing.T) {
+	p := startPlatform(t)
+	states := make(chan State, 16)
+	c := New(testPhone, WithRegistration(testRegistration), WithHeartbeat(0),
+		WithReconnect(10*time.Millisecond, 50*time.Millisecond),
+		WithStateHandler(func(state State, err error) { states <- state }))
+	runClient(t, c, p)
+	session := waitOnline(t, c, p)
+	code := c.AuthCode()
+
+	_ = session.Close()
+	waitState := func(want State) {
+		t.Helper()
+		for {
+			select {
+			case state := <-states:
+				if state == want {
+					return
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("state %s not reached", want)
+			}
+		}
+	}
+	waitState(StateDisconnected)
+	waitState(StateOnline)
+	if c.AuthCode() != code {
+		t.Errorf("auth code changed from %q to %q on reconnection", code, c.AuthCode())
+	}
+}
+
+func TestClient_SegmentedUpload(t *testing.T) {
+	p := startPlatform(t)
+	uploads := make(chan *jtt.T808_0x0801, 1)
+	p.router.HandleFunc(jtt.MsgT808_0x0801, func(ctx context.Context, req *server.Request) error {
+		upload := req.Message.Body.(*jtt.T808_0x0801)
+		uploads <- upload
+		return req.Session.Send(&jtt.T808_0x8800{MultimediaID: upload.MultimediaID})
+	})
+	c := New(testPhone, WithRegistration(testRegistration), WithHeartbeat(0))
+	runClient(t, c, p)
+	waitOnline(t, c, p)
+
+	data := make([]byte, 3000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	reply, err := c.Request(context.Background(), &jtt.T808_0x0801{MultimediaID: 7, MultimediaData: data})
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if body, ok := reply.Body.(*jtt.T808_0x8800); !ok || body.MultimediaID != 7 {
+		t.Errorf("Request = %+v, want the 0x8800 response", reply.Body)
+	}
+	if upload := <-uploads; len(upload.MultimediaData) != len(data) {
+		t.Errorf("platform received %d bytes, want %d", len(upload.MultimediaData), len(data))
+	}
+}
+
+func TestClient_UDPDatagram(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = pc.Close() })
+
+	const count = 50
+	texts := make(chan string, count)
+	c := New(testPhone, WithAuthCode("code"), WithHeartbeat(0))
+	c.HandleFunc(jtt.MsgT808_0x8300, func(ctx context.Context, cmd *Command) error {
+		texts <- cmd.Message.Body.(*jtt.T808_0x8300).Text
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- c.Run(ctx, "udp", pc.LocalAddr().String()) }()
+	t.Cleanup(func() {
+		cancel()
+		<-errs
+	})
+
+	buf := make([]byte, 2048)
+	_ = pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, addr, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read authentication: %v", err)
+	}
+	auth, err := jtt.NewCodec().Decode(buf[:n])
+	if err != nil || auth.Header.MsgID != jtt.MsgT808_0x0102 {
+		t.Fatalf("received %v, %v, want the authentication", auth, err)
+	}
+
+	// the acknowledgment and the commands in a single datagram larger than the buffer of the frame scanner
+	var serial uint16
+	header := func() *jtt.MsgHeader {
+		serial++
+		return &jtt.MsgHeader{PhoneNumber: testPhone, SerialNumber: serial}
+	}
+	datagram, err := (&jtt.Message{Header: header(), Body: &jtt.T808_0x8001{
+		ReplyMsgSerialNo: auth.Header.SerialNumber,
+		ReplyMsgID:       jtt.MsgT808_0x0102,
+	}}).Encode()
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	for i := 0; i < count; i++ {
+		frame, err := (&jtt.Message{Header: header(), Body: &jtt.T808_0x8300{Text: strings.Repeat("x", 100)}}).Encode()
+		if err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		datagram = append(datagram, frame...)
+	}
+	if len(datagram) <= 4096 {
+		t.Fatalf("datagram of %d bytes, want more than 4096", len(datagram))
+	}
+	if _, err := pc.WriteTo(datagram, addr); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	for i := 0; i < count; i++ {
+		select {
+		case text := <-texts:
+			if len(text) != 100 {
+				t.Fatalf("command %d text of %d bytes, want 100", i, len(text))
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("received %d commands, want %d", i, count)
+		}
+	}
+}
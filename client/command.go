@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+// Command is a message received from the platform.
+type Command struct {
+	Client  *Client
+	Message *jtt.Message
+
+	conn      *conn
+	skipReply bool
+}
+
+// SkipReply disables the automatic general reply (0x0001) to the command.
+func (c *Command) SkipReply() { c.skipReply = true }
+
+// Reply sends the terminal general reply (0x0001) with the result to the command and skips the automatic reply.
+func (c *Command) Reply(result byte) error {
+	c.SkipReply()
+	return c.conn.reply(c.Message.Header, result)
+}
+
+// Respond sends the dedicated response of the command (e.g. 0x0201 to 0x8201, 0x0104 to 0x8104) and skips the
+// automatic reply. The reply serial number of the response must be set by the handler.
+func (c *Command) Respond(msg jtt.Msg) error {
+	c.SkipReply()
+	return c.conn.send(&jtt.Message{Header: &jtt.MsgHeader{}, Body: msg})
+}
+
+// Handler handles a command of the platform. Commands are handled sequentially in the order they were received,
+// a command is answered with a general reply (0x0001) with the result mapped from the error by jtt.ReplyResult,
+// unless the handler replied itself.
+type Handler interface {
+	ServeCommand(ctx context.Context, cmd *Command) error
+}
+
+// HandlerFunc adapts an ordinary function to a Handler.
+type HandlerFunc func(ctx context.Context, cmd *Command) error
+
+func (fn HandlerFunc) ServeCommand(ctx context.Context, cmd *Command) error {
+	return fn(ctx, cmd)
+}
+
+// Handle registers the handler for the command message ID, a nil handler removes the registration.
+// Commands without a handler are answered with jtt.ReplyResultUnsupported, except:
+//   - 0x8103 (set parameters), whose heartbeat interval is applied before calling the handler, if any.
+//   - 0x8204 (link check), answered with success.
+func (c *Client) Handle(msgID jtt.MsgID, handler Handler) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+	if handler == nil {
+		delete(c.handlers, msgID)
+		return
+	}
+	c.handlers[msgID] = handler
+}
+
+// HandleFunc registers the handler function for the command message ID.
+func (c *Client) HandleFunc(msgID jtt.MsgID, fn func(ctx context.Context, cmd *Command) error) {
+	c.Handle(msgID, HandlerFunc(fn))
+}
+
+func (c *Client) handler(msgID jtt.MsgID) (Handler, bool) {
+	c.handlersMu.RLock()
+	defer c.handlersMu.RUnlock()
+	handler, ok := c.handlers[msgID]
+	return handler, ok
+}
+
+// serveCommands runs the handlers of the commands received on the connection until it's closed.
+func (cn *conn) serveCommands(ctx context.Context) {
+	for {
+		select {
+		case <-cn.done:
+			return
+		case m := <-cn.commands:
+			cn.serveCommand(ctx, m)
+		}
+	}
+}
+
+func (cn *conn) serveCommand(ctx context.Context, m *jtt.Message) {
+	c := cn.client
+	cmd := &Command{Client: c, Message: m, conn: cn}
+	handler, ok := c.handler(m.Header.MsgID)
+
+	var err error
+	switch body := m.Body.(type) {
+	case *jtt.T808_0x8103:
+		c.applyParams(body.Params)
+		if ok {
+			err = handler.ServeCommand(ctx, cmd)
+		}
+	case *jtt.T808_0x8204:
+		if ok {
+			err = handler.ServeCommand(ctx, cmd)
+		}
+	default:
+		err = jtt.ErrMethodNotImplemented
+		if ok {
+			err = handler.ServeCommand(ctx, cmd)
+		}
+	}
+	if err != nil {
+		c.reportError(err)
+	}
+	if !cmd.skipReply {
+		if err := cn.reply(m.Header, jtt.ReplyResult(err)); err != nil {
+			c.reportError(err)
+		}
+	}
+}
+
+// applyParams applies the terminal parameters set by the platform to the client.
+func (c *Client) applyParams(params []*jtt.Param) {
+	for _, param := range params {
+		if param != nil && param.ID() == jtt.ParamHeartbeatInterval {
+			if v, err := param.GetHeartbeatInterval(); err == nil {
+				c.SetHeartbeatInterval(time.Duration(v) * time.Second)
+			}
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+// maxDatagramSize is the maximum size of a UDP datagram.
+const maxDatagramSize = 64 * 1024
+
+// commandQueueSize is the number of commands waiting for their handler before the connection stops reading.
+const commandQueueSize = 64
+
+// conn is a single connection of the client to the platform.
+type conn struct {
+	client *Client
+	nc     net.Conn
+
+	writeMu sync.Mutex
+
+	// sent messages waiting for a reply, oldest first
+	pendingMu sync.Mutex
+	pending   []*pending
+
+	commands  chan *jtt.Message
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+	wg        sync.WaitGroup
+}
+
+// pending is a sent message waiting for the reply of the platform.
+type pending struct {
+	m        *jtt.Message
+	frames   [][]byte
+	last     uint16    // serial number of the last packet, answered by the platform
+	response jtt.MsgID // dedicated response, 0x8001 if none
+	acked    bool      // acknowledged by 0x8001, waiting for the response
+	done     chan result
+}
+
+type result struct {
+	m   *jtt.Message
+	err error
+}
+
+// responses are the dedicated responses of terminal messages, others are answered with 0x8001.
+var responses = map[jtt.MsgID]jtt.MsgID{
+	jtt.MsgT808_0x0100: jtt.MsgT808_0x8100,
+	jtt.MsgT808_0x0801: jtt.MsgT808_0x8800,
+}
+
+func newConn(c *Client, nc net.Conn) *conn {
+	return &conn{
+		client:   c,
+		nc:       nc,
+		commands: make(chan *jtt.Message, commandQueueSize),
+		done:     make(chan struct{}),
+	}
+}
+
+// start starts the read loop and the command handlers of the connection.
+func (cn *conn) start(ctx context.Context) {
+	cn.wg.Add(2)
+	go func() {
+		defer cn.wg.Done()
+		cn.readLoop()
+	}()
+	go func() {
+		defer cn.wg.Done()
+		cn.serveCommands(ctx)
+	}()
+}
+
+// wait waits for the read loop and the command handlers to return.
+func (cn *conn) wait() { cn.wg.Wait() }
+
+// close closes the connection for the reason returned by err.
+func (cn *conn) close(reason error) {
+	cn.closeOnce.Do(func() {
+		if reason == nil {
+			reason = ErrConnClosed
+		}
+		cn.closeErr = reason
+		close(cn.done)
+		_ = cn.nc.Close()
+
+		cn.pendingMu.Lock()
+		pending := cn.pending
+		cn.pending = nil
+		cn.pendingMu.Unlock()
+		for _, p := range pending {
+			p.done <- result{err: ErrConnClosed}
+		}
+	})
+}
+
+// err returns the reason the connection was closed.
+func (cn *conn) err() error {
+	<-cn.done
+	return cn.closeErr
+}
+
+func (cn *conn) closed() bool {
+	select {
+	case <-cn.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (cn *conn) readLoop() {
+	if _, ok := cn.nc.(net.PacketConn); ok {
+		cn.close(cn.readDatagrams())
+		return
+	}
+	scanner := jtt.NewFrameScanner(cn.nc)
+	for scanner.Scan() {
+		cn.handleFrame(scanner.Frame())
+	}
+	err := scanner.Err()
+	if err == nil {
+		err = ErrConnClosed
+	}
+	cn.close(err)
+}
+
+// readDatagrams reads the connection one datagram at a time, a datagram larger than the buffer of the
+// scanner would otherwise be truncated by the read.
+func (cn *conn) readDatagrams() error {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, err := cn.nc.Read(buf)
+		if err != nil {
+			return err
+		}
+		scanner := jtt.NewFrameScanner(bytes.NewReader(buf[:n]))
+		for scanner.Scan() {
+			cn.handleFrame(scanner.Frame())
+		}
+	}
+}
+
+func (cn *conn) handleFrame(frame []byte) {
+	m, err := cn.client.codec.Decode(frame)
+	if err != nil && (m == nil || m.Header == nil) {
+		cn.client.reportError(err)
+		return
+	}
+	cn.handleMessage(m, err)
+}
+
+// handleMessage correlates the replies of the platform and queues its commands.
+func (cn *conn) handleMessage(m *jtt.Message, err error) {
+	if err != nil && !errors.Is(err, jtt.ErrMessageNotRegistered) {
+		cn.client.reportError(err)
+		_ = cn.reply(m.Header, jtt.ReplyResultInvalid)
+		return
+	}
+	if m.Header.IsSegment() {
+		assembled, err := cn.client.segmentPool().CacheMessage(m)
+		if err != nil && !errors.Is(err, jtt.ErrMessageNotRegistered) {
+			cn.client.reportError(err)
+			_ = cn.reply(m.Header, jtt.ReplyResult(err))
+			return
+		}
+		if assembled == nil {
+			_ = cn.reply(m.Header, jtt.ReplyResultSuccess)
+			return
+		}
+		m = assembled
+	}
+
+	switch body := m.Body.(type) {
+	case *jtt.T808_0x8001:
+		cn.acknowledge(m, body.ReplyMsgSerialNo, body)
+	case *jtt.T808_0x8100:
+		cn.acknowledge(m, body.ReplyMsgSerialNo, nil)
+	case *jtt.T808_0x8800:
+		cn.acknowledgeMultimedia(m, body)
+	case *jtt.T808_0x8003:
+		cn.retransmit(body.OriginalMsgSerialNo, body.PackageIDList)
+	default:
+		select {
+		case cn.commands <- m:
+		case <-cn.done:
+		}
+	}
+}
+
+// acknowledge completes the request answered by the reply to the serial number, reply is the general reply if any.
+func (cn *conn) acknowledge(m *jtt.Message, serial uint16, reply *jtt.T808_0x8001) {
+	cn.pendingMu.Lock()
+	defer cn.pendingMu.Unlock()
+	i := slices.IndexFunc(cn.pending, func(p *pending) bool { return p.last == serial })
+	if i < 0 {
+		return
+	}
+	p := cn.pending[i]
+	var err error
+	if reply != nil {
+		err = jtt.ReplyResultError(reply.ReplyMsgID, reply.Result)
+	}
+	switch {
+	case reply == nil:
+		if m.Header.MsgID != p.response {
+			return
+		}
+		cn.finish(i, result{m: m})
+	case reply.ReplyMsgID != p.m.Header.MsgID:
+	case err != nil:
+		cn.finish(i, result{m: m, err: err})
+	case p.response != jtt.MsgT808_0x8001:
+		p.acked = true
+	default:
+		cn.finish(i, result{m: m})
+	}
+}
+
+// acknowledgeMultimedia completes the multimedia upload answered by 0x8800, or retransmits the packets
+// requested again by the platform.
+func (cn *conn) acknowledgeMultimedia(m *jtt.Message, reply *jtt.T808_0x8800) {
+	cn.pendingMu.Lock()
+	i := slices.IndexFunc(cn.pending, func(p *pending) bool {
+		upload, ok := p.m.Body.(*jtt.T808_0x0801)
+		return ok && upload.MultimediaID == reply.MultimediaID
+	})
+	if i < 0 {
+		cn.pendingMu.Unlock()
+		return
+	}
+	p := cn.pending[i]
+	if len(reply.RetransmitIDs) == 0 {
+		cn.finish(i, result{m: m})
+		cn.pendingMu.Unlock()
+		return
+	}
+	p.acked = true
+	cn.pendingMu.Unlock()
+	cn.retransmit(p.m.Header.SerialNumber, reply.RetransmitIDs)
+}
+
+// retransmit sends again the packets of the pending segmented message with the first serial number.
+func (cn *conn) retransmit(first uint16, ids []uint16) {
+	cn.pendingMu.Lock()
+	i := slices.IndexFunc(cn.pending, func(p *pending) bool { return p.m.Header.SerialNumber == first })
+	var frames [][]byte
+	if i >= 0 {
+		for _, id := range ids {
+			if id >= 1 && int(id) <= len(cn.pending[i].frames) {
+				frames = append(frames, cn.pending[i].frames[id-1])
+			}
+		}
+	}
+	cn.pendingMu.Unlock()
+	if len(frames) > 0 {
+		if err := cn.writeFrames(frames); err != nil {
+			cn.client.reportError(err)
+		}
+	}
+}
+
+// finish removes the pending request at i and delivers its result, pendingMu must be held.
+func (cn *conn) finish(i int, r result) {
+	p := cn.pending[i]
+	cn.pending = slices.Delete(cn.pending, i, i+1)
+	p.done <- r
+}
+
+// request sends a message and waits for its reply, retransmitting it following the retry policy.
+func (cn *conn) request(ctx context.Context, m *jtt.Message) (*jtt.Message, error) {
+	frames, last, err := cn.encode(m)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := responses[m.Header.MsgID]
+	if !ok {
+		response = jtt.MsgT808_0x8001
+	}
+	p := &pending{m: m, frames: frames, last: last, response: response, done: make(chan result, 1)}
+
+	cn.pendingMu.Lock()
+	if cn.closed() {
+		cn.pendingMu.Unlock()
+		return nil, ErrConnClosed
+	}
+	cn.pending = append(cn.pending, p)
+	cn.pendingMu.Unlock()
+
+	policy := cn.client.retry
+	for n := 0; ; n++ {
+		if n == 0 || !cn.isAcked(p) {
+			if err := cn.writeFrames(frames); err != nil {
+				cn.remove(p)
+				return nil, err
+			}
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if policy.Timeout > 0 {
+			timer = time.NewTimer(policy.TimeoutAfter(n))
+			timeout = timer.C
+		}
+		select {
+		case r := <-p.done:
+			stopTimer(timer)
+			return r.m, r.err
+		case <-ctx.Done():
+			stopTimer(timer)
+			cn.remove(p)
+			return nil, ctx.Err()
+		case <-timeout:
+			if n >= policy.Times {
+				cn.remove(p)
+				return nil, ErrNoReply
+			}
+		}
+	}
+}
+
+func stopTimer(timer *time.Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
+
+func (cn *conn) isAcked(p *pending) bool {
+	cn.pendingMu.Lock()
+	defer cn.pendingMu.Unlock()
+	return p.acked
+}
+
+func (cn *conn) remove(p *pending) {
+	cn.pendingMu.Lock()
+	defer cn.pendingMu.Unlock()
+	if i := slices.Index(cn.pending, p); i >= 0 {
+		cn.pending = slices.Delete(cn.pending, i, i+1)
+	}
+}
+
+// send sends a message without waiting for its reply.
+func (cn *conn) send(m *jtt.Message) error {
+	frames, _, err := cn.encode(m)
+	if err != nil {
+		return err
+	}
+	return cn.writeFrames(frames)
+}
+
+// reply sends the terminal general reply (0x0001) to a platform message.
+func (cn *conn) reply(header *jtt.MsgHeader, result byte) error {
+	return cn.send(&jtt.Message{Header: &jtt.MsgHeader{}, Body: jtt.NewTerminalReply(header, result)})
+}
+
+// encode encodes m as sent by the terminal of the client, see jtt.Codec.EncodeFrames.
+func (cn *conn) encode(m *jtt.Message) (frames [][]byte, last uint16, err error) {
+	c := cn.client
+	return c.codec.EncodeFrames(m, c.phone, c.version, c.serials)
+}
+
+func (cn *conn) writeFrames(frames [][]byte) error {
+	cn.writeMu.Lock()
+	defer cn.writeMu.Unlock()
+	if cn.closed() {
+		return ErrConnClosed
+	}
+	if cn.client.writeTimeout > 0 {
+		_ = cn.nc.SetWriteDeadline(time.Now().Add(cn.client.writeTimeout))
+	}
+	// one write per frame, so each frame is a datagram on UDP connections
+	for _, frame := range frames {
+		if _, err := cn.nc.Write(frame); err != nil {
+			cn.close(err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ryan961/jtt"
+)
+
+var (
+	// ErrOffline is returned when sending a message while the client isn't connected and authenticated
+	ErrOffline = errors.New("client offline")
+	// ErrRunning is returned by Run when the client is already running
+	ErrRunning = errors.New("client already running")
+	// ErrRegistrationRequired is returned by Run when the terminal has no auth code and no registration info
+	ErrRegistrationRequired = errors.New("registration info required")
+	// ErrAuthFailed is returned by Run when the platform rejects the auth code of a new registration
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrNoReply is returned when the platform didn't answer a message after all its retransmissions
+	ErrNoReply = errors.New("no reply from platform")
+	// ErrConnClosed is returned for the messages waiting for a reply when the connection is closed
+	ErrConnClosed = errors.New("connection closed")
+)
+
+// ReplyError is the error of a message the platform answered with a general reply (0x8001) other than success.
+type ReplyError = jtt.ReplyError
+
+// RegisterError is returned by Run when the platform rejects the registration (0x8100), see jtt.RegisterResultSuccess.
+type RegisterError struct {
+	Result byte // result of the registration reply
+}
+
+func (e *RegisterError) Error() string {
+	return fmt.Sprintf("registration rejected with result %d", e.Result)
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+
+	"github.com/ryan961/jtt"
+)
+
+// ReportLocation sends a location report (0x0200) to the platform. While the client is offline, or if the report
+// can't be sent, the location is buffered and uploaded later in batches (0x0704, blind area) once the client is
+// back online. When the buffer is full, the oldest location is dropped.
+func (c *Client) ReportLocation(location *jtt.T808_0x0200) error {
+	cn, err := c.online()
+	if err == nil {
+		if err = cn.send(&jtt.Message{Header: &jtt.MsgHeader{}, Body: location}); err == nil {
+			return nil
+		}
+	}
+	if cn == nil || cn.closed() {
+		c.bufferLocations(*location)
+		return nil
+	}
+	return err
+}
+
+// Buffered returns the number of buffered locations waiting to be uploaded.
+func (c *Client) Buffered() int {
+	c.locationsMu.Lock()
+	defer c.locationsMu.Unlock()
+	return len(c.locations)
+}
+
+// Dropped returns the number of buffered locations dropped because the buffer was full.
+func (c *Client) Dropped() int {
+	c.locationsMu.Lock()
+	defer c.locationsMu.Unlock()
+	return c.dropped
+}
+
+// bufferLocations appends locations to the buffer, dropping the oldest ones over its size.
+func (c *Client) bufferLocations(locations ...jtt.T808_0x0200) {
+	c.locationsMu.Lock()
+	defer c.locationsMu.Unlock()
+	c.locations = append(c.locations, locations...)
+	if over := len(c.locations) - c.bufferSize; over > 0 {
+		c.locations = c.locations[over:]
+		c.dropped += over
+	}
+}
+
+// takeLocations removes the oldest n buffered locations.
+func (c *Client) takeLocations(n int) []jtt.T808_0x0200 {
+	c.locationsMu.Lock()
+	defer c.locationsMu.Unlock()
+	n = min(n, len(c.locations))
+	batch := append([]jtt.T808_0x0200(nil), c.locations[:n]...)
+	c.locations = c.locations[n:]
+	return batch
+}
+
+// restoreLocations puts back a batch that couldn't be uploaded before the locations buffered since.
+func (c *Client) restoreLocations(batch []jtt.T808_0x0200) {
+	c.locationsMu.Lock()
+	defer c.locationsMu.Unlock()
+	c.locations = append(batch, c.locations...)
+	if over := len(c.locations) - c.bufferSize; over > 0 {
+		c.locations = c.locations[over:]
+		c.dropped += over
+	}
+}
+
+// flushLocations uploads the buffered locations in batches until the buffer is empty or an upload fails.
+func (c *Client) flushLocations(ctx context.Context, cn *conn) {
+	for {
+		batch := c.takeLocations(c.batchSize)
+		if len(batch) == 0 {
+			return
+		}
+		_, err := cn.request(ctx, &jtt.Message{Header: &jtt.MsgHeader{}, Body: &jtt.T808_0x0704{Type: 1, Locations: batch}})
+		if err != nil {
+			c.restoreLocations(batch)
+			c.reportError(err)
+			return
+		}
+	}
+}
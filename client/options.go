@@ -0,0 +1,163 @@
+package client
+
+import (
+	"time"
+
+	"github.com/ryan961/jtt"
+	"github.com/ryan961/jtt/segment"
+)
+
+type Option func(c *Client)
+
+// WithVersion sets the protocol version of the terminal.
+//
+// By default, the version is jtt.Version2013.
+func WithVersion(version jtt.VersionType) Option {
+	return func(c *Client) {
+		c.version = version
+	}
+}
+
+// WithRegistration sets the registration (0x0100) sent when the terminal has no auth code.
+//
+// By default, there's no registration info and Run fails with ErrRegistrationRequired without an auth code.
+func WithRegistration(registration *jtt.T808_0x0100) Option {
+	return func(c *Client) {
+		c.registration = registration
+	}
+}
+
+// WithAuthCode sets the auth code of a terminal already registered, e.g. restored from storage.
+// The terminal registers again if the platform rejects it.
+//
+// By default, the terminal registers on its first connection.
+func WithAuthCode(code string) Option {
+	return func(c *Client) {
+		c.authCode = code
+	}
+}
+
+// WithAuthInfo sets the IMEI and the software version sent on authentication (0x0102) by 2019 terminals.
+//
+// By default, both are empty.
+func WithAuthInfo(imei, softwareVersion string) Option {
+	return func(c *Client) {
+		c.imei = imei
+		c.softwareVersion = softwareVersion
+	}
+}
+
+// WithAuthCodeHandler sets the function called with the auth code received on registration, e.g. to store it.
+//
+// By default, the auth code is only kept in memory, see Client.AuthCode.
+func WithAuthCodeHandler(fn func(code string)) Option {
+	return func(c *Client) {
+		c.onAuthCode = fn
+	}
+}
+
+// WithHeartbeat sets the interval of the heartbeats sent to the platform, 0 disables heartbeats.
+//
+// By default, the interval is DefaultHeartbeatInterval.
+func WithHeartbeat(interval time.Duration) Option {
+	return func(c *Client) {
+		c.heartbeat = interval
+	}
+}
+
+// WithRetryPolicy sets the retransmission schedule of the messages sent with Request.
+//
+// By default, the policy is DefaultRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithReconnect sets the minimum and maximum delay between reconnections, the delay doubles after each
+// failed connection.
+//
+// By default, the delay is between time.Second and time.Minute.
+func WithReconnect(minDelay, maxDelay time.Duration) Option {
+	return func(c *Client) {
+		c.reconnectMin = minDelay
+		c.reconnectMax = max(minDelay, maxDelay)
+	}
+}
+
+// WithWriteTimeout sets the timeout of writing a message to the platform.
+//
+// By default, the write timeout is 10 * time.Second.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.writeTimeout = timeout
+	}
+}
+
+// WithLocationBuffer sets the maximum number of locations buffered while offline.
+//
+// By default, the buffer size is 1000.
+func WithLocationBuffer(size int) Option {
+	return func(c *Client) {
+		c.bufferSize = size
+	}
+}
+
+// WithBatchSize sets the maximum number of buffered locations uploaded in a single 0x0704.
+//
+// By default, the batch size is 20.
+func WithBatchSize(size int) Option {
+	return func(c *Client) {
+		if size > 0 {
+			c.batchSize = size
+		}
+	}
+}
+
+// WithCodec sets the codec used to decode received frames and encode sent messages.
+//
+// By default, the codec is jtt.NewCodec().
+func WithCodec(codec *jtt.Codec) Option {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+// WithSerialGenerator sets the generator of serial numbers for sent messages, keyed by phone number.
+//
+// By default, the generator is jtt.NewMemorySerialGenerator().
+func WithSerialGenerator(serials jtt.SerialGenerator) Option {
+	return func(c *Client) {
+		c.serials = serials
+	}
+}
+
+// WithSegmentPool sets the pool used to reassemble segmented commands, e.g. shared by simulated terminals.
+// The pool is not closed by the client.
+//
+// By default, the client creates a segment.NewPool() on the first segmented command and closes it when Run returns.
+func WithSegmentPool(pool *segment.Pool) Option {
+	return func(c *Client) {
+		c.segments = pool
+	}
+}
+
+// WithStateHandler sets the function called when the connection state changes, err is the reason
+// the client got disconnected. The function is called synchronously and must not block.
+//
+// By default, state changes are ignored.
+func WithStateHandler(fn func(state State, err error)) Option {
+	return func(c *Client) {
+		c.onState = fn
+	}
+}
+
+// WithErrorHandler sets the function called with the errors of the client: frames that can't be decoded,
+// errors returned by handlers and location batches that couldn't be uploaded.
+//
+// By default, errors are ignored.
+func WithErrorHandler(fn func(err error)) Option {
+	return func(c *Client) {
+		c.onError = fn
+	}
+}
@@ -0,0 +1,13 @@
+package client
+
+import (
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+// RetryPolicy is the retransmission schedule of a message the platform doesn't answer, see jtt.RetryPolicy.
+type RetryPolicy = jtt.RetryPolicy
+
+// DefaultRetryPolicy is the default retransmission schedule of the client.
+var DefaultRetryPolicy = RetryPolicy{Timeout: 10 * time.Second, Times: 3}
@@ -0,0 +1,282 @@
+// Command jtt-sim simulates a fleet of JT/T 808 terminals to load test a gateway.
+//
+// Each terminal registers and authenticates with the protocol version picked from the version mix, then drives
+// along a random or GPX route, reporting its location (0x0200) with alarms and extras every interval and
+// uploading segmented images (0x0801). The latency and the ack rate of the messages are reported periodically.
+//
+// Usage:
+//
+//	jtt-sim [flags]
+//
+// Run against an embedded gateway, without any outside service:
+//
+//	jtt-sim -serve -n 1000 -duration 1m
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ryan961/jtt"
+	"github.com/ryan961/jtt/client"
+	"github.com/ryan961/jtt/segment"
+	"github.com/ryan961/jtt/server"
+)
+
+// fleet is the configuration shared by the simulated terminals.
+type fleet struct {
+	network     string
+	addr        string
+	phonePrefix string
+	interval    time.Duration
+	heartbeat   time.Duration
+	imageEvery  time.Duration
+	imageSize   int
+	alarmRate   float64
+	retry       client.RetryPolicy
+	routes      []*route
+
+	codec    *jtt.Codec
+	serials  jtt.SerialGenerator
+	segments *segment.Pool
+	stats    *stats
+}
+
+func (f *fleet) phone(id int) string {
+	return fmt.Sprintf("%s%08d", f.phonePrefix, id)
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "jtt-sim:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var (
+		f        = &fleet{}
+		n        = flag.Int("n", 100, "number of terminals")
+		versions = flag.String("versions", "2013:1", "protocol version mix as version:weight pairs, e.g. 2011:1,2013:6,2019:3")
+		duration = flag.Duration("duration", 0, "duration of the simulation, 0 runs until interrupted")
+		ramp     = flag.Duration("ramp", 10*time.Second, "time over which the terminals are started")
+		gpxFile  = flag.String("gpx", "", "GPX file with the routes to drive, random routes around -center by default")
+		center   = flag.String("center", "22.543096,114.057865", "center of the random routes as lat,lng")
+		report   = flag.Duration("report", 10*time.Second, "interval of the progress reports, 0 disables them")
+		serve    = flag.Bool("serve", false, "run an embedded gateway on -addr and simulate the terminals against it")
+		seed     = flag.Uint64("seed", 1, "seed of the simulation")
+	)
+	flag.StringVar(&f.addr, "addr", "127.0.0.1:7808", "address of the gateway")
+	flag.StringVar(&f.network, "network", "tcp", "network of the gateway, tcp or udp")
+	flag.StringVar(&f.phonePrefix, "phone-prefix", "139", "prefix of the phone numbers, followed by 8 digits")
+	flag.DurationVar(&f.interval, "interval", 10*time.Second, "interval of the location reports")
+	flag.DurationVar(&f.heartbeat, "heartbeat", client.DefaultHeartbeatInterval, "interval of the heartbeats")
+	flag.DurationVar(&f.imageEvery, "image-every", 5*time.Minute, "interval of the image uploads per terminal, 0 disables them")
+	flag.IntVar(&f.imageSize, "image-size", 32*1024, "average size of the images in bytes")
+	flag.Float64Var(&f.alarmRate, "alarm-rate", 0.01, "probability that a location report starts an alarm episode")
+	flag.DurationVar(&f.retry.Timeout, "timeout", client.DefaultRetryPolicy.Timeout, "reply timeout of the first transmission")
+	flag.IntVar(&f.retry.Times, "retries", client.DefaultRetryPolicy.Times, "number of retransmissions")
+	flag.Parse()
+
+	if *n <= 0 || *n > 9999999 {
+		return fmt.Errorf("invalid number of terminals %d", *n)
+	}
+	if f.interval <= 0 {
+		return fmt.Errorf("invalid interval %s", f.interval)
+	}
+	mix, err := parseVersions(*versions)
+	if err != nil {
+		return err
+	}
+	rng := rand.New(rand.NewPCG(*seed, *seed))
+	if *gpxFile != "" {
+		if f.routes, err = loadGPX(*gpxFile); err != nil {
+			return err
+		}
+	} else {
+		c, err := parsePoint(*center)
+		if err != nil {
+			return err
+		}
+		for range max(1, min(*n/10, 100)) {
+			f.routes = append(f.routes, randomRoute(rng, destination(c, rng.Float64()*360, rng.Float64()*20000), 20))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	if *serve {
+		addr, shutdown, err := startGateway(f.network, f.addr)
+		if err != nil {
+			return err
+		}
+		defer shutdown()
+		f.addr = addr
+		slog.Info("gateway listening", "network", f.network, "addr", addr)
+	}
+
+	f.codec = jtt.NewCodec()
+	f.serials = jtt.NewMemorySerialGenerator()
+	f.segments = segment.NewPool()
+	defer f.segments.Close()
+	f.stats = newStats()
+
+	if *report > 0 {
+		go func() {
+			ticker := time.NewTicker(*report)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					f.stats.report(os.Stderr, *n)
+				}
+			}
+		}()
+	}
+
+	slog.Info("starting terminals", "n", *n, "versions", *versions, "routes", len(f.routes))
+	var wg sync.WaitGroup
+	start := time.Now()
+start:
+	for id := range *n {
+		if *ramp > 0 {
+			timer := time.NewTimer(time.Until(start.Add(*ramp * time.Duration(id) / time.Duration(*n))))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				break start
+			case <-timer.C:
+			}
+		}
+		t := newTerminal(f, id, mix.pick(rng), rand.New(rand.NewPCG(*seed, uint64(id))))
+		wg.Go(func() { t.run(ctx) })
+	}
+	wg.Wait()
+
+	f.stats.report(os.Stdout, *n)
+	return nil
+}
+
+// versionMix picks protocol versions with their weights.
+type versionMix struct {
+	versions []jtt.VersionType
+	weights  []int
+	total    int
+}
+
+func parseVersions(s string) (*versionMix, error) {
+	mix := &versionMix{}
+	for pair := range strings.SplitSeq(s, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			weight = "1"
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight %q of version %s", weight, name)
+		}
+		var version jtt.VersionType
+		switch name {
+		case "2011":
+			version = jtt.Version2011
+		case "2013":
+			version = jtt.Version2013
+		case "2019":
+			version = jtt.Version2019
+		default:
+			return nil, fmt.Errorf("invalid version %q, want 2011, 2013 or 2019", name)
+		}
+		mix.versions = append(mix.versions, version)
+		mix.weights = append(mix.weights, w)
+		mix.total += w
+	}
+	if mix.total == 0 {
+		return nil, errors.New("invalid version mix, all weights are 0")
+	}
+	return mix, nil
+}
+
+func (m *versionMix) pick(rng *rand.Rand) jtt.VersionType {
+	n := rng.IntN(m.total)
+	for i, w := range m.weights {
+		if n < w {
+			return m.versions[i]
+		}
+		n -= w
+	}
+	return m.versions[len(m.versions)-1]
+}
+
+func parsePoint(s string) (point, error) {
+	lat, lng, ok := strings.Cut(s, ",")
+	if ok {
+		var p point
+		var err1, err2 error
+		p.Lat, err1 = strconv.ParseFloat(strings.TrimSpace(lat), 64)
+		p.Lng, err2 = strconv.ParseFloat(strings.TrimSpace(lng), 64)
+		if err1 == nil && err2 == nil && p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180 {
+			return p, nil
+		}
+	}
+	return point{}, fmt.Errorf("invalid point %q, want lat,lng", s)
+}
+
+// startGateway runs a gateway registering any terminal and acknowledging reports and images.
+func startGateway(network, addr string) (string, func(), error) {
+	router := server.NewRouter()
+	accept := func(ctx context.Context, req *server.Request) error { return nil }
+	router.HandleFunc(jtt.MsgT808_0x0002, accept)
+	router.HandleFunc(jtt.MsgT808_0x0200, accept)
+	router.HandleFunc(jtt.MsgT808_0x0704, accept)
+	router.HandleFunc(jtt.MsgT808_0x0801, func(ctx context.Context, req *server.Request) error {
+		upload := req.Message.Body.(*jtt.T808_0x0801)
+		return req.Session.Send(&jtt.T808_0x8800{MultimediaID: upload.MultimediaID})
+	})
+	// 2011 terminals are told apart from 2013 ones by their registration
+	codec := jtt.NewCodec(jtt.WithVersionRegistry(jtt.NewVersionRegistry()))
+	srv := server.New(server.NewAuthFlow(server.NewMemoryDirectory(true), router),
+		server.WithCodec(codec),
+		server.WithAutoReply(true),
+		server.WithDecodeErrorHandler(func(session *server.Session, frame []byte, err error) {
+			slog.Warn("gateway decode error", "frame", fmt.Sprintf("%X", frame), "err", err)
+		}))
+
+	switch network {
+	case "tcp":
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return "", nil, err
+		}
+		go func() { _ = srv.Serve(ln) }()
+		addr = ln.Addr().String()
+	case "udp":
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return "", nil, err
+		}
+		go func() { _ = srv.ServeUDP(conn) }()
+		addr = conn.LocalAddr().String()
+	default:
+		return "", nil, fmt.Errorf("invalid network %q, want tcp or udp", network)
+	}
+	return addr, func() { _ = srv.Close() }, nil
+}
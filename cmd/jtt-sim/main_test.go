@@ -0,0 +1,127 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+const testGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <wpt lat="22.0" lon="114.0"/>
+  <trk>
+    <trkseg>
+      <trkpt lat="22.0" lon="114.0"/>
+      <trkpt lat="22.0" lon="114.01"/>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="22.01" lon="114.01"/>
+    </trkseg>
+  </trk>
+  <rte>
+    <rtept lat="22.0" lon="114.0"/>
+    <rtept lat="22.0" lon="114.0"/>
+  </rte>
+</gpx>`
+
+func TestParseGPX(t *testing.T) {
+	routes, err := parseGPX(strings.NewReader(testGPX))
+	if err != nil {
+		t.Fatalf("parseGPX: %v", err)
+	}
+	// the route with a single distinct point is skipped, the waypoints are ignored
+	if len(routes) != 1 || len(routes[0].points) != 3 {
+		t.Fatalf("parseGPX = %d routes, want the track of 3 points", len(routes))
+	}
+	if _, err := parseGPX(strings.NewReader(`<gpx><wpt lat="1" lon="1"/></gpx>`)); err == nil {
+		t.Error("parseGPX with a single waypoint succeeded")
+	}
+}
+
+func TestRoute_At(t *testing.T) {
+	r, err := newRoute([]point{{0, 0}, {0, 0.01}, {0.01, 0.01}})
+	if err != nil {
+		t.Fatalf("newRoute: %v", err)
+	}
+	leg := distance(point{0, 0}, point{0, 0.01})
+	tests := []struct {
+		d       float64
+		want    point
+		heading float64
+	}{
+		{0, point{0, 0}, 90},
+		{leg / 2, point{0, 0.005}, 90},
+		{leg + 1, point{0.00001, 0.01}, 0},
+		// driving back from the end of the route
+		{2*r.length() - leg/2, point{0, 0.005}, 270},
+		{2*r.length() + leg/2, point{0, 0.005}, 90},
+	}
+	for _, tt := range tests {
+		p, heading := r.at(tt.d)
+		if math.Abs(p.Lat-tt.want.Lat) > 1e-5 || math.Abs(p.Lng-tt.want.Lng) > 1e-5 || math.Abs(heading-tt.heading) > 0.1 {
+			t.Errorf("at(%.0f) = %v, %.1f, want %v, %.1f", tt.d, p, heading, tt.want, tt.heading)
+		}
+	}
+}
+
+func TestRandomRoute(t *testing.T) {
+	center := point{22.5, 114}
+	r := randomRoute(rand.New(rand.NewPCG(1, 2)), center, 10)
+	if len(r.points) != 11 || r.points[0] != center {
+		t.Fatalf("randomRoute = %d points from %v", len(r.points), r.points[0])
+	}
+	if r.length() < 10*200 || r.length() > 10*2000 {
+		t.Errorf("route length %.0f m out of range", r.length())
+	}
+}
+
+func TestParseVersions(t *testing.T) {
+	mix, err := parseVersions("2011:1, 2013:0,2019")
+	if err != nil {
+		t.Fatalf("parseVersions: %v", err)
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	counts := make(map[jtt.VersionType]int)
+	for range 1000 {
+		counts[mix.pick(rng)]++
+	}
+	if counts[jtt.Version2013] != 0 || counts[jtt.Version2011] < 400 || counts[jtt.Version2019] < 400 {
+		t.Errorf("picked versions %v, want half 2011 and half 2019", counts)
+	}
+	for _, s := range []string{"2012:1", "2013:x", "2013:0"} {
+		if _, err := parseVersions(s); err == nil {
+			t.Errorf("parseVersions(%q) succeeded", s)
+		}
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	for _, version := range []jtt.VersionType{jtt.Version2011, jtt.Version2013, jtt.Version2019} {
+		r := registration(1234, version)
+		r.SetProtocolVersion(version)
+		if _, err := r.Encode(); err != nil {
+			t.Errorf("registration of version %d: %v", version, err)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	var h histogram
+	for i := 1; i <= 100; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	if h.mean() != 50500*time.Microsecond || h.max != 100*time.Millisecond {
+		t.Errorf("mean %s, max %s", h.mean(), h.max)
+	}
+	// quantiles are the upper bounds of the buckets, within 25% of the exact value
+	for _, q := range []float64{0.5, 0.95, 0.99} {
+		want := time.Duration(q*100) * time.Millisecond
+		if got := h.quantile(q); got < want || got > want*5/4 {
+			t.Errorf("quantile(%v) = %s, want about %s", q, got, want)
+		}
+	}
+}
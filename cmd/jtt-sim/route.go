@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+)
+
+const earthRadius = 6371000.0 // meters
+
+// point is a WGS-84 coordinate in degrees.
+type point struct {
+	Lat, Lng float64
+}
+
+// route is a polyline driven back and forth by the simulated vehicles.
+type route struct {
+	points []point
+	dist   []float64 // distance from the start to each point in meters
+}
+
+func newRoute(points []point) (*route, error) {
+	if len(points) < 2 {
+		return nil, fmt.Errorf("route needs at least 2 points, got %d", len(points))
+	}
+	r := &route{points: points, dist: make([]float64, len(points))}
+	for i := 1; i < len(points); i++ {
+		r.dist[i] = r.dist[i-1] + distance(points[i-1], points[i])
+	}
+	if r.length() == 0 {
+		return nil, errors.New("route has zero length")
+	}
+	return r, nil
+}
+
+// length returns the length of the route in meters.
+func (r *route) length() float64 { return r.dist[len(r.dist)-1] }
+
+// at returns the position and the heading (degrees clockwise from north) after driving d meters,
+// turning back at the ends of the route.
+func (r *route) at(d float64) (point, float64) {
+	length := r.length()
+	d = math.Mod(d, 2*length)
+	if d < 0 {
+		d += 2 * length
+	}
+	backwards := d > length
+	if backwards {
+		d = 2*length - d
+	}
+
+	i := 1
+	for i < len(r.dist)-1 && r.dist[i] < d {
+		i++
+	}
+	a, b := r.points[i-1], r.points[i]
+	f := 0.0
+	if segment := r.dist[i] - r.dist[i-1]; segment > 0 {
+		f = (d - r.dist[i-1]) / segment
+	}
+	p := point{Lat: a.Lat + (b.Lat-a.Lat)*f, Lng: a.Lng + (b.Lng-a.Lng)*f}
+	if backwards {
+		a, b = b, a
+	}
+	return p, bearing(a, b)
+}
+
+// randomRoute generates a random drive of n legs around the center.
+func randomRoute(rng *rand.Rand, center point, n int) *route {
+	points := []point{center}
+	heading := rng.Float64() * 360
+	for range n {
+		heading = math.Mod(heading+rng.NormFloat64()*30+360, 360)
+		points = append(points, destination(points[len(points)-1], heading, 200+rng.Float64()*1800))
+	}
+	r, _ := newRoute(points)
+	return r
+}
+
+// gpx is the subset of a GPX 1.1 document with the points of tracks, routes and waypoints.
+type gpx struct {
+	Waypoints []gpxPoint `xml:"wpt"`
+	Routes    []struct {
+		Points []gpxPoint `xml:"rtept"`
+	} `xml:"rte"`
+	Tracks []struct {
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+type gpxPoint struct {
+	Lat float64 `xml:"lat,attr"`
+	Lon float64 `xml:"lon,attr"`
+}
+
+// parseGPX reads the routes of a GPX document: each track and route, or the waypoints if there's none.
+func parseGPX(r io.Reader) ([]*route, error) {
+	var doc gpx
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse gpx: %w", err)
+	}
+	var lines [][]gpxPoint
+	for _, track := range doc.Tracks {
+		var line []gpxPoint
+		for _, segment := range track.Segments {
+			line = append(line, segment.Points...)
+		}
+		lines = append(lines, line)
+	}
+	for _, rte := range doc.Routes {
+		lines = append(lines, rte.Points)
+	}
+	if len(lines) == 0 {
+		lines = append(lines, doc.Waypoints)
+	}
+
+	var routes []*route
+	for _, line := range lines {
+		points := make([]point, len(line))
+		for i, p := range line {
+			points[i] = point{Lat: p.Lat, Lng: p.Lon}
+		}
+		if r, err := newRoute(points); err == nil {
+			routes = append(routes, r)
+		}
+	}
+	if len(routes) == 0 {
+		return nil, errors.New("parse gpx: no route with at least 2 distinct points")
+	}
+	return routes, nil
+}
+
+func loadGPX(name string) ([]*route, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseGPX(f)
+}
+
+func radians(deg float64) float64 { return deg * math.Pi / 180 }
+
+func degrees(rad float64) float64 { return rad * 180 / math.Pi }
+
+// distance returns the great-circle distance between a and b in meters.
+func distance(a, b point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat, dLng := lat2-lat1, radians(b.Lng-a.Lng)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// bearing returns the initial heading from a to b in degrees clockwise from north.
+func bearing(a, b point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLng := radians(b.Lng - a.Lng)
+	y := math.Sin(dLng) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLng)
+	return math.Mod(degrees(math.Atan2(y, x))+360, 360)
+}
+
+// destination returns the point d meters from p along the heading.
+func destination(p point, heading, d float64) point {
+	lat1, lng1, h := radians(p.Lat), radians(p.Lng), radians(heading)
+	ad := d / earthRadius
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(ad) + math.Cos(lat1)*math.Sin(ad)*math.Cos(h))
+	lng2 := lng1 + math.Atan2(math.Sin(h)*math.Sin(ad)*math.Cos(lat1), math.Cos(ad)-math.Sin(lat1)*math.Sin(lat2))
+	return point{Lat: degrees(lat2), Lng: degrees(lng2)}
+}
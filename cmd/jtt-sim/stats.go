@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ryan961/jtt/client"
+)
+
+// latencyBuckets are the upper bounds of the latency histogram, from 100µs to about 100s.
+var latencyBuckets = func() []time.Duration {
+	var buckets []time.Duration
+	for d := 100 * time.Microsecond; d < 100*time.Second; d = d * 5 / 4 {
+		buckets = append(buckets, d)
+	}
+	return buckets
+}()
+
+// histogram counts latencies in exponential buckets, quantiles are estimated with the bucket upper bounds.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    time.Duration
+	max    time.Duration
+}
+
+func (h *histogram) observe(d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBuckets)+1)
+	}
+	i, _ := slices.BinarySearch(latencyBuckets, d)
+	h.counts[i]++
+	h.count++
+	h.sum += d
+	h.max = max(h.max, d)
+}
+
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(q*float64(h.count) + 0.5)
+	var seen uint64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank && n > 0 {
+			if i == len(latencyBuckets) {
+				return h.max
+			}
+			return min(latencyBuckets[i], h.max)
+		}
+	}
+	return h.max
+}
+
+func (h *histogram) mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// series is the outcome of the messages of one kind.
+type series struct {
+	sent     uint64
+	acked    uint64
+	rejected uint64 // answered with a result other than success
+	timeouts uint64 // unanswered after all retransmissions
+	failed   uint64 // not sent, e.g. disconnected
+	latency  histogram
+}
+
+// stats aggregates the outcome of the messages sent by the fleet. It's safe for concurrent use.
+type stats struct {
+	mu      sync.Mutex
+	start   time.Time
+	series  map[string]*series
+	online  int
+	peak    int
+	offline int
+}
+
+func newStats() *stats {
+	return &stats{start: time.Now(), series: make(map[string]*series)}
+}
+
+// observe records the outcome of a request of the kind sent at start.
+func (s *stats) observe(kind string, start time.Time, err error) {
+	d := time.Since(start)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ser, ok := s.series[kind]
+	if !ok {
+		ser = &series{}
+		s.series[kind] = ser
+	}
+	var replyErr *client.ReplyError
+	switch {
+	case err == nil:
+		ser.sent++
+		ser.acked++
+		ser.latency.observe(d)
+	case errors.As(err, &replyErr):
+		ser.sent++
+		ser.rejected++
+		ser.latency.observe(d)
+	case errors.Is(err, client.ErrNoReply):
+		ser.sent++
+		ser.timeouts++
+	default:
+		ser.failed++
+	}
+}
+
+// state records the connection state changes of the terminals, err is the reason of a disconnection.
+func (s *stats) state(from, to client.State, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if from == client.StateOnline {
+		s.online--
+	}
+	if to == client.StateOnline {
+		s.online++
+		s.peak = max(s.peak, s.online)
+	}
+	if from == client.StateOnline && to == client.StateDisconnected && err != nil {
+		s.offline++
+	}
+}
+
+// report writes a summary table of the series.
+func (s *stats) report(w io.Writer, terminals int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(w, "elapsed %s, online %d/%d (peak %d), disconnections %d\n",
+		time.Since(s.start).Round(time.Second), s.online, terminals, s.peak, s.offline)
+	fmt.Fprintf(w, "%-8s %9s %9s %8s %8s %8s %8s %9s %9s %9s %9s %9s\n",
+		"kind", "sent", "acked", "ack%", "rejected", "timeout", "failed", "mean", "p50", "p95", "p99", "max")
+
+	kinds := make([]string, 0, len(s.series))
+	for kind := range s.series {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	for _, kind := range kinds {
+		ser := s.series[kind]
+		ackRate := 0.0
+		if ser.sent > 0 {
+			ackRate = 100 * float64(ser.acked) / float64(ser.sent)
+		}
+		h := &ser.latency
+		fmt.Fprintf(w, "%-8s %9d %9d %7.2f%% %8d %8d %8d %9s %9s %9s %9s %9s\n",
+			kind, ser.sent, ser.acked, ackRate, ser.rejected, ser.timeouts, ser.failed,
+			round(h.mean()), round(h.quantile(0.5)), round(h.quantile(0.95)), round(h.quantile(0.99)), round(h.max))
+	}
+}
+
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/ryan961/jtt"
+	"github.com/ryan961/jtt/client"
+)
+
+const (
+	speedLimit   = 100.0 // km/h, above it the overspeed alarm is raised
+	tankCapacity = 400.0 // liters
+	consumption  = 0.0003
+)
+
+// alarm is an alarm episode of a vehicle.
+type alarm int
+
+const (
+	alarmNone alarm = iota
+	alarmOverspeed
+	alarmFatigue
+	alarmEmergency
+)
+
+// terminal is a simulated vehicle driving along a route and reporting to the platform.
+type terminal struct {
+	id     int
+	client *client.Client
+	fleet  *fleet
+	rng    *rand.Rand
+
+	route    *route
+	offset   float64 // start of the drive on the route in meters
+	odometer float64 // meters
+	speed    float64 // km/h
+	target   float64 // km/h
+	altitude float64 // meters
+	fuel     float64 // liters
+	stopped  time.Duration
+	alarm    alarm
+	alarmFor time.Duration
+
+	images    time.Duration // time until the next image
+	mediaID   uint32
+	connected time.Time // start of the last connection
+	state     client.State
+}
+
+func newTerminal(f *fleet, id int, version jtt.VersionType, rng *rand.Rand) *terminal {
+	t := &terminal{
+		id:       id,
+		fleet:    f,
+		rng:      rng,
+		route:    f.routes[rng.IntN(len(f.routes))],
+		target:   30 + rng.Float64()*60,
+		altitude: 20 + rng.Float64()*200,
+		fuel:     tankCapacity * (0.3 + 0.7*rng.Float64()),
+		odometer: rng.Float64() * 1e8,
+	}
+	t.offset = rng.Float64() * 2 * t.route.length()
+	if f.imageEvery > 0 {
+		t.images = time.Duration(rng.Int64N(int64(f.imageEvery)))
+	}
+	t.client = client.New(f.phone(id),
+		client.WithVersion(version),
+		client.WithRegistration(registration(id, version)),
+		client.WithAuthInfo(fmt.Sprintf("86%013d", id), "jtt-sim"),
+		client.WithCodec(f.codec),
+		client.WithSerialGenerator(f.serials),
+		client.WithSegmentPool(f.segments),
+		client.WithRetryPolicy(f.retry),
+		client.WithHeartbeat(f.heartbeat),
+		client.WithReconnect(time.Second, 30*time.Second),
+		client.WithStateHandler(t.stateChanged),
+	)
+	return t
+}
+
+// registration returns the registration of the terminal, with the field lengths of the protocol version.
+func registration(id int, version jtt.VersionType) *jtt.T808_0x0100 {
+	r := &jtt.T808_0x0100{
+		ProvinceID:     44,
+		CityID:         300,
+		ManufacturerID: "JTSIM",
+		TerminalModel:  "SIM-808",
+		TerminalID:     fmt.Sprintf("%07d", id),
+		PlateColor:     1,
+		PlateNumber:    fmt.Sprintf("SIM%05d", id),
+	}
+	if version == jtt.Version2019 {
+		r.ManufacturerID = "JTSIMULATOR"
+		r.TerminalModel = "SIM-808-2019"
+		r.TerminalID = fmt.Sprintf("%030d", id)
+	}
+	return r
+}
+
+func (t *terminal) stateChanged(state client.State, err error) {
+	switch state {
+	case client.StateConnecting:
+		t.connected = time.Now()
+	case client.StateOnline:
+		t.fleet.stats.observe("online", t.connected, nil)
+	}
+	t.fleet.stats.state(t.state, state, err)
+	t.state = state
+}
+
+// run connects the terminal and reports its location every interval until ctx is done.
+func (t *terminal) run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	wg.Go(func() {
+		defer cancel()
+		start := time.Now()
+		if err := t.client.Run(ctx, t.fleet.network, t.fleet.addr); ctx.Err() == nil {
+			t.fleet.stats.observe("online", start, err)
+			slog.Error("terminal stopped", "phone", t.client.PhoneNumber(), "err", err)
+		}
+	})
+
+	ticker := time.NewTicker(t.fleet.interval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.step(now.Sub(last))
+			last = now
+		}
+		location := t.location()
+
+		if t.client.State() != client.StateOnline {
+			// buffered and uploaded in 0x0704 batches once online
+			_ = t.client.ReportLocation(location)
+			continue
+		}
+		wg.Go(func() { t.request(ctx, "0x0200", location) })
+
+		if t.fleet.imageEvery > 0 {
+			if t.images -= t.fleet.interval; t.images <= 0 {
+				t.images += t.fleet.imageEvery
+				t.mediaID++
+				image := &jtt.T808_0x0801{
+					MultimediaID:     t.mediaID,
+					MultimediaType:   0, // image
+					MultimediaFormat: 0, // JPEG
+					EventCode:        1, // timed action
+					ChannelID:        byte(1 + t.rng.IntN(4)),
+					Location:         *t.basicLocation(location),
+					MultimediaData:   t.jpeg(),
+				}
+				wg.Go(func() { t.request(ctx, "0x0801", image) })
+			}
+		}
+	}
+}
+
+func (t *terminal) request(ctx context.Context, kind string, msg jtt.Msg) {
+	start := time.Now()
+	_, err := t.client.Request(ctx, msg)
+	if ctx.Err() == nil {
+		t.fleet.stats.observe(kind, start, err)
+	}
+}
+
+// step moves the vehicle forward by dt: it drives toward its target speed, stops now and then
+// and runs its alarm episodes.
+func (t *terminal) step(dt time.Duration) {
+	seconds := dt.Seconds()
+
+	if t.alarm != alarmNone {
+		if t.alarmFor -= dt; t.alarmFor <= 0 {
+			if t.alarm == alarmOverspeed {
+				t.target = 60 + t.rng.Float64()*30
+			}
+			t.alarm = alarmNone
+		}
+	} else if t.rng.Float64() < t.fleet.alarmRate {
+		t.startAlarm()
+	}
+
+	switch {
+	case t.stopped > 0:
+		t.stopped -= dt
+		t.speed = 0
+	case t.alarm == alarmNone && t.rng.Float64() < 0.01:
+		// traffic lights, deliveries
+		t.stopped = time.Duration(10+t.rng.IntN(120)) * time.Second
+	default:
+		if t.rng.Float64() < 0.05 && t.alarm == alarmNone {
+			t.target = 20 + t.rng.Float64()*75
+		}
+		// accelerate or brake within a few seconds, with some jitter
+		t.speed += (t.target - t.speed) * math.Min(1, seconds/8)
+		t.speed = math.Max(0, t.speed+t.rng.NormFloat64()*2)
+	}
+
+	d := t.speed / 3.6 * seconds
+	t.odometer += d
+	t.fuel -= d * consumption
+	if t.fuel < tankCapacity*0.1 {
+		t.fuel = tankCapacity
+	}
+	t.altitude = math.Max(0, t.altitude+t.rng.NormFloat64())
+}
+
+func (t *terminal) startAlarm() {
+	switch n := t.rng.IntN(10); {
+	case n < 6:
+		t.alarm = alarmOverspeed
+		t.target = speedLimit + 10 + t.rng.Float64()*30
+		t.alarmFor = time.Duration(30+t.rng.IntN(60)) * time.Second
+	case n < 9:
+		t.alarm = alarmFatigue
+		t.alarmFor = time.Duration(60+t.rng.IntN(240)) * time.Second
+	default:
+		t.alarm = alarmEmergency
+		t.alarmFor = time.Duration(10+t.rng.IntN(20)) * time.Second
+	}
+}
+
+// location returns the location report of the vehicle with its alarms and extras.
+func (t *terminal) location() *jtt.T808_0x0200 {
+	p, heading := t.route.at(t.offset + t.odometer)
+	l := &jtt.T808_0x0200{
+		Lat:       decimal.NewFromFloat(p.Lat).Round(6),
+		Lng:       decimal.NewFromFloat(p.Lng).Round(6),
+		Altitude:  uint16(t.altitude),
+		Speed:     uint16(t.speed * 10),
+		Direction: uint16(heading) % 360,
+		Time:      time.Now().Truncate(time.Second),
+	}
+	l.Status.SetAccState(true)
+	l.Status.SetPositioning(true)
+	l.Status.SetUseGPS(true)
+	l.Status.SetUseBeiDou(true)
+	l.Status.SetVehicleRunning(t.speed > 0)
+
+	switch {
+	case t.alarm == alarmFatigue:
+		l.Alarm.SetFatigue(true)
+	case t.alarm == alarmEmergency:
+		l.Alarm.SetEmergency(true)
+	}
+	if t.speed > speedLimit {
+		l.Alarm.SetOverspeed(true)
+		var extra jtt.T808_0x0200_Extra
+		extra.SetOverspeedInfo(jtt.T808_0x0200_Extra_Overspeed{LocationType: jtt.OverspeedLocNone})
+		l.Extras = append(l.Extras, extra)
+	} else if t.speed > speedLimit-5 {
+		l.Alarm.SetOverspeedWarn(true)
+	}
+
+	var mileage, fuel, speed, signal, satellites jtt.T808_0x0200_Extra
+	mileage.SetMileage(uint32(t.odometer / 100))
+	fuel.SetFuel(uint16(t.fuel * 10))
+	speed.SetSpeed(uint16(math.Max(0, t.speed+t.rng.NormFloat64()) * 10))
+	signal.SetSignalStrength(byte(10 + t.rng.IntN(22)))
+	satellites.SetSatelliteCount(byte(6 + t.rng.IntN(15)))
+	l.Extras = append(l.Extras, mileage, fuel, speed, signal, satellites)
+	return l
+}
+
+// basicLocation returns the location without extras, as attached to multimedia uploads.
+func (t *terminal) basicLocation(l *jtt.T808_0x0200) *jtt.T808_0x0200 {
+	basic := *l
+	basic.Extras = nil
+	return &basic
+}
+
+// jpeg returns random data framed like a JPEG image, about the configured image size.
+func (t *terminal) jpeg() []byte {
+	size := max(16, int(float64(t.fleet.imageSize)*(0.8+0.4*t.rng.Float64())))
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(t.rng.Uint32())
+	}
+	copy(data, []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00})
+	data[size-2], data[size-1] = 0xFF, 0xD9
+	return data
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/ryan961/jtt"
+)
+
+const (
+	boundaryMark = 0x7E
+	escapeMark   = 0x7D
+)
+
+// hexBytes is marshaled to JSON as an uppercase hex string.
+type hexBytes []byte
+
+func (b hexBytes) MarshalText() ([]byte, error) {
+	return []byte(strings.ToUpper(hex.EncodeToString(b))), nil
+}
+
+// frame is a frame of a stream with its decoding.
+type frame struct {
+	Stream   string         `json:"stream,omitempty"`
+	Offset   int            `json:"offset"`
+	Raw      hexBytes       `json:"raw"`
+	Checksum *checksum      `json:"checksum,omitempty"`
+	Header   *jtt.MsgHeader `json:"header,omitempty"`
+	Body     jtt.Msg        `json:"body,omitempty"`
+	Extras   []extra        `json:"extras,omitempty"`
+	Message  *reassembled   `json:"reassembled,omitempty"`
+	Errors   []string       `json:"errors,omitempty"`
+	payload  []byte         // unescaped header, body and checksum
+	offsets  []int          // offset in Raw of each payload byte, followed by the offset of the end mark
+}
+
+type checksum struct {
+	Value    string `json:"value"`
+	Expected string `json:"expected"`
+	Valid    bool   `json:"valid"`
+}
+
+// reassembled is the message of the segments completed by a frame.
+type reassembled struct {
+	Packets int     `json:"packets"`
+	Length  int     `json:"length"`
+	Body    jtt.Msg `json:"body,omitempty"`
+	Extras  []extra `json:"extras,omitempty"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// decoder splits the streams into frames and decodes them.
+type decoder struct {
+	opts     jtt.DecodeOptions
+	segments map[segmentKey]map[uint16][]byte
+}
+
+// segmentKey identifies the packets of a segmented message: the serial number of its first packet.
+type segmentKey struct {
+	phone string
+	msgID jtt.MsgID
+	total uint16
+	first uint16
+}
+
+func newDecoder(strict bool) *decoder {
+	return &decoder{
+		opts:     jtt.DecodeOptions{Strict: strict, Versions: jtt.NewVersionRegistry()},
+		segments: make(map[segmentKey]map[uint16][]byte),
+	}
+}
+
+// decode splits the stream into frames between 0x7E marks and decodes them. Bytes outside of the marks are
+// returned as frames with an error.
+func (d *decoder) decode(s *stream) []*frame {
+	var frames []*frame
+	data := s.data
+	start := -1
+	for i, c := range data {
+		if c != boundaryMark {
+			continue
+		}
+		switch {
+		case start < 0 && i > 0:
+			frames = append(frames, &frame{Offset: 0, Raw: data[:i], Errors: []string{"data before the first start mark"}})
+		case start >= 0 && i > start+1:
+			frames = append(frames, d.decodeFrame(start, data[start:i+1]))
+		}
+		start = i
+	}
+	switch {
+	case start < 0 && len(data) > 0:
+		frames = append(frames, &frame{Offset: 0, Raw: data, Errors: []string{"no 0x7E mark"}})
+	case start >= 0 && start < len(data)-1:
+		frames = append(frames, &frame{Offset: start, Raw: data[start:], Errors: []string{"incomplete frame, no end mark"}})
+	}
+	if s.gaps > 0 && len(frames) > 0 {
+		frames[0].Errors = append(frames[0].Errors, fmt.Sprintf("%d TCP segments missing from the capture", s.gaps))
+	}
+	for _, f := range frames {
+		f.Stream = s.name
+	}
+	return frames
+}
+
+// decodeFrame decodes a frame, including its 0x7E marks. Frames with a wrong checksum are still decoded.
+func (d *decoder) decodeFrame(offset int, raw []byte) *frame {
+	f := &frame{Offset: offset, Raw: raw}
+	f.unescape()
+	if len(f.payload) < jtt.Message2013HeaderSize+1 {
+		f.Errors = append(f.Errors, fmt.Sprintf("too short: %d bytes unescaped, want at least %d", len(f.payload), jtt.Message2013HeaderSize+1))
+		return f
+	}
+
+	data := f.payload[:len(f.payload)-1]
+	sum, expected := f.payload[len(f.payload)-1], jtt.Checksum(data)
+	f.Checksum = &checksum{Value: fmt.Sprintf("0x%02X", sum), Expected: fmt.Sprintf("0x%02X", expected), Valid: sum == expected}
+	if !f.Checksum.Valid {
+		f.Errors = append(f.Errors, fmt.Sprintf("invalid checksum 0x%02X, expected 0x%02X", sum, expected))
+	}
+
+	// the frame is decoded again from the payload with the expected checksum
+	m, err := d.opts.Decode(jtt.Escape(append(data[:len(data):len(data)], expected)))
+	if m != nil {
+		f.Header, f.Body = m.Header, m.Body
+	}
+	if err != nil {
+		f.Errors = append(f.Errors, err.Error())
+		if m == nil {
+			return f
+		}
+	}
+	if m.Header.IsSegment() {
+		if raw, ok := m.Body.(*jtt.RawMsg); ok {
+			f.Message = d.reassemble(m.Header, raw.Data)
+		}
+		return f
+	}
+	if err == nil {
+		f.Extras = locationExtras(m.Body)
+	}
+	return f
+}
+
+// unescape sets the payload of the frame and the offsets of its bytes in the frame.
+func (f *frame) unescape() {
+	raw := f.Raw[1 : len(f.Raw)-1]
+	f.payload = make([]byte, 0, len(raw))
+	f.offsets = make([]int, 0, len(raw)+1)
+	for i := 0; i < len(raw); i++ {
+		f.offsets = append(f.offsets, i+1)
+		c := raw[i]
+		if c == escapeMark {
+			if i+1 < len(raw) && (raw[i+1] == 0x01 || raw[i+1] == 0x02) {
+				f.payload = append(f.payload, escapeMark+raw[i+1]-1)
+				i++
+				continue
+			}
+			f.Errors = append(f.Errors, fmt.Sprintf("invalid escape sequence at offset %d", f.Offset+i+1))
+		}
+		f.payload = append(f.payload, c)
+	}
+	f.offsets = append(f.offsets, len(f.Raw)-1)
+}
+
+// reassemble stores the packet of a segmented message and decodes the message once all its packets were seen.
+func (d *decoder) reassemble(header *jtt.MsgHeader, data []byte) *reassembled {
+	info := header.SegmentInfo
+	if info.Index == 0 || info.Index > info.Total {
+		return nil
+	}
+	key := segmentKey{
+		phone: header.PhoneNumber,
+		msgID: header.MsgID,
+		total: info.Total,
+		first: header.SerialNumber - (info.Index - 1),
+	}
+	packets, ok := d.segments[key]
+	if !ok {
+		packets = make(map[uint16][]byte, info.Total)
+		d.segments[key] = packets
+	}
+	packets[info.Index] = data
+	if len(packets) < int(info.Total) {
+		return nil
+	}
+	delete(d.segments, key)
+
+	var body []byte
+	for _, index := range slices.Sorted(maps.Keys(packets)) {
+		body = append(body, packets[index]...)
+	}
+	r := &reassembled{Packets: int(info.Total), Length: len(body)}
+	registry := d.opts.Registry
+	if registry == nil {
+		registry = jtt.DefaultRegistry()
+	}
+	msg, err := registry.New(header.MsgID)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	whole := header.Clone()
+	whole.SegmentInfo = nil
+	whole.Property.Segmentation = 0
+	if _, err := jtt.DecodeBody(whole, msg, body); err != nil {
+		r.Error = err.Error()
+	}
+	r.Body = msg
+	r.Extras = locationExtras(msg)
+	return r
+}
+
+// locations returns the location reports of a message body, keyed by their JSON path in the body.
+func locations(msg jtt.Msg) []located {
+	switch msg := msg.(type) {
+	case *jtt.T808_0x0200:
+		return []located{{"", msg}}
+	case *jtt.T808_0x0201:
+		if msg.LocationInfo != nil {
+			return []located{{"LocationInfo", msg.LocationInfo}}
+		}
+	case *jtt.T808_0x0500:
+		if msg.LocationInfo != nil {
+			return []located{{"LocationInfo", msg.LocationInfo}}
+		}
+	case *jtt.T808_0x0704:
+		var l []located
+		for i := range msg.Locations {
+			l = append(l, located{fmt.Sprintf("Locations[%d]", i), &msg.Locations[i]})
+		}
+		return l
+	case *jtt.T808_0x0801:
+		return []located{{"Location", &msg.Location}}
+	}
+	return nil
+}
+
+type located struct {
+	path     string
+	location *jtt.T808_0x0200
+}
+
+// extra is an extra of a location report (T808_0x0200_Extra) decoded by its typed getter.
+type extra struct {
+	Location string   `json:"location,omitempty"`
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Length   int      `json:"length"`
+	Value    any      `json:"value,omitempty"`
+	Unit     string   `json:"unit,omitempty"`
+	Raw      hexBytes `json:"raw"`
+	Error    string   `json:"error,omitempty"`
+}
+
+func locationExtras(msg jtt.Msg) []extra {
+	var extras []extra
+	for _, l := range locations(msg) {
+		for i := range l.location.Extras {
+			e := decodeExtra(&l.location.Extras[i])
+			e.Location = l.path
+			extras = append(extras, e)
+		}
+	}
+	return extras
+}
+
+// decodeExtra decodes an extra with the getter of its ID, the value is the raw data for unknown IDs.
+func decodeExtra(e *jtt.T808_0x0200_Extra) extra {
+	x := extra{ID: e.Id.String(), Length: len(e.Data), Raw: e.Data}
+	var value any
+	var err error
+	switch e.Id {
+	case jtt.T808_0x0200_Extra_ID_Mileage:
+		x.Name, x.Unit = "mileage", "1/10 km"
+		value, err = e.GetMileage()
+	case jtt.T808_0x0200_Extra_ID_Fuel:
+		x.Name, x.Unit = "fuel", "1/10 L"
+		value, err = e.GetFuel()
+	case jtt.T808_0x0200_Extra_ID_Speed:
+		x.Name, x.Unit = "speed", "1/10 km/h"
+		value, err = e.GetSpeed()
+	case jtt.T808_0x0200_Extra_ID_AlarmConfirm:
+		x.Name = "alarm_confirm_id"
+		value, err = e.GetAlarmConfirmId()
+	case jtt.T808_0x0200_Extra_ID_TirePressure:
+		x.Name, x.Unit = "tire_pressures", "Pa"
+		value, err = e.GetTirePressures()
+	case jtt.T808_0x0200_Extra_ID_Temperature:
+		x.Name, x.Unit = "temperature", "°C"
+		value, err = e.GetTemperature()
+	case jtt.T808_0x0200_Extra_ID_SpeedLimit:
+		x.Name = "overspeed"
+		value, err = e.GetOverspeedInfo()
+	case jtt.T808_0x0200_Extra_ID_Region:
+		x.Name = "region_alarm"
+		value, err = e.GetRegionAlarmInfo()
+	case jtt.T808_0x0200_Extra_ID_Route:
+		x.Name, x.Unit = "route_time_alarm", "s"
+		value, err = e.GetRouteTimeAlarmInfo()
+	case jtt.T808_0x0200_Extra_ID_ExtSignal:
+		x.Name = "ext_signal"
+		var bits jtt.T808_0x0200_Extra_ExtSignalBits
+		if bits, err = e.GetExtSignalBits(); err == nil {
+			value = signals(bits)
+		}
+	case jtt.T808_0x0200_Extra_ID_IO:
+		x.Name = "io_status"
+		var bits jtt.T808_0x0200_Extra_IOBits
+		if bits, err = e.GetIOStatus(); err == nil {
+			value = ioStatus(bits)
+		}
+	case jtt.T808_0x0200_Extra_ID_Analog:
+		x.Name = "analog"
+		var ad0, ad1 uint16
+		if ad0, ad1, err = e.GetAnalog(); err == nil {
+			value = map[string]uint16{"ad0": ad0, "ad1": ad1}
+		}
+	case jtt.T808_0x0200_Extra_ID_Signal:
+		x.Name = "signal_strength"
+		value, err = e.GetSignalStrength()
+	case jtt.T808_0x0200_Extra_ID_Satellite:
+		x.Name = "satellites"
+		value, err = e.GetSatelliteCount()
+	default:
+		x.Name = "unknown"
+		if e.Id >= 0xE1 {
+			x.Name = "custom"
+		}
+		return x
+	}
+	if err != nil {
+		x.Error = err.Error()
+		return x
+	}
+	x.Value = value
+	return x
+}
+
+type signalBit = struct {
+	name string
+	get  func(jtt.T808_0x0200_Extra_ExtSignalBits) bool
+}
+
+// extSignalBits are the extended vehicle signal bits (0x25).
+var extSignalBits = []signalBit{
+	{"low_beam", jtt.T808_0x0200_Extra_ExtSignalBits.LowBeam},
+	{"high_beam", jtt.T808_0x0200_Extra_ExtSignalBits.HighBeam},
+	{"right_turn", jtt.T808_0x0200_Extra_ExtSignalBits.RightTurn},
+	{"left_turn", jtt.T808_0x0200_Extra_ExtSignalBits.LeftTurn},
+	{"brake", jtt.T808_0x0200_Extra_ExtSignalBits.Brake},
+	{"reverse", jtt.T808_0x0200_Extra_ExtSignalBits.Reverse},
+	{"fog_light", jtt.T808_0x0200_Extra_ExtSignalBits.FogLight},
+	{"position_lamp", jtt.T808_0x0200_Extra_ExtSignalBits.PositionLamp},
+	{"horn", jtt.T808_0x0200_Extra_ExtSignalBits.Horn},
+	{"air_conditioner", jtt.T808_0x0200_Extra_ExtSignalBits.AirConditioner},
+	{"door_magnet", jtt.T808_0x0200_Extra_ExtSignalBits.DoorMagnet},
+	{"retarder", jtt.T808_0x0200_Extra_ExtSignalBits.Retarder},
+	{"abs", jtt.T808_0x0200_Extra_ExtSignalBits.ABS},
+	{"heater", jtt.T808_0x0200_Extra_ExtSignalBits.Heater},
+	{"clutch", jtt.T808_0x0200_Extra_ExtSignalBits.Clutch},
+}
+
+// signals returns the names of the signals set.
+func signals(bits jtt.T808_0x0200_Extra_ExtSignalBits) []string {
+	set := []string{}
+	for _, b := range extSignalBits {
+		if b.get(bits) {
+			set = append(set, b.name)
+		}
+	}
+	return set
+}
+
+// ioStatus returns the names of the IO states set (0x2A).
+func ioStatus(bits jtt.T808_0x0200_Extra_IOBits) []string {
+	set := []string{}
+	if bits.DeepSleep() {
+		set = append(set, "deep_sleep")
+	}
+	if bits.Sleep() {
+		set = append(set, "sleep")
+	}
+	return set
+}
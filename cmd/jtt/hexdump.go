@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ryan961/jtt"
+)
+
+const (
+	bytesPerLine = 8
+	maxDataLines = 4 // lines of long fields printed before eliding the rest
+)
+
+// alarmBits are the names of the alarm bits of a location report.
+var alarmBits = []string{
+	"emergency", "overspeed", "fatigue", "danger", "gnss_fault", "gnss_antenna_disconnect", "gnss_antenna_short",
+	"main_power_undervoltage", "main_power_down", "lcd_fault", "tts_fault", "camera_fault", "ic_card_module_fault",
+	"overspeed_warn", "fatigue_warn", "irregular_driving", "tire_pressure_warn", "right_turn_blind_spot_abnormal",
+	"cumulative_driving_timeout", "overtime_parking", "in_out_region", "in_out_route", "road_time_abnormal",
+	"route_deviation", "vss_fault", "fuel_abnormal", "vehicle_stolen", "illegal_ignition", "illegal_displacement",
+	"collision_warn", "rollover_warn", "illegal_door_open",
+}
+
+// statusBits are the names of the status bits of a location report, the load status (bits 8-9) is printed apart.
+var statusBits = []string{
+	"acc", "positioning", "south_latitude", "west_longitude", "operating_stopped", "coord_encrypted",
+	"forward_collision_warn", "lane_departure_warn", "", "", "oil_circuit_disconnected",
+	"electric_circuit_disconnected", "door_locked", "door1_open", "door2_open", "door3_open", "door4_open",
+	"door5_open", "gps", "beidou", "glonass", "galileo", "vehicle_running",
+}
+
+// bitNames returns the names of the bits set in v, unnamed bits as bitN.
+func bitNames(v uint32, names []string) string {
+	var set []string
+	for i := range 32 {
+		if v&(1<<i) == 0 {
+			continue
+		}
+		if i < len(names) && names[i] != "" {
+			set = append(set, names[i])
+		} else if i >= len(names) {
+			set = append(set, fmt.Sprintf("bit%d", i))
+		}
+	}
+	if len(set) == 0 {
+		return "none"
+	}
+	return strings.Join(set, ",")
+}
+
+// annotator prints a frame field by field: the offset in the stream, the bytes as captured (escaped) and
+// the value of the field.
+type annotator struct {
+	w   io.Writer
+	f   *frame
+	off int // offset of the next field in the payload
+}
+
+// hexdump writes the annotated frame.
+func hexdump(w io.Writer, f *frame) {
+	fmt.Fprintf(w, "frame at offset %d, %d bytes", f.Offset, len(f.Raw))
+	if f.Stream != "" {
+		fmt.Fprintf(w, ", %s", f.Stream)
+	}
+	fmt.Fprintln(w)
+	a := &annotator{w: w, f: f}
+	if f.payload == nil {
+		a.raw(0, len(f.Raw), "data", "")
+	} else {
+		a.frame()
+	}
+	for _, err := range f.Errors {
+		fmt.Fprintf(w, "  ! %s\n", err)
+	}
+	if f.Message != nil {
+		fmt.Fprintf(w, "  reassembled %d packets, %d bytes:\n", f.Message.Packets, f.Message.Length)
+		if f.Message.Error != "" {
+			fmt.Fprintf(w, "  ! %s\n", f.Message.Error)
+		}
+		a.json(f.Message.Body)
+		a.extras(f.Message.Extras)
+	}
+	fmt.Fprintln(w)
+}
+
+func (a *annotator) frame() {
+	f := a.f
+	a.raw(0, 1, "start mark", "")
+	defer a.raw(len(f.Raw)-1, len(f.Raw), "end mark", "")
+
+	bodyEnd := len(f.payload) - 1
+	header := f.Header
+	if header == nil {
+		header = &jtt.MsgHeader{}
+		if err := header.Decode(f.payload); err != nil || header.Size() > bodyEnd {
+			a.field(len(f.payload), "data", "")
+			return
+		}
+	}
+	a.header(header)
+
+	switch {
+	case header.IsSegment():
+		a.field(bodyEnd-a.off, "segment data", fmt.Sprintf("packet %d/%d", header.SegmentInfo.Index, header.SegmentInfo.Total))
+	case f.Body == nil:
+		a.field(bodyEnd-a.off, "body", "")
+	default:
+		a.body(f.Body, bodyEnd)
+	}
+	if a.off < bodyEnd {
+		a.field(bodyEnd-a.off, "unparsed", "")
+	}
+	if _, ok := f.Body.(*jtt.RawMsg); !ok && f.Body != nil && !header.IsSegment() && !annotated(f.Body) {
+		a.json(f.Body)
+	}
+
+	value := "ok"
+	if !f.Checksum.Valid {
+		value = "invalid, expected " + f.Checksum.Expected
+	}
+	a.field(1, "checksum", fmt.Sprintf("%s %s", f.Checksum.Value, value))
+}
+
+func (a *annotator) header(h *jtt.MsgHeader) {
+	a.field(2, "msg id", h.MsgID.String())
+	property := binary.BigEndian.Uint16(a.f.payload[a.off:])
+	p := h.Property
+	desc := fmt.Sprintf("0x%04X body length %d", property, p.BodyLength)
+	if p.Encryption != 0 {
+		desc += fmt.Sprintf(", encryption %d", p.Encryption)
+	}
+	if p.IsSegment() {
+		desc += ", segmented"
+	}
+	if h.Version == jtt.Version2019 {
+		desc += ", version 2019"
+	}
+	a.field(2, "property", desc)
+	phoneSize := 6
+	if h.Version == jtt.Version2019 {
+		a.field(1, "protocol version", fmt.Sprint(h.ProtocolVersion))
+		phoneSize = 10
+	}
+	a.field(phoneSize, "phone number", h.PhoneNumber)
+	a.field(2, "serial number", fmt.Sprint(h.SerialNumber))
+	if h.SegmentInfo != nil {
+		a.field(2, "packet total", fmt.Sprint(h.SegmentInfo.Total))
+		a.field(2, "packet index", fmt.Sprint(h.SegmentInfo.Index))
+	}
+}
+
+// annotated reports whether the fields of the body are annotated one by one.
+func annotated(body jtt.Msg) bool {
+	switch body.(type) {
+	case *jtt.T808_0x0200, *jtt.T808_0x0201, *jtt.T808_0x0500, *jtt.T808_0x0704, *jtt.T808_0x0801,
+		*jtt.T808_0x0001, *jtt.T808_0x8001:
+		return true
+	}
+	return false
+}
+
+// body annotates the fields of the body ending at end, bodies without a layout are printed as a single field.
+func (a *annotator) body(body jtt.Msg, end int) {
+	switch body := body.(type) {
+	case *jtt.T808_0x0200:
+		a.location("", end)
+	case *jtt.T808_0x0201, *jtt.T808_0x0500:
+		a.word("reply serial number", "")
+		a.location("location", end)
+	case *jtt.T808_0x0704:
+		count := a.word("count", "")
+		a.field(1, "type", fmt.Sprint(a.peek(), map[byte]string{0: " normal", 1: " blind area"}[a.peek()]))
+		for i := range int(count) {
+			if a.off+2 > end {
+				return
+			}
+			n := a.word(fmt.Sprintf("locations[%d] length", i), "")
+			a.location(fmt.Sprintf("locations[%d]", i), min(a.off+int(n), end))
+		}
+	case *jtt.T808_0x0801:
+		a.field(4, "multimedia id", fmt.Sprint(body.MultimediaID))
+		a.field(1, "multimedia type", fmt.Sprint(body.MultimediaType))
+		a.field(1, "multimedia format", fmt.Sprint(body.MultimediaFormat))
+		a.field(1, "event code", fmt.Sprint(body.EventCode))
+		a.field(1, "channel id", fmt.Sprint(body.ChannelID))
+		a.location("location", min(a.off+28, end))
+		a.field(end-a.off, "multimedia data", fmt.Sprintf("%d bytes", end-a.off))
+	case *jtt.T808_0x0001, *jtt.T808_0x8001:
+		a.word("reply serial number", "")
+		a.field(2, "reply msg id", fmt.Sprintf("0x%04X", a.uint(2)))
+		a.field(1, "result", fmt.Sprint(a.peek()))
+	default:
+		a.field(end-a.off, "body", "")
+	}
+}
+
+// location annotates a location report (0x0200) ending at end, its extras are decoded with their getters.
+func (a *annotator) location(prefix string, end int) {
+	name := func(field string) string {
+		if prefix == "" {
+			return field
+		}
+		return prefix + "." + field
+	}
+	if end-a.off < 28 {
+		a.field(end-a.off, name("location"), "truncated")
+		return
+	}
+	alarm := a.uint(4)
+	a.field(4, name("alarm"), fmt.Sprintf("0x%08X %s", alarm, bitNames(alarm, alarmBits)))
+	status := a.uint(4)
+	a.field(4, name("status"), fmt.Sprintf("0x%08X %s, load %d", status, bitNames(status, statusBits), status>>8&3))
+	lat := float64(a.uint(4)) / 1e6
+	if status&(1<<2) != 0 {
+		lat = -lat
+	}
+	a.field(4, name("latitude"), fmt.Sprintf("%.6f°", lat))
+	lng := float64(a.uint(4)) / 1e6
+	if status&(1<<3) != 0 {
+		lng = -lng
+	}
+	a.field(4, name("longitude"), fmt.Sprintf("%.6f°", lng))
+	a.word(name("altitude"), "m")
+	a.field(2, name("speed"), fmt.Sprintf("%.1f km/h", float64(a.uint(2))/10))
+	a.word(name("direction"), "°")
+	t, err := jtt.FromBCDTime(a.f.payload[a.off : a.off+6])
+	value := t.Format("2006-01-02 15:04:05")
+	if err != nil {
+		value = err.Error()
+	}
+	a.field(6, name("time"), value)
+
+	for i := 0; a.off+2 <= end; i++ {
+		id, n := jtt.T808_0x0200_Extra_ID(a.peek()), int(a.f.payload[a.off+1])
+		field := name(fmt.Sprintf("extras[%d]", i))
+		if a.off+2+n > end {
+			a.field(end-a.off, field, fmt.Sprintf("%s truncated, length %d", id, n))
+			return
+		}
+		x := decodeExtra(&jtt.T808_0x0200_Extra{Id: id, Data: a.f.payload[a.off+2 : a.off+2+n]})
+		a.field(1, field+" id", fmt.Sprintf("%s %s", id, x.Name))
+		a.field(1, field+" length", fmt.Sprint(n))
+		a.field(n, field+" "+x.Name, extraValue(x))
+	}
+	if a.off < end {
+		a.field(end-a.off, name("unparsed"), "")
+	}
+}
+
+func extraValue(x extra) string {
+	if x.Error != "" {
+		return "error: " + x.Error
+	}
+	if x.Value == nil {
+		return ""
+	}
+	var value string
+	switch v := x.Value.(type) {
+	case []string:
+		value = strings.Join(v, ",")
+		if value == "" {
+			value = "none"
+		}
+	default:
+		b, _ := json.Marshal(v)
+		value = strings.Trim(string(b), `"`)
+	}
+	if x.Unit != "" {
+		value += " " + x.Unit
+	}
+	return value
+}
+
+// field prints the next n bytes of the payload.
+func (a *annotator) field(n int, name, value string) {
+	n = max(0, min(n, len(a.f.payload)-a.off))
+	start, end := a.f.offsets[a.off], a.f.offsets[a.off+n]
+	a.off += n
+	a.raw(start, end, name, value)
+}
+
+// raw prints the bytes [start, end) of the frame as captured.
+func (a *annotator) raw(start, end int, name, value string) {
+	data := a.f.Raw[start:end]
+	for line := 0; ; line++ {
+		chunk := data[:min(len(data), bytesPerLine)]
+		hexBytes := strings.ToUpper(fmt.Sprintf("% x", chunk))
+		if line == 0 {
+			s := fmt.Sprintf("  %06X  %-23s  %-22s %s", a.f.Offset+start, hexBytes, name, value)
+			fmt.Fprintln(a.w, strings.TrimRight(s, " "))
+		} else {
+			fmt.Fprintf(a.w, "  %06X  %s\n", a.f.Offset+start, hexBytes)
+		}
+		data, start = data[len(chunk):], start+len(chunk)
+		if len(data) == 0 {
+			return
+		}
+		if line+1 == maxDataLines {
+			fmt.Fprintf(a.w, "  %06X  ... %d more bytes\n", a.f.Offset+start, len(data))
+			return
+		}
+	}
+}
+
+// word prints the next WORD as a number with its unit and returns it.
+func (a *annotator) word(name, unit string) uint16 {
+	v := uint16(a.uint(2))
+	value := fmt.Sprint(v)
+	if unit != "" {
+		value += " " + unit
+	}
+	a.field(2, name, value)
+	return v
+}
+
+// uint returns the next n bytes of the payload as a big endian number, 0 if the payload is too short.
+func (a *annotator) uint(n int) uint32 {
+	if a.off+n > len(a.f.payload) {
+		return 0
+	}
+	var v uint32
+	for _, c := range a.f.payload[a.off : a.off+n] {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func (a *annotator) peek() byte {
+	if a.off >= len(a.f.payload) {
+		return 0
+	}
+	return a.f.payload[a.off]
+}
+
+// json prints the body with its struct tags.
+func (a *annotator) json(body jtt.Msg) {
+	if body == nil {
+		return
+	}
+	b, err := json.MarshalIndent(body, "  = ", "  ")
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(a.w, "  = %s\n", b)
+}
+
+func (a *annotator) extras(extras []extra) {
+	for _, x := range extras {
+		path := x.Location
+		if path != "" {
+			path += " "
+		}
+		fmt.Fprintf(a.w, "  extra %s%s %s: %s\n", path, x.ID, x.Name, extraValue(x))
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// stream is a byte stream to split into frames: the decoded hex, the raw file, or one direction of a
+// TCP connection (or UDP flow) of a capture.
+type stream struct {
+	name string
+	data []byte
+	gaps int // missing TCP segments
+}
+
+// parseHex decodes a hex dump, ignoring whitespace, 0x prefixes and the usual byte separators.
+func parseHex(s string) ([]byte, error) {
+	s = strings.NewReplacer("0x", "", "0X", "").Replace(s)
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n', ':', ',', '-':
+			return -1
+		}
+		return r
+	}, s)
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex: %w", err)
+	}
+	return data, nil
+}
+
+// isHexText reports whether data looks like a hex dump rather than binary data.
+func isHexText(data []byte) bool {
+	text := bytes.TrimSpace(data)
+	if len(text) == 0 {
+		return false
+	}
+	for _, c := range text {
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'f', c >= 'A' && c <= 'F':
+		case c == 'x' || c == 'X' || c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == ':' || c == ',' || c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	pcapMagicMicros = 0xA1B2C3D4
+	pcapMagicNanos  = 0xA1B23C4D
+	pcapngMagic     = 0x0A0D0D0A
+)
+
+// isPcap reports whether data starts with the magic number of a pcap file, in either byte order.
+func isPcap(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		if magic := order.Uint32(data); magic == pcapMagicMicros || magic == pcapMagicNanos {
+			return true
+		}
+	}
+	return false
+}
+
+// readInput splits the input into streams, format is auto, hex, raw or pcap.
+func readInput(name string, data []byte, format string) ([]*stream, error) {
+	if format == "auto" {
+		switch {
+		case isPcap(data):
+			format = "pcap"
+		case len(data) >= 4 && binary.LittleEndian.Uint32(data) == pcapngMagic:
+			return nil, errors.New("pcapng captures aren't supported, convert with: editcap -F pcap in.pcapng out.pcap")
+		case isHexText(data):
+			format = "hex"
+		default:
+			format = "raw"
+		}
+	}
+	switch format {
+	case "hex":
+		b, err := parseHex(string(data))
+		if err != nil {
+			return nil, err
+		}
+		return []*stream{{name: name, data: b}}, nil
+	case "raw":
+		return []*stream{{name: name, data: data}}, nil
+	case "pcap":
+		return readPcap(data)
+	}
+	return nil, fmt.Errorf("invalid format %q, want auto, hex, raw or pcap", format)
+}
+
+// Link types of the pcap captures.
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLoop     = 108
+	linkSLL      = 113
+	linkSLL2     = 276
+)
+
+// readPcap reassembles the TCP streams and the UDP flows of a pcap capture.
+func readPcap(data []byte) ([]*stream, error) {
+	if len(data) < 24 {
+		return nil, errors.New("pcap: truncated file header")
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if magic := order.Uint32(data); magic != pcapMagicMicros && magic != pcapMagicNanos {
+		order = binary.BigEndian
+	}
+	linkType := order.Uint32(data[20:]) & 0x0FFFFFFF
+
+	a := newAssembler()
+	for off := 24; off < len(data); {
+		if len(data)-off < 16 {
+			return nil, fmt.Errorf("pcap: truncated record header at offset %d", off)
+		}
+		size := int(order.Uint32(data[off+8:]))
+		off += 16
+		if size > len(data)-off {
+			return nil, fmt.Errorf("pcap: truncated record at offset %d", off)
+		}
+		packet := data[off : off+size]
+		off += size
+
+		ip, ok := linkPayload(linkType, packet)
+		if !ok {
+			continue
+		}
+		a.packet(ip)
+	}
+	return a.streams(), nil
+}
+
+// linkPayload returns the IP packet of a link layer frame.
+func linkPayload(linkType uint32, frame []byte) ([]byte, bool) {
+	switch linkType {
+	case linkEthernet:
+		if len(frame) < 14 {
+			return nil, false
+		}
+		etherType, payload := binary.BigEndian.Uint16(frame[12:]), frame[14:]
+		for (etherType == 0x8100 || etherType == 0x88A8) && len(payload) >= 4 { // VLAN tags
+			etherType, payload = binary.BigEndian.Uint16(payload[2:]), payload[4:]
+		}
+		return payload, etherType == 0x0800 || etherType == 0x86DD
+	case linkNull, linkLoop:
+		if len(frame) < 4 {
+			return nil, false
+		}
+		return frame[4:], true
+	case linkRaw, 12, 14:
+		return frame, true
+	case linkSLL:
+		if len(frame) < 16 {
+			return nil, false
+		}
+		return frame[16:], true
+	case linkSLL2:
+		if len(frame) < 20 {
+			return nil, false
+		}
+		return frame[20:], true
+	}
+	return nil, false
+}
+
+// assembler reassembles the payloads of the TCP and UDP packets by flow.
+type assembler struct {
+	flows map[string]*flow
+	order []*flow
+}
+
+type flow struct {
+	stream
+	started bool
+	next    uint32            // next expected sequence number
+	pending map[uint32][]byte // out of order segments by sequence number
+}
+
+func newAssembler() *assembler {
+	return &assembler{flows: make(map[string]*flow)}
+}
+
+// packet adds an IPv4 or IPv6 packet.
+func (a *assembler) packet(ip []byte) {
+	if len(ip) < 1 {
+		return
+	}
+	var src, dst netip.Addr
+	var proto byte
+	var payload []byte
+	switch ip[0] >> 4 {
+	case 4:
+		if len(ip) < 20 {
+			return
+		}
+		ihl := int(ip[0]&0x0F) * 4
+		total := int(binary.BigEndian.Uint16(ip[2:]))
+		if ihl < 20 || total < ihl || total > len(ip) {
+			total = len(ip) // captures of offloaded checksums may have a zero length
+		}
+		if ihl > total {
+			return
+		}
+		if binary.BigEndian.Uint16(ip[6:])&0x3FFF != 0 {
+			return // fragments aren't reassembled
+		}
+		proto = ip[9]
+		src, _ = netip.AddrFromSlice(ip[12:16])
+		dst, _ = netip.AddrFromSlice(ip[16:20])
+		payload = ip[ihl:total]
+	case 6:
+		if len(ip) < 40 {
+			return
+		}
+		end := min(40+int(binary.BigEndian.Uint16(ip[4:])), len(ip))
+		proto = ip[6]
+		src, _ = netip.AddrFromSlice(ip[8:24])
+		dst, _ = netip.AddrFromSlice(ip[24:40])
+		payload = ip[40:end]
+	default:
+		return
+	}
+
+	switch proto {
+	case 6: // TCP
+		if len(payload) < 20 {
+			return
+		}
+		offset := int(payload[12]>>4) * 4
+		if offset < 20 || offset > len(payload) {
+			return
+		}
+		seq := binary.BigEndian.Uint32(payload[4:])
+		syn := payload[13]&0x02 != 0
+		f := a.flow("tcp", src, dst, payload)
+		f.segment(seq, syn, payload[offset:])
+	case 17: // UDP
+		if len(payload) < 8 {
+			return
+		}
+		f := a.flow("udp", src, dst, payload)
+		f.data = append(f.data, payload[8:]...)
+	}
+}
+
+func (a *assembler) flow(network string, src, dst netip.Addr, transport []byte) *flow {
+	srcPort, dstPort := binary.BigEndian.Uint16(transport), binary.BigEndian.Uint16(transport[2:])
+	name := fmt.Sprintf("%s %s -> %s", network, netip.AddrPortFrom(src, srcPort), netip.AddrPortFrom(dst, dstPort))
+	f, ok := a.flows[name]
+	if !ok {
+		f = &flow{stream: stream{name: name}, pending: make(map[uint32][]byte)}
+		a.flows[name] = f
+		a.order = append(a.order, f)
+	}
+	return f
+}
+
+// segment adds the payload of a TCP segment, dropping retransmissions and reordering the segments.
+func (f *flow) segment(seq uint32, syn bool, payload []byte) {
+	if syn {
+		seq++
+		if !f.started {
+			f.started, f.next = true, seq
+		}
+	}
+	if len(payload) == 0 {
+		return
+	}
+	if !f.started {
+		f.started, f.next = true, seq
+	}
+	switch diff := int32(seq - f.next); {
+	case diff > 0:
+		if _, ok := f.pending[seq]; !ok {
+			f.pending[seq] = slices.Clone(payload)
+		}
+		return
+	case diff < 0:
+		if -int(diff) >= len(payload) {
+			return // retransmission
+		}
+		payload = payload[-diff:]
+	}
+	f.data = append(f.data, payload...)
+	f.next += uint32(len(payload))
+	f.drain()
+}
+
+// drain appends the pending segments following the data.
+func (f *flow) drain() {
+	for len(f.pending) > 0 {
+		progress := false
+		for seq, payload := range f.pending {
+			diff := int32(seq - f.next)
+			if diff > 0 {
+				continue
+			}
+			delete(f.pending, seq)
+			if -int(diff) < len(payload) {
+				f.data = append(f.data, payload[-diff:]...)
+				f.next += uint32(len(payload) + int(diff))
+			}
+			progress = true
+		}
+		if !progress {
+			return
+		}
+	}
+}
+
+// flush appends the segments left after missing ones, counting the gaps.
+func (f *flow) flush() {
+	for len(f.pending) > 0 {
+		seqs := slices.Collect(maps.Keys(f.pending))
+		slices.SortFunc(seqs, func(a, b uint32) int { return int(int32(a-f.next)) - int(int32(b-f.next)) })
+		f.gaps++
+		f.next = seqs[0]
+		f.drain()
+	}
+}
+
+func (a *assembler) streams() []*stream {
+	var streams []*stream
+	for _, f := range a.order {
+		f.flush()
+		if len(f.data) > 0 {
+			streams = append(streams, &f.stream)
+		}
+	}
+	return streams
+}
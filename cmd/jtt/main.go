@@ -0,0 +1,134 @@
+// Command jtt is a toolbox for JT/T 808 traffic.
+//
+// Usage:
+//
+//	jtt decode [flags] [hex ...]
+//
+// The decode command splits the input into frames, unescapes them, validates their checksum and decodes their
+// header and body through the message registry. The input is the hex given as arguments, or the file given with
+// -f (standard input with -f -): a hex dump, raw bytes or a pcap capture of which the TCP streams are reassembled.
+// Segmented messages are reassembled once all their packets were decoded, and the extras of the location reports
+// are decoded with their typed getters.
+//
+// Frames are printed as JSON with the struct tags of the message bodies, or as a hexdump annotated field by
+// field with the offsets in the input:
+//
+//	jtt decode 7E0200...7E
+//	jtt decode -o hexdump -f capture.pcap
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "decode":
+		err = decodeCommand(args, os.Stdin, os.Stdout)
+	case "help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "jtt: unknown command %q\n", cmd)
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "jtt:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `Usage: jtt <command> [flags] [arguments]
+
+Commands:
+  decode   decode JT/T 808 frames from hex, raw or pcap captures
+
+Run 'jtt <command> -h' for the flags of a command.
+`)
+}
+
+func decodeCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("decode", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: jtt decode [flags] [hex ...]\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	file := fs.String("f", "", "input file, - for the standard input")
+	format := fs.String("format", "auto", "format of the input file: auto, hex, raw or pcap")
+	output := fs.String("o", "json", "output: json or hexdump")
+	strict := fs.Bool("strict", false, "validate the body length, the BCD digits and the field values")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output != "json" && *output != "hexdump" {
+		return fmt.Errorf("invalid output %q, want json or hexdump", *output)
+	}
+
+	var streams []*stream
+	switch {
+	case fs.NArg() > 0 && *file != "":
+		return errors.New("hex arguments and -f are exclusive")
+	case fs.NArg() > 0:
+		data, err := parseHex(strings.Join(fs.Args(), ""))
+		if err != nil {
+			return err
+		}
+		streams = []*stream{{data: data}}
+	default:
+		name, r := *file, stdin
+		if name != "" && name != "-" {
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if name == "-" {
+			name = ""
+		}
+		if streams, err = readInput(name, data, *format); err != nil {
+			return err
+		}
+	}
+
+	d := newDecoder(*strict)
+	var frames []*frame
+	for _, s := range streams {
+		frames = append(frames, d.decode(s)...)
+	}
+	if len(frames) == 0 {
+		return errors.New("no frame found")
+	}
+
+	if *output == "hexdump" {
+		for _, f := range frames {
+			hexdump(stdout, f)
+		}
+		return nil
+	}
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(frames)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryan961/jtt"
+	"github.com/shopspring/decimal"
+)
+
+// location returns a 0x0200 frame with the serial number 0x7E, escaped in the frame, and some extras.
+func location(t *testing.T) []byte {
+	t.Helper()
+	body := &jtt.T808_0x0200{
+		Alarm:     2,
+		Status:    3,
+		Lat:       decimal.RequireFromString("22.543096"),
+		Lng:       decimal.RequireFromString("114.057865"),
+		Speed:     1234,
+		Direction: 90,
+		Time:      time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+	}
+	var mileage, overspeed, tires jtt.T808_0x0200_Extra
+	mileage.SetMileage(12345)
+	overspeed.SetOverspeedInfo(jtt.T808_0x0200_Extra_Overspeed{LocationType: 1, HasId: true, RegionRouteId: 7})
+	tires.SetTirePressures([]uint16{250, 260})
+	body.Extras = []jtt.T808_0x0200_Extra{mileage, overspeed, tires}
+
+	m := &jtt.Message{Header: &jtt.MsgHeader{PhoneNumber: "13812345678", SerialNumber: 0x7E}, Body: body}
+	frame, err := m.Encode()
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return frame
+}
+
+func TestParseHex(t *testing.T) {
+	for _, s := range []string{"7e0200", "0x7E 0x02 0x00", "7E:02:00\n", "7E-02,00"} {
+		data, err := parseHex(s)
+		if err != nil || !bytes.Equal(data, []byte{0x7E, 0x02, 0x00}) {
+			t.Errorf("parseHex(%q) = %X, %v", s, data, err)
+		}
+	}
+	if _, err := parseHex("7E0"); err == nil {
+		t.Error("parseHex with an odd length succeeded")
+	}
+}
+
+func TestReadInput(t *testing.T) {
+	frame := location(t)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"hex", []byte(hex.EncodeToString(frame) + "\n")},
+		{"raw", frame},
+		{"pcap", pcap(packet{seq: 1, payload: frame})},
+	}
+	for _, tt := range tests {
+		streams, err := readInput("", tt.data, "auto")
+		if err != nil {
+			t.Errorf("%s: readInput: %v", tt.name, err)
+			continue
+		}
+		if len(streams) != 1 || !bytes.Equal(streams[0].data, frame) {
+			t.Errorf("%s: readInput = %d streams, want the frame", tt.name, len(streams))
+		}
+	}
+	if _, err := readInput("", frame, "pcapng"); err == nil {
+		t.Error("readInput with an invalid format succeeded")
+	}
+}
+
+func TestReadPcap(t *testing.T) {
+	frame := location(t)
+	a, b, c := frame[:30], frame[30:60], frame[60:]
+	data := pcap(
+		packet{seq: 99, syn: true},
+		packet{seq: 100, payload: a},
+		packet{seq: 160, payload: c}, // out of order
+		packet{seq: 100, payload: a}, // retransmission
+		packet{seq: 130, payload: b},
+	)
+	streams, err := readPcap(data)
+	if err != nil {
+		t.Fatalf("readPcap: %v", err)
+	}
+	if len(streams) != 1 || !bytes.Equal(streams[0].data, frame) || streams[0].gaps != 0 {
+		t.Fatalf("readPcap = %d streams, want the reassembled frame", len(streams))
+	}
+	if want := "tcp 10.0.0.1:40000 -> 10.0.0.2:808"; streams[0].name != want {
+		t.Errorf("stream name = %q, want %q", streams[0].name, want)
+	}
+
+	// the missing segment is reported and the data following it kept
+	streams, err = readPcap(pcap(packet{seq: 100, payload: a}, packet{seq: 160, payload: c}))
+	if err != nil {
+		t.Fatalf("readPcap: %v", err)
+	}
+	if len(streams) != 1 || streams[0].gaps != 1 || len(streams[0].data) != len(a)+len(c) {
+		t.Errorf("readPcap with a gap = %+v", streams)
+	}
+}
+
+func TestDecoder_Decode(t *testing.T) {
+	frame := location(t)
+	bad := bytes.Clone(frame)
+	bad[len(bad)-2] ^= 0xFF // the checksum isn't escaped
+	data := append([]byte{0x01, 0x02}, frame...)
+	data = append(data, bad...)
+	data = append(data, 0x7E, 0x02, 0x00, 0x7E)
+
+	frames := newDecoder(false).decode(&stream{data: data})
+	if len(frames) != 4 {
+		t.Fatalf("decode = %d frames, want 4", len(frames))
+	}
+	if len(frames[0].Errors) != 1 || frames[0].Header != nil {
+		t.Errorf("leading data = %+v, want an error", frames[0])
+	}
+
+	f := frames[1]
+	if f.Offset != 2 || len(f.Errors) != 0 || !f.Checksum.Valid {
+		t.Fatalf("frame = offset %d, errors %q, checksum %+v", f.Offset, f.Errors, f.Checksum)
+	}
+	if f.Header.MsgID != jtt.MsgT808_0x0200 || f.Header.SerialNumber != 0x7E {
+		t.Errorf("header = %+v", f.Header)
+	}
+	if body, ok := f.Body.(*jtt.T808_0x0200); !ok || body.Speed != 1234 {
+		t.Errorf("body = %+v", f.Body)
+	}
+	names := make([]string, len(f.Extras))
+	for i, x := range f.Extras {
+		names[i] = x.Name
+	}
+	if got := strings.Join(names, ","); got != "mileage,overspeed,tire_pressures" {
+		t.Errorf("extras = %s", got)
+	}
+	if f.Extras[0].Value != uint32(12345) {
+		t.Errorf("mileage = %v, want 12345", f.Extras[0].Value)
+	}
+
+	// a wrong checksum is reported, the frame is still decoded
+	if f := frames[2]; f.Checksum.Valid || len(f.Errors) != 1 || f.Body == nil {
+		t.Errorf("frame with a wrong checksum = errors %q, body %v", f.Errors, f.Body)
+	}
+	if f := frames[3]; len(f.Errors) != 1 || f.Header != nil {
+		t.Errorf("short frame = %+v, want an error", f)
+	}
+}
+
+func TestDecoder_Segments(t *testing.T) {
+	header := &jtt.MsgHeader{PhoneNumber: "13812345678", SerialNumber: 10, Version: jtt.Version2019, ProtocolVersion: 1}
+	body := &jtt.T808_0x0801{MultimediaID: 9, MultimediaData: bytes.Repeat([]byte{0x7E, 0x7D, 0x01}, 500)}
+	body.Location.Time = time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	frames, err := (&jtt.Message{Header: header, Body: body}).EncodeSegments(0, nil)
+	if err != nil {
+		t.Fatalf("EncodeSegments: %v", err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("EncodeSegments = %d frames, want 2", len(frames))
+	}
+
+	decoded := newDecoder(false).decode(&stream{data: bytes.Join(frames, nil)})
+	if len(decoded) != 2 || decoded[0].Message != nil {
+		t.Fatalf("decode = %d frames, want the message reassembled by the last one", len(decoded))
+	}
+	m := decoded[1].Message
+	if m == nil || m.Packets != 2 || m.Error != "" {
+		t.Fatalf("reassembled = %+v", m)
+	}
+	if got, ok := m.Body.(*jtt.T808_0x0801); !ok || got.MultimediaID != 9 || !bytes.Equal(got.MultimediaData, body.MultimediaData) {
+		t.Errorf("reassembled body = %v", m.Body)
+	}
+}
+
+func TestHexdump(t *testing.T) {
+	frames := newDecoder(false).decode(&stream{data: location(t)})
+	var buf bytes.Buffer
+	hexdump(&buf, frames[0])
+	out := buf.String()
+	for _, want := range []string{
+		"frame at offset 0, ",
+		"  000000  7E                       start mark\n",
+		"  00000B  00 7D 02                 serial number          126\n",
+		"alarm                  0x00000002 overspeed\n",
+		"extras[0] mileage      12345 1/10 km\n",
+		"extras[2] tire_pressures [250,260] Pa\n",
+		"checksum               0x",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("hexdump doesn't contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestDecodeCommand(t *testing.T) {
+	var out bytes.Buffer
+	if err := decodeCommand([]string{"-f", "-"}, bytes.NewReader(location(t)), &out); err != nil {
+		t.Fatalf("decodeCommand: %v", err)
+	}
+	if !strings.Contains(out.String(), `"name": "overspeed"`) {
+		t.Errorf("output:\n%s", out.String())
+	}
+	if err := decodeCommand([]string{"-f", "-"}, strings.NewReader(""), &out); err == nil {
+		t.Error("decodeCommand without frames succeeded")
+	}
+	if err := decodeCommand([]string{"-o", "xml", "7E"}, nil, &out); err == nil {
+		t.Error("decodeCommand with an invalid output succeeded")
+	}
+}
+
+// packet is a TCP segment from 10.0.0.1:40000 to 10.0.0.2:808.
+type packet struct {
+	seq     uint32
+	syn     bool
+	payload []byte
+}
+
+// pcap returns a capture of the packets over Ethernet.
+func pcap(packets ...packet) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, pcapMagicMicros)
+	data = binary.LittleEndian.AppendUint16(data, 2)
+	data = binary.LittleEndian.AppendUint16(data, 4)
+	data = append(data, make([]byte, 12)...) // time zone, accuracy and snapshot length
+	data = binary.LittleEndian.AppendUint32(data, linkEthernet)
+	for _, p := range packets {
+		tcp := make([]byte, 20, 20+len(p.payload))
+		binary.BigEndian.PutUint16(tcp, 40000)
+		binary.BigEndian.PutUint16(tcp[2:], 808)
+		binary.BigEndian.PutUint32(tcp[4:], p.seq)
+		tcp[12] = 5 << 4
+		if tcp[13] = 0x18; p.syn { // PSH, ACK
+			tcp[13] = 0x02
+		}
+		tcp = append(tcp, p.payload...)
+
+		ip := make([]byte, 20, 20+len(tcp))
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+		ip[8], ip[9] = 64, 6
+		copy(ip[12:], []byte{10, 0, 0, 1, 10, 0, 0, 2})
+		ip = append(ip, tcp...)
+
+		ether := append(make([]byte, 12), 0x08, 0x00)
+		ether = append(ether, ip...)
+
+		data = append(data, make([]byte, 8)...) // timestamp
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(ether)))
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(ether)))
+		data = append(data, ether...)
+	}
+	return data
+}
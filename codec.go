@@ -0,0 +1,197 @@
+package jtt
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"hash"
+)
+
+// Codec 消息编解码器，在 DecodeOptions 的基础上支持按终端维护状态的编解码选项（如消息体 RSA 加密），可并发使用
+type Codec struct {
+	opts    DecodeOptions
+	keys    KeyStore
+	newHash func() hash.Hash
+	serials SerialGenerator
+}
+
+// CodecOption 编解码器选项
+type CodecOption func(*Codec)
+
+// WithStrict 启用严格解码模式，见 DecodeOptions.Strict
+func WithStrict() CodecOption {
+	return func(c *Codec) {
+		c.opts.Strict = true
+	}
+}
+
+// WithRegistry 设置按 MsgID 创建消息体的注册表，见 DecodeOptions.Registry
+func WithRegistry(registry *Registry) CodecOption {
+	return func(c *Codec) {
+		c.opts.Registry = registry
+	}
+}
+
+// WithVersionRegistry 设置终端协议版本注册表，见 DecodeOptions.Versions
+func WithVersionRegistry(versions *VersionRegistry) CodecOption {
+	return func(c *Codec) {
+		c.opts.Versions = versions
+	}
+}
+
+// WithMaxDecompressedSize 设置数据压缩上报解压后的最大长度，见 DecodeOptions.MaxDecompressedSize
+func WithMaxDecompressedSize(size int) CodecOption {
+	return func(c *Codec) {
+		c.opts.MaxDecompressedSize = size
+	}
+}
+
+// WithKeyStore 启用消息体 RSA 加密（消息体属性 bit10）
+//
+//	编码时若 KeyStore 中存在对端公钥，则加密消息体并设置加密标识，否则以明文发送；
+//	解码时对设置了加密标识的消息体使用本端私钥解密，私钥不存在时返回 ErrKeyNotFound；
+//	解码 0x0A00/0x8A00 时自动保存对端公钥，密钥交换消息本身始终不加密。
+//	分包消息逐包加密，接收方逐包解密后再合并。
+func WithKeyStore(keys KeyStore) CodecOption {
+	return func(c *Codec) {
+		c.keys = keys
+	}
+}
+
+// WithOAEPHash 设置 RSA-OAEP 使用的哈希算法，默认为 SHA-256
+func WithOAEPHash(newHash func() hash.Hash) CodecOption {
+	return func(c *Codec) {
+		c.newHash = newHash
+	}
+}
+
+// WithSerialGenerator 设置消息流水号生成器，编码时 MsgHeader.SerialNumber 为 0 的消息按终端手机号分配流水号
+func WithSerialGenerator(gen SerialGenerator) CodecOption {
+	return func(c *Codec) {
+		c.serials = gen
+	}
+}
+
+// NewCodec 创建消息编解码器
+func NewCodec(opts ...CodecOption) *Codec {
+	c := &Codec{newHash: sha256.New}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.keys != nil {
+		c.opts.cipher = &rsaCipher{keys: c.keys, newHash: c.newHash}
+	}
+	return c
+}
+
+// Encode 将消息包编码为完整的数据帧，同 Message.Encode
+//
+//	设置了流水号生成器且 MsgHeader.SerialNumber 为 0 时，先为消息分配流水号。
+func (c *Codec) Encode(m *Message) ([]byte, error) {
+	if c.serials != nil && m.Header != nil && m.Header.SerialNumber == 0 {
+		m.Header.SerialNumber = c.serials.Next(m.Header.PhoneNumber)
+	}
+	return m.encode(c.opts.cipher)
+}
+
+// EncodeSegments 将消息包分包编码为完整的数据帧，同 Message.EncodeSegments
+//
+//	nextSerial 为 nil、设置了流水号生成器且 MsgHeader.SerialNumber 为 0 时，每一包的流水号由生成器分配。
+//	加密时 maxBodyLen 限制的是单包密文长度。
+func (c *Codec) EncodeSegments(m *Message, maxBodyLen int, nextSerial func() uint16) ([][]byte, error) {
+	if nextSerial == nil && c.serials != nil && m.Header != nil && m.Header.SerialNumber == 0 {
+		nextSerial = SerialFunc(c.serials, m.Header.PhoneNumber)
+	}
+	return m.encodeSegments(maxBodyLen, nextSerial, c.opts.cipher)
+}
+
+// EncodeFrames 以终端的手机号与协议版本补全消息头后分包编码，返回数据帧及最后一包的流水号
+//
+//	消息头未设置手机号时使用 phone；未指定协议版本（Version2013 且 ProtocolVersion 为 0）时使用 version，
+//	并将其同步至消息体（见 VersionedMsg）；流水号为 0 时由 serials 按手机号为每一包分配流水号，
+//	serials 为 nil 时使用 WithSerialGenerator 设置的生成器，均未设置时使用 GlobalSerialGenerator。
+func (c *Codec) EncodeFrames(m *Message, phone string, version VersionType, serials SerialGenerator) (frames [][]byte, last uint16, err error) {
+	if m.Header == nil {
+		m.Header = &MsgHeader{}
+	}
+	header := m.Header
+	if header.PhoneNumber == "" {
+		header.PhoneNumber = phone
+	}
+	if header.Version == Version2013 && header.ProtocolVersion == 0 {
+		header.Version = version
+		if header.Version == Version2019 {
+			header.ProtocolVersion = 1
+		}
+		if versioned, ok := m.Body.(VersionedMsg); ok {
+			versioned.SetProtocolVersion(header.Version)
+		}
+	}
+
+	var nextSerial func() uint16
+	if header.SerialNumber == 0 {
+		if serials == nil {
+			serials = c.serials
+		}
+		if serials == nil {
+			serials = GlobalSerialGenerator
+		}
+		next := SerialFunc(serials, header.PhoneNumber)
+		nextSerial = func() uint16 {
+			last = next()
+			return last
+		}
+	}
+	frames, err = c.EncodeSegments(m, 0, nextSerial)
+	if err != nil {
+		return nil, 0, err
+	}
+	if nextSerial == nil {
+		last = header.SerialNumber + uint16(len(frames)-1)
+	}
+	return frames, last, nil
+}
+
+// Decode 将完整的数据帧解码为消息包，同 DecodeOptions.Decode
+func (c *Codec) Decode(data []byte) (*Message, error) {
+	m := &Message{}
+	if err := c.DecodeInto(m, data); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DecodeInto 将完整的数据帧解码至 m，同 DecodeOptions.DecodeInto
+func (c *Codec) DecodeInto(m *Message, data []byte) error {
+	if err := m.decode(data, c.opts, true); err != nil {
+		return err
+	}
+	c.observeKey(m)
+	return nil
+}
+
+// Decompress 解压数据压缩上报并解码其中的消息包，同 DecodeOptions.Decompress
+func (c *Codec) Decompress(m *Message) ([]*Message, error) {
+	return c.opts.Decompress(m)
+}
+
+// observeKey 保存 0x0A00/0x8A00 中的对端公钥
+func (c *Codec) observeKey(m *Message) {
+	if c.keys == nil {
+		return
+	}
+	var (
+		key *rsa.PublicKey
+		err error
+	)
+	switch body := m.Body.(type) {
+	case *T808_0x0A00:
+		key, err = body.PublicKey()
+	case *T808_0x8A00:
+		key, err = body.PublicKey()
+	default:
+		return
+	}
+	if err == nil {
+		c.keys.SetPublicKey(m.Header.PhoneNumber, key)
+	}
+}
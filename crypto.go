@@ -0,0 +1,145 @@
+package jtt
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"hash"
+	"math/big"
+	"sync"
+)
+
+const (
+	// EncryptionNone 消息体不加密
+	EncryptionNone byte = 0
+	// EncryptionRSA 消息体经过 RSA 算法加密（消息体属性 bit10）
+	EncryptionRSA byte = 1
+)
+
+// rsaModulusSize 0x0A00/0x8A00 中 RSA 公钥 n 的长度，即 RSA-1024
+const rsaModulusSize = 128
+
+// KeyStore 按终端手机号保存 RSA 密钥，用于 Codec 加解密消息体，实现需可并发使用
+//
+//	平台侧：PublicKey 为终端通过 0x0A00 上报的公钥，PrivateKey 为平台私钥（其公钥通过 0x8A00 下发）；
+//	终端侧：PublicKey 为平台通过 0x8A00 下发的公钥，PrivateKey 为终端私钥。
+type KeyStore interface {
+	// PublicKey 返回对端的 RSA 公钥，用于加密发送给对端的消息体
+	PublicKey(phoneNumber string) (*rsa.PublicKey, bool)
+	// SetPublicKey 保存对端的 RSA 公钥，Codec 解码 0x0A00/0x8A00 时自动调用
+	SetPublicKey(phoneNumber string, key *rsa.PublicKey)
+	// PrivateKey 返回本端的 RSA 私钥，用于解密对端发送的消息体
+	PrivateKey(phoneNumber string) (*rsa.PrivateKey, bool)
+}
+
+// MemoryKeyStore 内存 KeyStore，所有终端共用同一本端私钥
+type MemoryKeyStore struct {
+	private *rsa.PrivateKey
+
+	mu   sync.RWMutex
+	keys map[string]*rsa.PublicKey
+}
+
+// NewMemoryKeyStore 创建内存 KeyStore，private 为本端私钥，为 nil 时不解密消息体
+func NewMemoryKeyStore(private *rsa.PrivateKey) *MemoryKeyStore {
+	return &MemoryKeyStore{private: private, keys: make(map[string]*rsa.PublicKey)}
+}
+
+func (s *MemoryKeyStore) PublicKey(phoneNumber string) (*rsa.PublicKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[phoneNumber]
+	return key, ok
+}
+
+func (s *MemoryKeyStore) SetPublicKey(phoneNumber string, key *rsa.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[phoneNumber] = key
+}
+
+// DeletePublicKey 删除对端的 RSA 公钥，如终端注销时
+func (s *MemoryKeyStore) DeletePublicKey(phoneNumber string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, phoneNumber)
+}
+
+func (s *MemoryKeyStore) PrivateKey(string) (*rsa.PrivateKey, bool) {
+	return s.private, s.private != nil
+}
+
+// NewRSAPublicKey 由 0x0A00/0x8A00 中的 {e, n} 构造 RSA 公钥，n 为大端序
+func NewRSAPublicKey(e uint32, n [rsaModulusSize]byte) (*rsa.PublicKey, error) {
+	modulus := new(big.Int).SetBytes(n[:])
+	if modulus.Sign() == 0 {
+		return nil, fmt.Errorf("rsa public key: %w (zero modulus)", ErrInvalidBody)
+	}
+	if e < 3 || e&1 == 0 {
+		return nil, fmt.Errorf("rsa public key: %w (invalid exponent %d)", ErrInvalidBody, e)
+	}
+	return &rsa.PublicKey{N: modulus, E: int(e)}, nil
+}
+
+// encodeRSAPublicKey 将 RSA 公钥转换为 0x0A00/0x8A00 中的 {e, n}，仅支持不超过 1024 位的密钥
+func encodeRSAPublicKey(key *rsa.PublicKey) (e uint32, n [rsaModulusSize]byte, err error) {
+	if key == nil || key.N == nil {
+		return 0, n, fmt.Errorf("rsa public key: %w (nil key)", ErrInvalidBody)
+	}
+	if key.N.BitLen() > rsaModulusSize*8 {
+		return 0, n, fmt.Errorf("rsa public key: %w (%d bits, limit %d)", ErrInvalidBody, key.N.BitLen(), rsaModulusSize*8)
+	}
+	if key.E <= 0 || uint64(key.E) > uint64(^uint32(0)) {
+		return 0, n, fmt.Errorf("rsa public key: %w (invalid exponent %d)", ErrInvalidBody, key.E)
+	}
+	key.N.FillBytes(n[:])
+	return uint32(key.E), n, nil
+}
+
+// rsaCipher 按终端加解密消息体，密钥交换消息（0x0A00/0x8A00）始终不加密
+type rsaCipher struct {
+	keys    KeyStore
+	newHash func() hash.Hash
+}
+
+func (c *rsaCipher) publicKey(header *MsgHeader) (*rsa.PublicKey, bool) {
+	if header.MsgID == MsgT808_0x0A00 || header.MsgID == MsgT808_0x8A00 {
+		return nil, false
+	}
+	return c.keys.PublicKey(header.PhoneNumber)
+}
+
+// encrypt 对端公钥存在时加密消息体并设置加密标识，否则清除加密标识并原样返回
+func (c *rsaCipher) encrypt(header *MsgHeader, body []byte) ([]byte, error) {
+	key, ok := c.publicKey(header)
+	if !ok {
+		header.Property.Encryption &^= EncryptionRSA
+		return body, nil
+	}
+	ciphertext, err := EncryptOAEP(c.newHash(), key, body, nil)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt body %s: %w", header.MsgID, err)
+	}
+	header.Property.Encryption |= EncryptionRSA
+	return ciphertext, nil
+}
+
+func (c *rsaCipher) decrypt(header *MsgHeader, body []byte) ([]byte, error) {
+	key, ok := c.keys.PrivateKey(header.PhoneNumber)
+	if !ok {
+		return nil, fmt.Errorf("%w (%s)", ErrKeyNotFound, header.PhoneNumber)
+	}
+	plaintext, err := DecryptOAEP(c.newHash(), key, body, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt body %s: %w: %w", header.MsgID, ErrInvalidBody, err)
+	}
+	return plaintext, nil
+}
+
+// plaintextLimit 返回加密后不超过 n 字节的最大明文长度，不加密时返回 n
+func (c *rsaCipher) plaintextLimit(header *MsgHeader, n int) int {
+	key, ok := c.publicKey(header)
+	if !ok {
+		return n
+	}
+	return n / key.Size() * (key.Size() - 2*c.newHash().Size() - 2)
+}
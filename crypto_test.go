@@ -0,0 +1,125 @@
+package jtt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+)
+
+func TestCodec_RSA(t *testing.T) {
+	const phone = "13800138000"
+	platformKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	terminalKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	platform := NewCodec(WithKeyStore(NewMemoryKeyStore(platformKey)))
+	terminal := NewCodec(WithKeyStore(NewMemoryKeyStore(terminalKey)))
+
+	exchange := func(from, to *Codec, body Msg) *Message {
+		t.Helper()
+		data, err := from.Encode(&Message{Header: &MsgHeader{PhoneNumber: phone}, Body: body})
+		if err != nil {
+			t.Fatalf("encode %s: %v", body.MsgID(), err)
+		}
+		m, err := to.Decode(data)
+		if err != nil {
+			t.Fatalf("decode %s: %v", body.MsgID(), err)
+		}
+		return m
+	}
+
+	// 密钥交换消息以明文发送
+	upload := &T808_0x0A00{}
+	if err := upload.SetPublicKey(&terminalKey.PublicKey); err != nil {
+		t.Fatalf("set public key: %v", err)
+	}
+	if m := exchange(terminal, platform, upload); m.Header.Property.Encryption != EncryptionNone {
+		t.Fatalf("expect plaintext key exchange, got encryption %d", m.Header.Property.Encryption)
+	}
+	download := &T808_0x8A00{}
+	if err := download.SetPublicKey(&platformKey.PublicKey); err != nil {
+		t.Fatalf("set public key: %v", err)
+	}
+	exchange(platform, terminal, download)
+
+	m := exchange(terminal, platform, &T808_0x0900{TransparentMsgType: 0x41, TransparentMsgContent: []byte("uplink")})
+	if m.Header.Property.Encryption != EncryptionRSA {
+		t.Fatalf("expect encrypted uplink, got encryption %d", m.Header.Property.Encryption)
+	}
+	if got := m.Body.(*T808_0x0900); string(got.TransparentMsgContent) != "uplink" {
+		t.Fatalf("unexpected uplink body %+v", got)
+	}
+
+	m = exchange(platform, terminal, &T808_0x8001{ReplyMsgSerialNo: 1, ReplyMsgID: MsgT808_0x0900})
+	if m.Header.Property.Encryption != EncryptionRSA || m.Body.(*T808_0x8001).ReplyMsgID != MsgT808_0x0900 {
+		t.Fatalf("unexpected downlink %+v %+v", m.Header.Property, m.Body)
+	}
+
+	// 分包逐包加密，单包密文不超过 maxBodyLen
+	content := bytes.Repeat([]byte("segment"), 200)
+	packets, err := terminal.EncodeSegments(&Message{
+		Header: &MsgHeader{PhoneNumber: phone},
+		Body:   &T808_0x0900{TransparentMsgType: 0x41, TransparentMsgContent: content},
+	}, 512, nil)
+	if err != nil {
+		t.Fatalf("encode segments: %v", err)
+	}
+	var body []byte
+	for _, packet := range packets {
+		m, err := platform.Decode(packet)
+		if err != nil {
+			t.Fatalf("decode segment: %v", err)
+		}
+		if m.Header.Property.Encryption != EncryptionRSA || m.Header.Property.BodyLength > 512 {
+			t.Fatalf("unexpected segment property %+v", m.Header.Property)
+		}
+		body = append(body, m.Body.(*RawMsg).Data...)
+	}
+	if !bytes.Equal(body[1:], content) {
+		t.Fatalf("unexpected reassembled body of %d bytes", len(body))
+	}
+
+	// 无私钥时无法解密
+	data, err := terminal.Encode(&Message{Header: &MsgHeader{PhoneNumber: phone}, Body: &T808_0x0002{}})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if _, err := NewCodec(WithKeyStore(NewMemoryKeyStore(nil))).Decode(data); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expect ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestNewRSAPublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	msg := &T808_0x0A00{}
+	if err := msg.SetPublicKey(&key.PublicKey); err != nil {
+		t.Fatalf("set public key: %v", err)
+	}
+	got, err := msg.PublicKey()
+	if err != nil {
+		t.Fatalf("public key: %v", err)
+	}
+	if !got.Equal(&key.PublicKey) {
+		t.Fatal("expect public key round trip")
+	}
+
+	if _, err := (&T808_0x0A00{E: 65537}).PublicKey(); !errors.Is(err, ErrInvalidBody) {
+		t.Fatalf("expect ErrInvalidBody for zero modulus, got %v", err)
+	}
+	large, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	if err := msg.SetPublicKey(&large.PublicKey); !errors.Is(err, ErrInvalidBody) {
+		t.Fatalf("expect ErrInvalidBody for 2048-bit key, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package jtt
 
 import (
 	"errors"
+	"fmt"
 )
 
 var (
@@ -25,4 +26,50 @@ var (
 	ErrInvalidExtraLength = errors.New("invalid extra length")
 	// ErrSegmentNotCompleted segment not completed
 	ErrSegmentNotCompleted = errors.New("segment not completed")
+	// ErrVersionMismatch protocol version of message body and header mismatch
+	ErrVersionMismatch = errors.New("protocol version mismatch")
+	// ErrDecompressedTooLarge decompressed data too large
+	ErrDecompressedTooLarge = errors.New("decompressed data too large")
+	// ErrKeyNotFound rsa key not found
+	ErrKeyNotFound = errors.New("rsa key not found")
+	// ErrInvalidBCD invalid bcd digit
+	ErrInvalidBCD = errors.New("invalid bcd digit")
+	// ErrInvalidEnum enum value out of range
+	ErrInvalidEnum = errors.New("enum value out of range")
 )
+
+// DecodeError 严格模式（DecodeOptions.Strict）下的解码错误，记录出错的消息 ID、字段路径及字节偏移
+//
+//	Offset 为相对转义还原后数据帧（不含标识位）起始位置的偏移，即消息头第一个字节为 0；
+//	由消息体 Validate 返回时为相对消息体起始位置的偏移，解码时会自动换算。
+//	Err 包装了 ErrInvalidHeader、ErrInvalidBody 等哨兵错误，可通过 errors.Is 判断。
+type DecodeError struct {
+	MsgID  MsgID  // 消息 ID
+	Field  string // 字段路径，如 header.property.bodyLength、body.mediaList[1].mediaType
+	Offset int    // 字节偏移
+	Err    error  // 底层错误
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decode %s: field %s at offset %d: %v", e.MsgID, e.Field, e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// checkEnum 校验枚举取值不超过 max，用于消息体 Validate
+func checkEnum(field string, offset int, value, max byte) error {
+	if value <= max {
+		return nil
+	}
+	return &DecodeError{Field: field, Offset: offset, Err: fmt.Errorf("%w: %w (%d > %d)", ErrInvalidBody, ErrInvalidEnum, value, max)}
+}
+
+// checkBCD 校验 BCD 解码后的字符串只包含数字，用于消息体 Validate
+func checkBCD(field string, offset int, value string) error {
+	for i := 0; i < len(value); i++ {
+		if value[i] < '0' || value[i] > '9' {
+			return &DecodeError{Field: field, Offset: offset, Err: fmt.Errorf("%w: %w (%q)", ErrInvalidBody, ErrInvalidBCD, value)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package jtt
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// DefaultMaxFrameSize 默认最大帧长度：消息头（2019 版含封装项）+ 最大消息体 + 校验码全部转义后的长度，再加首尾标识位
+const DefaultMaxFrameSize = 2*(Message2019HeaderSize+4+int(bodyLengthBit)+1) + 2
+
+// ScanFrames 是 bufio.Scanner 使用的 bufio.SplitFunc，按 0x7E 标识位切分数据帧。
+//
+//	返回的数据帧包含首尾标识位，可直接交给 DecodeMessage 解码；帧长度上限为 DefaultMaxFrameSize。
+//	标识位之间的垃圾数据、转义错误或校验失败的数据帧会被丢弃，并从下一个 0x7E 重新同步。
+func ScanFrames(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	return scanFrames(data, atEOF)
+}
+
+var scanFrames = splitFrames(DefaultMaxFrameSize, nil)
+
+// FrameScannerOption FrameScanner 配置项
+type FrameScannerOption func(s *FrameScanner)
+
+// WithMaxFrameSize 设置最大帧长度（含首尾标识位，按转义后计算），超过该长度的数据将被丢弃。
+//
+// By default, the max frame size is DefaultMaxFrameSize.
+func WithMaxFrameSize(size int) FrameScannerOption {
+	return func(s *FrameScanner) {
+		s.maxFrameSize = size
+	}
+}
+
+// WithDiscardHandler 设置被丢弃数据的回调，data 仅在回调期间有效。
+func WithDiscardHandler(handler func(data []byte)) FrameScannerOption {
+	return func(s *FrameScanner) {
+		s.onDiscard = handler
+	}
+}
+
+// WithDiscardReasonHandler 设置被丢弃数据的回调，附带丢弃原因（如用于统计校验码错误），data 仅在回调期间有效。
+func WithDiscardReasonHandler(handler func(reason DiscardReason, data []byte)) FrameScannerOption {
+	return func(s *FrameScanner) {
+		s.onDiscardReason = handler
+	}
+}
+
+// DiscardReason 数据被 FrameScanner 丢弃的原因
+type DiscardReason int
+
+const (
+	DiscardGarbage    DiscardReason = iota + 1 // 标识位之外的垃圾数据
+	DiscardTooLong                             // 超过最大帧长度
+	DiscardIncomplete                          // 数据流结束时不完整的帧
+	DiscardEscape                              // 转义序列错误
+	DiscardTooShort                            // 短于最小消息长度
+	DiscardChecksum                            // 校验码错误
+)
+
+func (r DiscardReason) String() string {
+	switch r {
+	case DiscardGarbage:
+		return "garbage"
+	case DiscardTooLong:
+		return "too_long"
+	case DiscardIncomplete:
+		return "incomplete"
+	case DiscardEscape:
+		return "escape"
+	case DiscardTooShort:
+		return "too_short"
+	case DiscardChecksum:
+		return "checksum"
+	}
+	return "unknown"
+}
+
+// FrameScanner 从字节流（如 TCP 连接）中切分出完整的数据帧。
+//
+//	处理粘包、半包以及帧间垃圾数据，遇到损坏数据时从下一个 0x7E 重新同步。
+type FrameScanner struct {
+	scanner *bufio.Scanner
+
+	maxFrameSize    int
+	onDiscard       func(data []byte)
+	onDiscardReason func(reason DiscardReason, data []byte)
+}
+
+// NewFrameScanner 创建数据帧切分器
+func NewFrameScanner(r io.Reader, opts ...FrameScannerOption) *FrameScanner {
+	s := &FrameScanner{
+		maxFrameSize: DefaultMaxFrameSize,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.maxFrameSize < Message2013HeaderSize+3 {
+		s.maxFrameSize = Message2013HeaderSize + 3
+	}
+
+	s.scanner = bufio.NewScanner(r)
+	s.scanner.Buffer(make([]byte, 0, min(4096, s.maxFrameSize)), s.maxFrameSize)
+	s.scanner.Split(splitFrames(s.maxFrameSize, s.discard))
+	return s
+}
+
+func (s *FrameScanner) discard(reason DiscardReason, data []byte) {
+	if s.onDiscard != nil {
+		s.onDiscard(data)
+	}
+	if s.onDiscardReason != nil {
+		s.onDiscardReason(reason, data)
+	}
+}
+
+// Scan 读取下一帧，读取结束或发生错误时返回 false
+func (s *FrameScanner) Scan() bool {
+	return s.scanner.Scan()
+}
+
+// Frame 返回最近一次 Scan 读取的数据帧（含首尾标识位），下一次调用 Scan 后失效
+func (s *FrameScanner) Frame() []byte {
+	return s.scanner.Bytes()
+}
+
+// Err 返回读取过程中遇到的第一个非 io.EOF 错误
+func (s *FrameScanner) Err() error {
+	return s.scanner.Err()
+}
+
+func splitFrames(maxFrameSize int, onDiscard func(reason DiscardReason, data []byte)) bufio.SplitFunc {
+	discard := func(reason DiscardReason, data []byte) {
+		if onDiscard != nil && len(data) > 0 {
+			onDiscard(reason, data)
+		}
+	}
+
+	// bufio.Scanner 在 EOF 后仅会再调用一次 SplitFunc，因此需在一次调用内跳过全部无效数据
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		offset := 0
+		for offset < len(data) {
+			buf := data[offset:]
+
+			// 丢弃起始标识位之前的数据
+			start := bytes.IndexByte(buf, boundaryMark)
+			if start < 0 {
+				discard(DiscardGarbage, buf)
+				return len(data), nil, nil
+			}
+			if start > 0 {
+				discard(DiscardGarbage, buf[:start])
+				offset += start
+				continue
+			}
+
+			end := bytes.IndexByte(buf[1:], boundaryMark)
+			if end < 0 {
+				if len(buf) >= maxFrameSize {
+					discard(DiscardTooLong, buf)
+					return len(data), nil, nil
+				}
+				if atEOF {
+					// 流已结束的不完整帧
+					discard(DiscardIncomplete, buf)
+					return len(data), nil, nil
+				}
+				return offset, nil, nil
+			}
+			end++
+
+			// 连续的标识位：前一个为上一帧的结束标识位
+			if end == 1 {
+				offset++
+				continue
+			}
+
+			frame := buf[:end+1]
+			reason := DiscardTooLong
+			if len(frame) <= maxFrameSize {
+				reason = checkFrame(frame)
+			}
+			if reason != 0 {
+				// 保留结束标识位，作为下一帧的起始标识位重新同步
+				discard(reason, buf[:end])
+				offset += end
+				continue
+			}
+			return offset + end + 1, frame, nil
+		}
+		return offset, nil, nil
+	}
+}
+
+// checkFrame 校验数据帧的转义序列、最小长度与校验码，不分配内存；校验通过时返回 0，否则返回丢弃原因
+func checkFrame(frame []byte) DiscardReason {
+	var (
+		sum  byte
+		size int
+	)
+	for i := 1; i < len(frame)-1; i++ {
+		b := frame[i]
+		if b == escapeMark {
+			if i+1 >= len(frame)-1 {
+				return DiscardEscape
+			}
+			switch frame[i+1] {
+			case escapeOne:
+				b = escapeMark
+			case escapeTwo:
+				b = boundaryMark
+			default:
+				return DiscardEscape
+			}
+			i++
+		}
+		sum ^= b
+		size++
+	}
+	switch {
+	case size < Message2013HeaderSize+1:
+		return DiscardTooShort
+	case sum != 0:
+		return DiscardChecksum
+	}
+	return 0
+}
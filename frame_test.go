@@ -0,0 +1,113 @@
+package jtt
+
+import (
+	"bytes"
+	"testing"
+	"testing/iotest"
+)
+
+func testFrame(t *testing.T, serial uint16) []byte {
+	t.Helper()
+	data, err := (&Message{
+		Header: &MsgHeader{PhoneNumber: "13800138000", SerialNumber: serial},
+		Body:   &T808_0x0001{ReplyMsgSerialNo: 0x7e7d, ReplyMsgID: MsgT808_0x8001},
+	}).Encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return data
+}
+
+func scanAll(t *testing.T, s *FrameScanner) []uint16 {
+	t.Helper()
+	var serials []uint16
+	for s.Scan() {
+		m, err := DecodeMessage(s.Frame())
+		if err != nil {
+			t.Fatalf("decode frame % X: %v", s.Frame(), err)
+		}
+		serials = append(serials, m.Header.SerialNumber)
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	return serials
+}
+
+func TestFrameScanner_CoalescedAndSplit(t *testing.T) {
+	var stream []byte
+	for i := uint16(1); i <= 3; i++ {
+		stream = append(stream, testFrame(t, i)...)
+	}
+
+	got := scanAll(t, NewFrameScanner(iotest.OneByteReader(bytes.NewReader(stream))))
+	if len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Fatalf("unexpected frames: %v", got)
+	}
+}
+
+func TestFrameScanner_Resync(t *testing.T) {
+	frame1, frame2, frame3 := testFrame(t, 1), testFrame(t, 2), testFrame(t, 3)
+
+	var stream []byte
+	stream = append(stream, 0x01, 0x02, 0x03)             // 起始垃圾数据
+	stream = append(stream, frame1[5:]...)                // 半帧，结束标识位与下一帧相邻
+	stream = append(stream, frame1...)                    // 完整帧
+	stream = append(stream, frame2[:len(frame2)/2]...)    // 未结束的损坏帧
+	stream = append(stream, frame2...)                    // 完整帧
+	stream = append(stream, 0x7e, 0x7d, 0x05, 0x7e, 0xff) // 非法转义
+	stream = append(stream, frame3...)                    // 完整帧
+	stream = append(stream, frame3[:4]...)                // 结尾不完整帧
+
+	var discarded int
+	s := NewFrameScanner(bytes.NewReader(stream), WithDiscardHandler(func(data []byte) {
+		discarded += len(data)
+	}))
+	got := scanAll(t, s)
+	if len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Fatalf("unexpected frames: %v", got)
+	}
+	if discarded == 0 {
+		t.Fatalf("expect discarded data to be reported")
+	}
+}
+
+func TestFrameScanner_MaxFrameSize(t *testing.T) {
+	var stream []byte
+	stream = append(stream, 0x7e)
+	stream = append(stream, bytes.Repeat([]byte{0x01}, 100)...)
+	stream = append(stream, testFrame(t, 9)...)
+
+	got := scanAll(t, NewFrameScanner(bytes.NewReader(stream), WithMaxFrameSize(64)))
+	if len(got) != 1 || got[0] != 9 {
+		t.Fatalf("unexpected frames: %v", got)
+	}
+}
+
+func TestFrameScanner_DiscardReason(t *testing.T) {
+	frame1, frame2 := testFrame(t, 1), testFrame(t, 2)
+	corrupted := bytes.Clone(frame1)
+	corrupted[len(corrupted)-2] ^= 0x01 // 校验码错误
+
+	var stream []byte
+	stream = append(stream, 0x01, 0x02)                   // 起始垃圾数据
+	stream = append(stream, corrupted...)                 // 校验码错误的帧
+	stream = append(stream, 0x7e, 0x7d, 0x05, 0x7e, 0xff) // 非法转义
+	stream = append(stream, 0x7e, 0x01, 0x02, 0x7e)       // 过短的帧
+	stream = append(stream, frame2...)                    // 完整帧
+	stream = append(stream, frame2[:4]...)                // 结尾不完整帧
+
+	reasons := map[DiscardReason]int{}
+	s := NewFrameScanner(bytes.NewReader(stream), WithDiscardReasonHandler(func(reason DiscardReason, data []byte) {
+		reasons[reason]++
+	}))
+	got := scanAll(t, s)
+	if len(got) != 1 || got[0] != 2 {
+		t.Fatalf("unexpected frames: %v", got)
+	}
+	for _, reason := range []DiscardReason{DiscardGarbage, DiscardChecksum, DiscardEscape, DiscardTooShort, DiscardIncomplete} {
+		if reasons[reason] == 0 {
+			t.Errorf("expect %s discard to be reported, got %v", reason, reasons)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package jtt
 
 import (
+	"bytes"
 	"fmt"
 )
 
@@ -25,6 +26,19 @@ const (
 	Version2019 VersionType = 1
 )
 
+// String 返回协议版本的年份，如 "2019"
+func (v VersionType) String() string {
+	switch v {
+	case Version2011:
+		return "2011"
+	case Version2013:
+		return "2013"
+	case Version2019:
+		return "2019"
+	}
+	return "unknown"
+}
+
 // MsgHeader 定义消息头
 type MsgHeader struct {
 	MsgID           MsgID        `json:"msgID"`           // 消息ID
@@ -37,6 +51,7 @@ type MsgHeader struct {
 	// 	解码：
 	//	  VersionSign==0 => Version2013
 	//	  VersionSign==1 => Version2019
+	//	  2011 与 2013 消息头相同，需通过 DecodeOptions.Versions 按终端注册消息推断 Version2011
 	//	编码：
 	// 	  当设置为 Version2011/Version2013/Version2019 时，按对应规则写入
 	Version VersionType `json:"version"`
@@ -48,7 +63,8 @@ func (h *MsgHeader) Decode(data []byte) error {
 		return fmt.Errorf("invalid data length: %d", len(data))
 	}
 
-	reader := NewReader(data)
+	var reader Reader
+	reader.Reset(data)
 
 	// 读取消息ID
 	msgID, err := reader.ReadWord()
@@ -62,7 +78,9 @@ func (h *MsgHeader) Decode(data []byte) error {
 	if err != nil {
 		return err
 	}
-	h.Property = &Property{}
+	if h.Property == nil {
+		h.Property = &Property{}
+	}
 	if err := h.Property.Decode(attr); err != nil { // 消息体属性 [2,4) 位
 		return err
 	}
@@ -77,11 +95,12 @@ func (h *MsgHeader) Decode(data []byte) error {
 			return err
 		}
 
-		h.PhoneNumber, err = reader.ReadBcd(10)
+		err = h.readPhoneNumber(&reader, 10)
 	default:
 		// 未知比特，按旧版安全处理
 		h.Version = Version2013
-		h.PhoneNumber, err = reader.ReadBcd(6)
+		h.ProtocolVersion = 0
+		err = h.readPhoneNumber(&reader, 6)
 	}
 	if err != nil {
 		return err
@@ -92,16 +111,22 @@ func (h *MsgHeader) Decode(data []byte) error {
 		return err
 	}
 
-	if h.Property.IsSegment() { // 消息包封装项
+	if !h.Property.IsSegment() {
+		h.SegmentInfo = nil
+		return nil
+	}
+
+	// 消息包封装项
+	if h.SegmentInfo == nil {
 		h.SegmentInfo = &SegmentInfo{}
-		h.SegmentInfo.Total, err = reader.ReadWord()
-		if err != nil {
-			return err
-		}
-		h.SegmentInfo.Index, err = reader.ReadWord()
-		if err != nil {
-			return err
-		}
+	}
+	h.SegmentInfo.Total, err = reader.ReadWord()
+	if err != nil {
+		return err
+	}
+	h.SegmentInfo.Index, err = reader.ReadWord()
+	if err != nil {
+		return err
 	}
 	return nil
 }
@@ -140,6 +165,32 @@ func (h *MsgHeader) Encode() (pkt []byte, err error) {
 	return writer.Bytes(), nil
 }
 
+// Clone 返回消息头的深拷贝
+func (h *MsgHeader) Clone() *MsgHeader {
+	c := *h
+	if h.Property != nil {
+		p := *h.Property
+		c.Property = &p
+	}
+	if h.SegmentInfo != nil {
+		si := *h.SegmentInfo
+		c.SegmentInfo = &si
+	}
+	return &c
+}
+
+// Size 返回消息头编码后的长度（含消息包封装项）
+func (h *MsgHeader) Size() int {
+	size := Message2013HeaderSize
+	if h.Version == Version2019 {
+		size = Message2019HeaderSize
+	}
+	if h.SegmentInfo != nil {
+		size += 4
+	}
+	return size
+}
+
 func (h *MsgHeader) GetVersion() VersionType {
 	return h.Property.Version()
 }
@@ -157,6 +208,24 @@ type Property struct {
 	Extra        byte        `json:"extra"`        // 预留一个bit位的保留字段
 }
 
+// readPhoneNumber 读取 n 字节的 BCD 手机号，与当前手机号相同时复用该字符串，避免 DecodeInto 时的内存分配
+func (h *MsgHeader) readPhoneNumber(reader *Reader, n int) error {
+	data, err := reader.Read(n)
+	if err != nil {
+		return err
+	}
+	var buf [20]byte
+	digits := buf[:0]
+	for _, b := range data {
+		digits = append(digits, b>>4+'0', b&0x0F+'0')
+	}
+	digits = bytes.TrimLeft(digits, "0") // 同 BcdToString，去除前置 0
+	if string(digits) != h.PhoneNumber {
+		h.PhoneNumber = string(digits)
+	}
+	return nil
+}
+
 func (p *Property) Decode(bitNum uint16) error {
 	p.BodyLength = bitNum & bodyLengthBit // 消息体长度 低 10 位
 
@@ -0,0 +1,385 @@
+package jtt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RawMsg 未解析的原始消息体，用于承载分包消息的单包数据或无法识别的消息体
+type RawMsg struct {
+	ID   MsgID  `json:"msgID"`
+	Data []byte `json:"data"`
+}
+
+func (entity *RawMsg) MsgID() MsgID { return entity.ID }
+
+func (entity *RawMsg) Encode() ([]byte, error) { return entity.Data, nil }
+
+func (entity *RawMsg) Decode(data []byte) (int, error) {
+	entity.Data = data
+	return len(data), nil
+}
+
+// Encode 将消息包编码为完整的数据帧（标识位 + 转义后的消息头、消息体及校验码 + 标识位）
+//
+//	编码前会根据消息体自动填充 MsgHeader.MsgID、Property.BodyLength 以及分包标识。
+func (m *Message) Encode() ([]byte, error) {
+	return m.encode(nil)
+}
+
+func (m *Message) encode(cipher *rsaCipher) ([]byte, error) {
+	if m.Header == nil {
+		return nil, fmt.Errorf("encode message: %w (nil header)", ErrInvalidHeader)
+	}
+
+	var body []byte
+	if m.Body != nil {
+		var err error
+		if body, err = encodeBody(m.Header, m.Body); err != nil {
+			return nil, err
+		}
+		m.Header.MsgID = m.Body.MsgID()
+	}
+
+	if m.Header.Property == nil {
+		m.Header.Property = &Property{}
+	}
+	if cipher != nil {
+		var err error
+		if body, err = cipher.encrypt(m.Header, body); err != nil {
+			return nil, err
+		}
+	}
+	if len(body) > int(bodyLengthBit) {
+		return nil, fmt.Errorf("encode message %s: %w (%d bytes)", m.Header.MsgID, ErrBodyTooLong, len(body))
+	}
+	m.Header.Property.BodyLength = uint16(len(body))
+	if m.Header.SegmentInfo != nil {
+		m.Header.Property.Segmentation = 1
+	} else {
+		m.Header.Property.Segmentation = 0
+	}
+
+	header, err := m.Header.Encode()
+	if err != nil {
+		return nil, fmt.Errorf("encode header: %w", err)
+	}
+
+	payload := make([]byte, 0, len(header)+len(body)+1)
+	payload = append(payload, header...)
+	payload = append(payload, body...)
+	payload = append(payload, Checksum(payload))
+	return Escape(payload), nil
+}
+
+// EncodeSegments 将消息包按 maxBodyLen 分包并逐包编码为完整的数据帧，按包序号顺序返回
+//
+//	maxBodyLen 为单包消息体最大长度，<=0 时取协议上限 1023；消息体不超过该长度时不分包，仅返回一帧。
+//	每一包的流水号依次由 nextSerial 生成，nextSerial 为 nil 时从 MsgHeader.SerialNumber 开始依次递增；
+//	编码完成后 MsgHeader.SerialNumber 为第一包的流水号，即补传分包请求（0x8003）中的原始消息流水号。
+func (m *Message) EncodeSegments(maxBodyLen int, nextSerial func() uint16) ([][]byte, error) {
+	return m.encodeSegments(maxBodyLen, nextSerial, nil)
+}
+
+func (m *Message) encodeSegments(maxBodyLen int, nextSerial func() uint16, cipher *rsaCipher) ([][]byte, error) {
+	if m.Header == nil {
+		return nil, fmt.Errorf("encode message: %w (nil header)", ErrInvalidHeader)
+	}
+	if maxBodyLen <= 0 {
+		maxBodyLen = int(bodyLengthBit)
+	}
+	if maxBodyLen > int(bodyLengthBit) {
+		return nil, fmt.Errorf("encode segments: %w (max body length %d, limit %d)", ErrBodyTooLong, maxBodyLen, bodyLengthBit)
+	}
+
+	msgID := m.Header.MsgID
+	var body []byte
+	if m.Body != nil {
+		var err error
+		if body, err = encodeBody(m.Header, m.Body); err != nil {
+			return nil, err
+		}
+		msgID = m.Body.MsgID()
+	}
+	m.Header.MsgID = msgID
+
+	limit := maxBodyLen
+	if cipher != nil {
+		// 逐包加密，按密文长度不超过 maxBodyLen 计算单包明文长度
+		if limit = cipher.plaintextLimit(m.Header, maxBodyLen); limit <= 0 {
+			return nil, fmt.Errorf("encode segments %s: %w (max body length %d less than one rsa block)", msgID, ErrBodyTooLong, maxBodyLen)
+		}
+	}
+	chunks := bytesSplit(body, limit)
+	if len(chunks) > 0xFFFF {
+		return nil, fmt.Errorf("encode segments %s: %w (%d packets)", msgID, ErrBodyTooLong, len(chunks))
+	}
+
+	serial := m.Header.SerialNumber
+	next := func(i int) uint16 {
+		if nextSerial != nil {
+			return nextSerial()
+		}
+		return serial + uint16(i)
+	}
+
+	if len(chunks) <= 1 {
+		header := m.Header.Clone()
+		header.SegmentInfo = nil
+		header.SerialNumber = next(0)
+		packet, err := (&Message{Header: header, Body: &RawMsg{ID: msgID, Data: body}}).encode(cipher)
+		if err != nil {
+			return nil, err
+		}
+		m.Header.SerialNumber = header.SerialNumber
+		return [][]byte{packet}, nil
+	}
+
+	packets := make([][]byte, 0, len(chunks))
+	for i, chunk := range chunks {
+		header := m.Header.Clone()
+		header.SerialNumber = next(i)
+		header.SegmentInfo = &SegmentInfo{Total: uint16(len(chunks)), Index: uint16(i + 1)}
+		if i == 0 {
+			serial = header.SerialNumber
+		}
+
+		packet, err := (&Message{Header: header, Body: &RawMsg{ID: msgID, Data: chunk}}).encode(cipher)
+		if err != nil {
+			return nil, fmt.Errorf("encode segment %d/%d: %w", i+1, len(chunks), err)
+		}
+		packets = append(packets, packet)
+	}
+	m.Header.SerialNumber = serial
+	return packets, nil
+}
+
+// encodeBody 编码消息体，消息体实现 VersionedMsg 时要求其协议版本与消息头一致
+func encodeBody(header *MsgHeader, body Msg) ([]byte, error) {
+	if versioned, ok := body.(VersionedMsg); ok && versioned.ProtocolVersion() != header.Version {
+		return nil, fmt.Errorf("encode body %s: %w (body %d, header %d)", body.MsgID(), ErrVersionMismatch, versioned.ProtocolVersion(), header.Version)
+	}
+	data, err := body.Encode()
+	if err != nil {
+		return nil, fmt.Errorf("encode body %s: %w", body.MsgID(), err)
+	}
+	return data, nil
+}
+
+// DecodeBody 按消息头解码消息体，消息体实现 VersionedMsg 时先将消息头中的协议版本同步至消息体
+//
+//	用于自行拼装消息体数据的场景（如分包合并），返回值同 Msg.Decode。
+func DecodeBody(header *MsgHeader, body Msg, data []byte) (int, error) {
+	if versioned, ok := body.(VersionedMsg); ok {
+		versioned.SetProtocolVersion(header.Version)
+	}
+	return body.Decode(data)
+}
+
+// DecodeOptions 解码选项
+type DecodeOptions struct {
+	// Strict 严格模式，额外校验：消息体属性中的消息体长度与实际长度一致、消息体解码后无剩余字节、
+	// 终端手机号等 BCD 字段不含大于 9 的半字节，以及消息体实现 Validator 时的字段取值（如枚举范围）。
+	// 校验失败返回 *DecodeError，仍可通过 errors.Is 判断 ErrInvalidMessage、ErrInvalidBody 等哨兵错误。
+	Strict bool
+	// Registry 按 MsgID 创建消息体的注册表，nil 时使用默认注册表
+	Registry *Registry
+	// Versions 终端协议版本注册表，非 nil 时由终端注册消息推断 2011/2013 版本并应用于该终端后续的消息，
+	// 见 VersionRegistry.Observe
+	Versions *VersionRegistry
+	// MaxDecompressedSize 数据压缩上报（0x0901）解压后的最大长度，<=0 时取 DefaultMaxDecompressedSize，见 Decompress
+	MaxDecompressedSize int
+
+	cipher *rsaCipher // 由 Codec 设置，解密设置了 RSA 加密标识的消息体
+}
+
+// Decode 按解码选项将完整的数据帧（含首尾标识位）解码为消息包
+func (opts DecodeOptions) Decode(data []byte) (*Message, error) {
+	m := &Message{}
+	if err := m.decode(data, opts, false); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DecodeInto 按解码选项将完整的数据帧解码至 m，复用规则同 Message.DecodeInto
+func (opts DecodeOptions) DecodeInto(m *Message, data []byte) error {
+	return m.decode(data, opts, true)
+}
+
+// Decode 将完整的数据帧（含首尾标识位）解码至消息包
+//
+//	若 m.Body 已设置，消息体将解码至该结构体；否则通过默认注册表按 MsgID 创建消息体。
+//	分包消息的单包数据无法独立解析，始终以 RawMsg 保存。
+//	MsgID 未注册时返回 ErrMessageNotRegistered，此时 m.Header 已填充、m.Body 为 RawMsg，便于调用方应答。
+func (m *Message) Decode(data []byte) error {
+	return m.decode(data, DecodeOptions{}, false)
+}
+
+// DecodeInto 与 Decode 相同，但复用 m 已有的消息头、消息体（MsgID 一致时）以及内部缓冲区，
+// 配合 sync.Pool 复用 Message 可减少高频消息（如 0x0200）解码时的内存分配。
+//
+//	消息体可能引用内部缓冲区（如 T808_0x0200_Extra.Data、RawMsg.Data），下一次调用 DecodeInto 后失效。
+//	MsgID 不一致时，消息体通过默认注册表重新创建。
+//	并非零分配：手机号与上一条消息不同时分配新的字符串，消息体中的 decimal.Decimal（如 0x0200 的经纬度）、
+//	BCD 时间及字符串字段每次解码仍会分配内存。
+func (m *Message) DecodeInto(data []byte) error {
+	return m.decode(data, DecodeOptions{}, true)
+}
+
+func (m *Message) decode(data []byte, opts DecodeOptions, reuse bool) error {
+	registry := opts.Registry
+	if registry == nil {
+		registry = defaultRegistry
+	}
+	if len(data) < 2 || data[0] != boundaryMark || data[len(data)-1] != boundaryMark {
+		return fmt.Errorf("decode message: %w (missing boundary mark)", ErrInvalidMessage)
+	}
+
+	var payload []byte
+	if reuse {
+		m.buf = UnescapeTo(m.buf[:0], data)
+		payload = m.buf
+	} else {
+		payload = Unescape(data)
+	}
+	if len(payload) < Message2013HeaderSize+1 {
+		return fmt.Errorf("decode message: %w (need >=%d bytes, got %d)", ErrInvalidMessage, Message2013HeaderSize+1, len(payload))
+	}
+
+	sum, payload := payload[len(payload)-1], payload[:len(payload)-1]
+	if expect := Checksum(payload); sum != expect {
+		return fmt.Errorf("decode message: %w (expect 0x%02X, got 0x%02X)", ErrInvalidCheckSum, expect, sum)
+	}
+
+	header := m.Header
+	if !reuse || header == nil {
+		header = &MsgHeader{}
+	}
+	if err := header.Decode(payload); err != nil {
+		return fmt.Errorf("decode message: %w: %w", ErrInvalidHeader, err)
+	}
+	if header.Size() > len(payload) {
+		return fmt.Errorf("decode message: %w (need >=%d bytes, got %d)", ErrInvalidHeader, header.Size(), len(payload))
+	}
+	m.Header = header
+
+	body := payload[header.Size():]
+	if opts.Versions != nil {
+		opts.Versions.Observe(header, body)
+	}
+	if opts.Strict {
+		if err := validateFrame(header, payload, body); err != nil {
+			return err
+		}
+	}
+	if opts.cipher != nil && header.Property.Encryption&EncryptionRSA != 0 {
+		plain, err := opts.cipher.decrypt(header, body)
+		if err != nil {
+			m.Body = &RawMsg{ID: header.MsgID, Data: body}
+			return fmt.Errorf("decode message: %w", err)
+		}
+		body = plain
+	}
+	if header.IsSegment() {
+		if raw, ok := m.Body.(*RawMsg); ok && reuse {
+			raw.ID, raw.Data = header.MsgID, body
+			return nil
+		}
+		m.Body = &RawMsg{ID: header.MsgID, Data: body}
+		return nil
+	}
+	if reuse && m.Body != nil && m.Body.MsgID() != header.MsgID {
+		m.Body = nil
+	}
+	if m.Body == nil {
+		msg, err := registry.New(header.MsgID)
+		if err != nil {
+			m.Body = &RawMsg{ID: header.MsgID, Data: body}
+			return fmt.Errorf("decode message: %w", err)
+		}
+		m.Body = msg
+	}
+	if m.Body.MsgID() != header.MsgID {
+		return fmt.Errorf("decode message: %w (body %s, header %s)", ErrInvalidBody, m.Body.MsgID(), header.MsgID)
+	}
+	n, err := DecodeBody(header, m.Body, body)
+	if !opts.Strict {
+		if err != nil {
+			return fmt.Errorf("decode body %s: %w", header.MsgID, err)
+		}
+		return nil
+	}
+	return validateBody(header, m.Body, body, n, err)
+}
+
+// validateFrame 严格模式下校验消息头中的 BCD 手机号以及消息体长度
+func validateFrame(header *MsgHeader, payload, body []byte) error {
+	offset, size := 4, 6
+	if header.Version == Version2019 {
+		offset, size = 5, 10
+	}
+	if i := InvalidBCD(payload[offset : offset+size]); i >= 0 {
+		return &DecodeError{
+			MsgID:  header.MsgID,
+			Field:  "header.phoneNumber",
+			Offset: offset + i,
+			Err:    fmt.Errorf("%w: %w (0x%02X)", ErrInvalidHeader, ErrInvalidBCD, payload[offset+i]),
+		}
+	}
+	if int(header.Property.BodyLength) != len(body) {
+		return &DecodeError{
+			MsgID:  header.MsgID,
+			Field:  "header.property.bodyLength",
+			Offset: 2,
+			Err:    fmt.Errorf("%w (body length %d, actual %d)", ErrInvalidMessage, header.Property.BodyLength, len(body)),
+		}
+	}
+	return nil
+}
+
+// validateBody 严格模式下校验消息体解码结果：解码错误、剩余字节以及 Validator 定义的字段取值
+func validateBody(header *MsgHeader, msg Msg, body []byte, n int, err error) error {
+	if err != nil {
+		if !errors.Is(err, ErrInvalidBody) {
+			err = fmt.Errorf("%w: %w", ErrInvalidBody, err)
+		}
+		return bodyError(header, err)
+	}
+	if n != len(body) {
+		return &DecodeError{
+			MsgID:  header.MsgID,
+			Field:  "body",
+			Offset: header.Size() + min(max(n, 0), len(body)),
+			Err:    fmt.Errorf("%w (decoded %d of %d bytes)", ErrInvalidBody, n, len(body)),
+		}
+	}
+	if validator, ok := msg.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return bodyError(header, err)
+		}
+	}
+	return nil
+}
+
+// bodyError 将消息体返回的错误转换为 *DecodeError，字段路径与偏移换算为相对数据帧
+func bodyError(header *MsgHeader, err error) error {
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		return &DecodeError{MsgID: header.MsgID, Field: "body", Offset: header.Size(), Err: err}
+	}
+	decodeErr.MsgID = header.MsgID
+	decodeErr.Field = "body." + decodeErr.Field
+	decodeErr.Offset += header.Size()
+	return err
+}
+
+// DecodeMessage 将完整的数据帧（含首尾标识位）解码为消息包，消息体类型由默认注册表确定
+func DecodeMessage(data []byte) (*Message, error) {
+	return defaultRegistry.Decode(data)
+}
+
+// Decode 将完整的数据帧（含首尾标识位）解码为消息包，消息体类型由该注册表确定
+func (r *Registry) Decode(data []byte) (*Message, error) {
+	return DecodeOptions{Registry: r}.Decode(data)
+}
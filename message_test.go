@@ -0,0 +1,375 @@
+package jtt
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestMessage_EncodeDecode_RoundTrip(t *testing.T) {
+	versions := []VersionType{Version2013, Version2019}
+	for _, ver := range versions {
+		msg := &Message{
+			Header: &MsgHeader{
+				PhoneNumber:  "13800138000",
+				SerialNumber: 0x7E7D,
+				Version:      ver,
+			},
+			Body: &T808_0x0001{ReplyMsgSerialNo: 0x7E7E, ReplyMsgID: MsgT808_0x8103, Result: 0},
+		}
+		data, err := msg.Encode()
+		if err != nil {
+			t.Fatalf("encode(%d): %v", ver, err)
+		}
+		if data[0] != 0x7e || data[len(data)-1] != 0x7e {
+			t.Fatalf("encode(%d): missing boundary mark: % X", ver, data)
+		}
+		if bytes.IndexByte(data[1:len(data)-1], 0x7e) >= 0 {
+			t.Fatalf("encode(%d): unescaped 0x7e in frame: % X", ver, data)
+		}
+		if msg.Header.Property.BodyLength != 5 {
+			t.Fatalf("encode(%d): expect body length 5, got %d", ver, msg.Header.Property.BodyLength)
+		}
+
+		got := &Message{Body: &T808_0x0001{}}
+		if err := got.Decode(data); err != nil {
+			t.Fatalf("decode(%d): %v", ver, err)
+		}
+		if got.Header.MsgID != MsgT808_0x0001 || got.Header.PhoneNumber != "13800138000" ||
+			got.Header.SerialNumber != 0x7E7D || got.Header.Version != ver {
+			t.Fatalf("decode(%d): unexpected header %+v", ver, got.Header)
+		}
+		body := got.Body.(*T808_0x0001)
+		if body.ReplyMsgSerialNo != 0x7E7E || body.ReplyMsgID != MsgT808_0x8103 {
+			t.Fatalf("decode(%d): unexpected body %+v", ver, body)
+		}
+	}
+}
+
+func TestMessage_DecodeInto_Reuse(t *testing.T) {
+	encode := func(body Msg, serial uint16) []byte {
+		data, err := (&Message{Header: &MsgHeader{PhoneNumber: "13800138000", SerialNumber: serial}, Body: body}).Encode()
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		return data
+	}
+	extra := T808_0x0200_Extra{}
+	extra.SetMileage(100)
+
+	m := &Message{Body: &T808_0x0200{}}
+	body := m.Body
+	if err := m.DecodeInto(encode(&T808_0x0200{Speed: 10, Extras: []T808_0x0200_Extra{extra}}, 1)); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if m.Body != body || len(m.Body.(*T808_0x0200).Extras) != 1 {
+		t.Fatalf("expect body to be reused, got %#v", m.Body)
+	}
+
+	if err := m.DecodeInto(encode(&T808_0x0200{Speed: 20}, 2)); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got := m.Body.(*T808_0x0200); got.Speed != 20 || len(got.Extras) != 0 || m.Header.SerialNumber != 2 {
+		t.Fatalf("expect body to be overwritten, got %+v", got)
+	}
+
+	if err := m.DecodeInto(encode(&T808_0x0002{}, 3)); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if _, ok := m.Body.(*T808_0x0002); !ok {
+		t.Fatalf("expect body to be replaced on MsgID change, got %T", m.Body)
+	}
+}
+
+func TestMessage_DecodeInto_Allocs(t *testing.T) {
+	data := benchmarkFrame0x0200(t)
+	m := &Message{Body: &T808_0x0200{}}
+	if err := m.DecodeInto(data); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	location := m.Body.(*T808_0x0200)
+	header, property, extras := m.Header, m.Header.Property, &location.Extras[0]
+
+	// only the coordinates and the time remain allocated, see DecodeInto
+	bcdTime := ToBCDTime(location.Time)
+	want := testing.AllocsPerRun(100, func() {
+		_, _ = GetGeoPointForWGS84(39909257, false, 116397153, false)
+		_, _ = FromBCDTime(bcdTime)
+	})
+	got := testing.AllocsPerRun(100, func() {
+		if err := m.DecodeInto(data); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	})
+	if got > want {
+		t.Errorf("DecodeInto allocates %v times, want %v", got, want)
+	}
+	if m.Header != header || m.Header.Property != property || &m.Body.(*T808_0x0200).Extras[0] != extras {
+		t.Error("expect header, property and extras to be reused")
+	}
+}
+
+func TestMessage_Decode_Errors(t *testing.T) {
+	msg := &Message{
+		Header: &MsgHeader{PhoneNumber: "13800138000", SerialNumber: 1},
+		Body:   &T808_0x0002{},
+	}
+	data, err := msg.Encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	broken := append([]byte(nil), data...)
+	broken[len(broken)-2] ^= 0xFF
+	if _, err := DecodeMessage(broken); !errors.Is(err, ErrInvalidCheckSum) {
+		t.Fatalf("expect ErrInvalidCheckSum, got %v", err)
+	}
+
+	if _, err := DecodeMessage(data[1:]); !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expect ErrInvalidMessage, got %v", err)
+	}
+
+	if _, err := DecodeMessage([]byte{0x7e, 0x00, 0x02, 0x00, 0x02, 0x7e}); !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expect ErrInvalidMessage for short frame, got %v", err)
+	}
+}
+
+func TestDecodeOptions_Strict(t *testing.T) {
+	encode := func(body Msg) []byte {
+		data, err := (&Message{Header: &MsgHeader{PhoneNumber: "13800138000", SerialNumber: 1}, Body: body}).Encode()
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		return data
+	}
+	// tamper 修改转义还原后的数据帧并重新计算校验码
+	tamper := func(data []byte, fn func(payload []byte)) []byte {
+		payload := Unescape(data)
+		payload = payload[:len(payload)-1]
+		fn(payload)
+		return Escape(append(payload, Checksum(payload)))
+	}
+	strict := DecodeOptions{Strict: true}
+
+	tests := []struct {
+		name   string
+		data   []byte
+		target error
+		field  string
+		offset int
+	}{
+		{
+			name:   "trailing bytes",
+			data:   encode(&RawMsg{ID: MsgT808_0x0001, Data: []byte{0x00, 0x01, 0x01, 0x02, 0x00, 0xFF}}),
+			target: ErrInvalidBody,
+			field:  "body",
+			offset: Message2013HeaderSize + 5,
+		},
+		{
+			name:   "body length mismatch",
+			data:   tamper(encode(&T808_0x0002{}), func(payload []byte) { payload[3] = 0x02 }),
+			target: ErrInvalidMessage,
+			field:  "header.property.bodyLength",
+			offset: 2,
+		},
+		{
+			name:   "invalid bcd phone number",
+			data:   tamper(encode(&T808_0x0002{}), func(payload []byte) { payload[5] = 0x3A }),
+			target: ErrInvalidBCD,
+			field:  "header.phoneNumber",
+			offset: 5,
+		},
+		{
+			name:   "enum out of range",
+			data:   encode(&T808_0x0001{ReplyMsgSerialNo: 1, ReplyMsgID: MsgT808_0x0200, Result: 9}),
+			target: ErrInvalidEnum,
+			field:  "body.result",
+			offset: Message2013HeaderSize + 4,
+		},
+		{
+			name: "nested enum out of range",
+			data: encode(&T1078_0x1205{MediaList: []DeviceMedia{
+				{DeviceMediaQuery: DeviceMediaQuery{LogicChannelID: 1}},
+				{DeviceMediaQuery: DeviceMediaQuery{LogicChannelID: 2, StreamType: 7}},
+			}}),
+			target: ErrInvalidEnum,
+			field:  "body.mediaList[1].streamType",
+			offset: Message2013HeaderSize + 6 + deviceMediaSize + 22,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeMessage(tt.data); err != nil {
+				t.Fatalf("expect lenient decode to succeed, got %v", err)
+			}
+
+			_, err := strict.Decode(tt.data)
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("expect *DecodeError, got %v", err)
+			}
+			if !errors.Is(err, tt.target) {
+				t.Errorf("expect %v, got %v", tt.target, err)
+			}
+			if decodeErr.Field != tt.field || decodeErr.Offset != tt.offset {
+				t.Errorf("expect field %s at %d, got %s at %d", tt.field, tt.offset, decodeErr.Field, decodeErr.Offset)
+			}
+		})
+	}
+
+	media := &T1078_0x1205{ReplyMsgSerialNo: 3, MediaList: []DeviceMedia{
+		{DeviceMediaQuery: DeviceMediaQuery{LogicChannelID: 1, MediaType: 2, StreamType: 1, StorageType: 1}, Size: 1024},
+	}}
+	m, err := strict.Decode(encode(media))
+	if err != nil {
+		t.Fatalf("strict decode: %v", err)
+	}
+	if got := m.Body.(*T1078_0x1205); got.MediaCount != 1 || got.MediaList[0].Size != 1024 || got.MediaList[0].MediaType != 2 {
+		t.Fatalf("unexpected body %+v", got)
+	}
+}
+
+func TestMessage_VersionedMsg(t *testing.T) {
+	route := &T808_0x8606{RouteID: 1, RouteName: "route-2019"}
+	route.SetProtocolVersion(Version2019)
+
+	header := &MsgHeader{Version: Version2013, PhoneNumber: "13800138000"}
+	if _, err := (&Message{Header: header, Body: route}).Encode(); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("expect ErrVersionMismatch, got %v", err)
+	}
+
+	header.Version, header.ProtocolVersion = Version2019, 1
+	data, err := (&Message{Header: header, Body: route}).Encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	m, err := DecodeMessage(data)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	got := m.Body.(*T808_0x8606)
+	if got.ProtocolVersion() != Version2019 || got.RouteName != "route-2019" {
+		t.Fatalf("expect version propagated from header, got version %d name %q", got.ProtocolVersion(), got.RouteName)
+	}
+}
+
+func TestMessage_Encode_BodyTooLong(t *testing.T) {
+	msg := &Message{
+		Header: &MsgHeader{PhoneNumber: "13800138000"},
+		Body:   &T808_0x0900{TransparentMsgType: 0x41, TransparentMsgContent: make([]byte, 1024)},
+	}
+	if _, err := msg.Encode(); !errors.Is(err, ErrBodyTooLong) {
+		t.Fatalf("expect ErrBodyTooLong, got %v", err)
+	}
+}
+
+func TestMessage_EncodeSegments(t *testing.T) {
+	content := make([]byte, 2500)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	msg := &Message{
+		Header: &MsgHeader{PhoneNumber: "13800138000", Version: Version2019, ProtocolVersion: 1},
+		Body:   &T808_0x0900{TransparentMsgType: 0x41, TransparentMsgContent: content},
+	}
+
+	serial := uint16(0xFFFE)
+	packets, err := msg.EncodeSegments(1000, func() uint16 {
+		serial++
+		return serial
+	})
+	if err != nil {
+		t.Fatalf("encode segments: %v", err)
+	}
+	if len(packets) != 3 {
+		t.Fatalf("expect 3 packets, got %d", len(packets))
+	}
+	if msg.Header.SerialNumber != 0xFFFF {
+		t.Fatalf("expect first serial 0xFFFF, got %d", msg.Header.SerialNumber)
+	}
+
+	var body []byte
+	for i, packet := range packets {
+		m, err := DecodeMessage(packet)
+		if err != nil {
+			t.Fatalf("decode packet %d: %v", i+1, err)
+		}
+		if !m.Header.IsSegment() || m.Header.SegmentInfo.Total != 3 || m.Header.SegmentInfo.Index != uint16(i+1) {
+			t.Fatalf("packet %d: unexpected segment info %+v", i+1, m.Header.SegmentInfo)
+		}
+		if want := uint16(0xFFFF) + uint16(i); m.Header.SerialNumber != want {
+			t.Fatalf("packet %d: expect serial %d, got %d", i+1, want, m.Header.SerialNumber)
+		}
+		if m.Header.MsgID != MsgT808_0x0900 || int(m.Header.Property.BodyLength) > 1000 {
+			t.Fatalf("packet %d: unexpected header %+v", i+1, m.Header)
+		}
+		body = append(body, m.Body.(*RawMsg).Data...)
+	}
+
+	var got T808_0x0900
+	if _, err := got.Decode(body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if got.TransparentMsgType != 0x41 || !bytes.Equal(got.TransparentMsgContent, content) {
+		t.Fatalf("reassembled body mismatch")
+	}
+
+	packets, err = (&Message{Header: &MsgHeader{PhoneNumber: "13800138000", SerialNumber: 5}, Body: &T808_0x0002{}}).EncodeSegments(0, nil)
+	if err != nil || len(packets) != 1 {
+		t.Fatalf("expect single packet, got %d (%v)", len(packets), err)
+	}
+	if m, err := DecodeMessage(packets[0]); err != nil || m.Header.IsSegment() || m.Header.SerialNumber != 5 {
+		t.Fatalf("unexpected single packet %+v (%v)", m, err)
+	}
+}
+
+func benchmarkFrame0x0200(b testing.TB) []byte {
+	b.Helper()
+	location := &T808_0x0200{
+		Lat:       decimal.NewFromFloat(39.909257),
+		Lng:       decimal.NewFromFloat(116.397153),
+		Altitude:  52,
+		Speed:     600,
+		Direction: 90,
+		Time:      time.Date(2024, 5, 1, 8, 30, 0, 0, time.Local),
+	}
+	mileage, satellite := T808_0x0200_Extra{}, T808_0x0200_Extra{}
+	mileage.SetMileage(123456)
+	satellite.SetSatelliteCount(12)
+	location.Extras = []T808_0x0200_Extra{mileage, satellite}
+
+	data, err := (&Message{Header: &MsgHeader{PhoneNumber: "13800138000", SerialNumber: 1}, Body: location}).Encode()
+	if err != nil {
+		b.Fatalf("encode: %v", err)
+	}
+	return data
+}
+
+func BenchmarkDecodeMessage_0x0200(b *testing.B) {
+	data := benchmarkFrame0x0200(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeMessage(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMessage_DecodeInto_0x0200(b *testing.B) {
+	data := benchmarkFrame0x0200(b)
+	pool := sync.Pool{New: func() any { return &Message{Body: &T808_0x0200{}} }}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m := pool.Get().(*Message)
+		if err := m.DecodeInto(data); err != nil {
+			b.Fatal(err)
+		}
+		pool.Put(m)
+	}
+}
@@ -0,0 +1,242 @@
+package metrics
+
+import (
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/ryan961/jtt"
+	"github.com/ryan961/jtt/segment"
+	"github.com/ryan961/jtt/server"
+)
+
+// Metrics collects the metrics of the codec, the segment pool and the server sessions:
+//
+//   - jtt_frames_discarded_total{reason}: data discarded while splitting frames, see jtt.DiscardReason.
+//   - jtt_frames_discarded_bytes_total: bytes discarded while splitting frames.
+//   - jtt_checksum_errors_total: frames with a bad checksum, discarded or failing to decode.
+//   - jtt_decode_errors_total{reason}: frames that can't be decoded, by codec error.
+//   - jtt_segment_evictions_total{cause}: incomplete segmented messages dropped by the pool.
+//   - jtt_segment_cache_size: segmented messages being received.
+//   - jtt_sessions_open: open sessions.
+//   - jtt_terminals_online{version}: sessions bound to a terminal, by protocol version.
+//   - jtt_terminals_authenticated: authenticated terminals.
+//   - jtt_requests_in_flight: messages sent to terminals waiting for their reply.
+//   - jtt_session_events_total{type}: session lifecycle events, see server.EventType.
+//
+// The gauges are computed on collection from the servers passed to Instrument.
+// Metrics is a Collector, it's safe for concurrent use.
+type Metrics struct {
+	framesDiscarded  *CounterVec
+	discardedBytes   *Counter
+	checksumErrors   *Counter
+	decodeErrors     *CounterVec
+	segmentEvictions *CounterVec
+	sessionEvents    *CounterVec
+	gauges           []*GaugeFunc
+
+	mu      sync.Mutex
+	servers []*server.Server
+}
+
+// New creates the metrics, see Metrics.
+func New() *Metrics {
+	m := &Metrics{
+		framesDiscarded: NewCounterVec("jtt_frames_discarded_total",
+			"Data discarded while splitting frames.", "reason"),
+		discardedBytes: NewCounter("jtt_frames_discarded_bytes_total",
+			"Bytes discarded while splitting frames."),
+		checksumErrors: NewCounter("jtt_checksum_errors_total",
+			"Frames with a bad checksum."),
+		decodeErrors: NewCounterVec("jtt_decode_errors_total",
+			"Frames that can't be decoded.", "reason"),
+		segmentEvictions: NewCounterVec("jtt_segment_evictions_total",
+			"Incomplete segmented messages dropped by the segment pool.", "cause"),
+		sessionEvents: NewCounterVec("jtt_session_events_total",
+			"Session lifecycle events.", "type"),
+	}
+	m.gauges = []*GaugeFunc{
+		NewGaugeFunc("jtt_segment_cache_size", "Segmented messages being received.", m.segmentCacheSize),
+		NewGaugeFunc("jtt_sessions_open", "Open sessions.", func() float64 {
+			return float64(len(m.sessions()))
+		}),
+		NewGaugeVecFunc("jtt_terminals_online", "Sessions bound to a terminal by protocol version.", "version",
+			m.onlineByVersion),
+		NewGaugeFunc("jtt_terminals_authenticated", "Authenticated terminals.", m.authenticated),
+		NewGaugeFunc("jtt_requests_in_flight", "Messages sent to terminals waiting for their reply.", m.inFlight),
+	}
+	return m
+}
+
+// ObserveDiscard counts data discarded by a jtt.FrameScanner, it's a handler for jtt.WithDiscardReasonHandler.
+func (m *Metrics) ObserveDiscard(reason jtt.DiscardReason, data []byte) {
+	m.framesDiscarded.With(reason.String()).Inc()
+	m.discardedBytes.Add(float64(len(data)))
+	if reason == jtt.DiscardChecksum {
+		m.checksumErrors.Inc()
+	}
+}
+
+// ObserveDecodeError counts a frame that can't be decoded, e.g. the error of jtt.Codec.Decode.
+// Messages without a registered body type aren't counted.
+func (m *Metrics) ObserveDecodeError(err error) {
+	if err == nil || errors.Is(err, jtt.ErrMessageNotRegistered) {
+		return
+	}
+	reason := DecodeErrorReason(err)
+	m.decodeErrors.With(reason).Inc()
+	if reason == "checksum" {
+		m.checksumErrors.Inc()
+	}
+}
+
+// ObserveEviction counts an incomplete segmented message dropped by the pool,
+// it's a handler for segment.WithEvictionHandler.
+func (m *Metrics) ObserveEviction(_ segment.Pending, cause segment.EvictionCause) {
+	m.segmentEvictions.With(cause.String()).Inc()
+}
+
+// ServerOptions returns the options hooking the frame splitter and the decoder of a server to the metrics.
+// The evictions of the server's segment pool are only counted for a pool created with
+// segment.WithEvictionHandler(m.ObserveEviction), see server.WithSegmentPool.
+func (m *Metrics) ServerOptions() []server.Option {
+	return []server.Option{
+		server.WithDiscardHandler(func(_ *server.Session, reason jtt.DiscardReason, data []byte) {
+			m.ObserveDiscard(reason, data)
+		}),
+		server.WithDecodeErrorHandler(func(_ *server.Session, _ []byte, err error) {
+			m.ObserveDecodeError(err)
+		}),
+	}
+}
+
+// Instrument adds the sessions and the segment pool of the server to the gauges and counts its session
+// lifecycle events. The returned function removes the server.
+func (m *Metrics) Instrument(srv *server.Server) (cancel func()) {
+	unsubscribe := srv.Subscribe(func(e server.Event) {
+		m.sessionEvents.With(e.Type.String()).Inc()
+	})
+	m.mu.Lock()
+	m.servers = append(m.servers, srv)
+	m.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			unsubscribe()
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if i := slices.Index(m.servers, srv); i >= 0 {
+				m.servers = slices.Delete(m.servers, i, i+1)
+			}
+		})
+	}
+}
+
+func (m *Metrics) Describe() []string {
+	var names []string
+	for _, c := range m.collectors() {
+		names = append(names, c.Describe()...)
+	}
+	return names
+}
+
+func (m *Metrics) Collect() []Family {
+	var families []Family
+	for _, c := range m.collectors() {
+		families = append(families, c.Collect()...)
+	}
+	return families
+}
+
+func (m *Metrics) collectors() []Collector {
+	collectors := []Collector{
+		m.framesDiscarded, m.discardedBytes, m.checksumErrors, m.decodeErrors, m.segmentEvictions, m.sessionEvents,
+	}
+	for _, g := range m.gauges {
+		collectors = append(collectors, g)
+	}
+	return collectors
+}
+
+func (m *Metrics) instrumented() []*server.Server {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.servers)
+}
+
+func (m *Metrics) sessions() []*server.Session {
+	var sessions []*server.Session
+	for _, srv := range m.instrumented() {
+		sessions = append(sessions, srv.Sessions()...)
+	}
+	return sessions
+}
+
+func (m *Metrics) segmentCacheSize() float64 {
+	var size int
+	// servers may share a pool
+	var pools []*segment.Pool
+	for _, srv := range m.instrumented() {
+		if pool := srv.Segments(); !slices.Contains(pools, pool) {
+			pools = append(pools, pool)
+			size += pool.Len()
+		}
+	}
+	return float64(size)
+}
+
+func (m *Metrics) onlineByVersion() map[string]float64 {
+	online := map[string]float64{"2011": 0, "2013": 0, "2019": 0}
+	for _, session := range m.sessions() {
+		if session.PhoneNumber() != "" {
+			online[session.Version().String()]++
+		}
+	}
+	return online
+}
+
+func (m *Metrics) authenticated() float64 {
+	var n int
+	for _, session := range m.sessions() {
+		if session.Authenticated() {
+			n++
+		}
+	}
+	return float64(n)
+}
+
+func (m *Metrics) inFlight() float64 {
+	var n int
+	for _, session := range m.sessions() {
+		n += session.InFlight()
+	}
+	return float64(n)
+}
+
+// DecodeErrorReason classifies a codec error into the reason label of jtt_decode_errors_total.
+func DecodeErrorReason(err error) string {
+	reasons := []struct {
+		err    error
+		reason string
+	}{
+		{jtt.ErrInvalidCheckSum, "checksum"},
+		{jtt.ErrInvalidHeader, "header"},
+		{jtt.ErrVersionMismatch, "version"},
+		{jtt.ErrInvalidBCD, "bcd"},
+		{jtt.ErrInvalidEnum, "enum"},
+		{jtt.ErrInvalidExtraLength, "extra_length"},
+		{jtt.ErrBodyTooLong, "body_too_long"},
+		{jtt.ErrDecompressedTooLarge, "decompress"},
+		{jtt.ErrKeyNotFound, "key_not_found"},
+		{jtt.ErrEntityDecode, "entity"},
+		{jtt.ErrInvalidBody, "body"},
+		{jtt.ErrInvalidMessage, "message"},
+	}
+	for _, r := range reasons {
+		if errors.Is(err, r.err) {
+			return r.reason
+		}
+	}
+	return "other"
+}
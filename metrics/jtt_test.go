@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryan961/jtt"
+	"github.com/ryan961/jtt/segment"
+	"github.com/ryan961/jtt/server"
+)
+
+// scrape returns the text exposition of the metrics.
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	registry := NewRegistry()
+	registry.MustRegister(m)
+	var b strings.Builder
+	if err := registry.WriteText(&b); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	return b.String()
+}
+
+// waitSample waits until the exposition contains the sample line.
+func waitSample(t *testing.T, m *Metrics, sample string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		text := scrape(t, m)
+		if strings.Contains(text, "\n"+sample+"\n") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sample %q not found in:\n%s", sample, text)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMetrics_Codec(t *testing.T) {
+	m := New()
+	frame, err := (&jtt.Message{Header: &jtt.MsgHeader{PhoneNumber: "13812345678"}, Body: &jtt.T808_0x0002{}}).Encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	frame[len(frame)-2] ^= 0x01
+
+	stream := append([]byte{0x01, 0x02}, frame...)
+	scanner := jtt.NewFrameScanner(strings.NewReader(string(stream)), jtt.WithDiscardReasonHandler(m.ObserveDiscard))
+	for scanner.Scan() {
+		t.Errorf("unexpected frame % X", scanner.Frame())
+	}
+	m.ObserveDecodeError(fmt.Errorf("decode body: %w", jtt.ErrInvalidBody))
+	m.ObserveDecodeError(jtt.ErrMessageNotRegistered) // not an error
+
+	text := scrape(t, m)
+	for _, sample := range []string{
+		`jtt_frames_discarded_total{reason="checksum"} 1`,
+		`jtt_frames_discarded_total{reason="garbage"} 1`,
+		fmt.Sprintf("jtt_frames_discarded_bytes_total %d", len(stream)),
+		`jtt_checksum_errors_total 1`,
+		`jtt_decode_errors_total{reason="body"} 1`,
+	} {
+		if !strings.Contains(text, "\n"+sample+"\n") {
+			t.Errorf("sample %q not found in:\n%s", sample, text)
+		}
+	}
+	if strings.Contains(text, "not_registered") || strings.Contains(text, `reason="other"`) {
+		t.Errorf("unexpected decode error reason in:\n%s", text)
+	}
+}
+
+func TestMetrics_Server(t *testing.T) {
+	m := New()
+	pool := segment.NewPool(segment.WithEvictionHandler(m.ObserveEviction), segment.WithVariableTTL(50*time.Millisecond))
+	defer pool.Close()
+	srv := server.New(server.NewRouter(), append(m.ServerOptions(), server.WithSegmentPool(pool))...)
+	cancel := m.Instrument(srv)
+	defer cancel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = srv.Serve(ln) }()
+	defer srv.Close()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	write := func(header *jtt.MsgHeader, body jtt.Msg) []byte {
+		t.Helper()
+		data, err := (&jtt.Message{Header: header, Body: body}).Encode()
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		if _, err := conn.Write(data); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		return data
+	}
+	header := &jtt.MsgHeader{PhoneNumber: "13812345678", Version: jtt.Version2019, ProtocolVersion: 1}
+	write(header, &jtt.T808_0x0002{})
+	waitSample(t, m, `jtt_terminals_online{version="2019"} 1`)
+	waitSample(t, m, `jtt_session_events_total{type="online"} 1`)
+	waitSample(t, m, `jtt_sessions_open 1`)
+
+	// the first packet of a segmented message left incomplete
+	segmented := *header
+	segmented.SegmentInfo = &jtt.SegmentInfo{Total: 2, Index: 1}
+	write(&segmented, &jtt.RawMsg{ID: jtt.MsgT808_0x0801, Data: []byte{0x01}})
+	waitSample(t, m, `jtt_segment_cache_size 1`)
+
+	// a general reply too short for its body
+	write(header, &jtt.RawMsg{ID: jtt.MsgT808_0x0001, Data: []byte{0x01, 0x02}})
+	waitSample(t, m, `jtt_decode_errors_total{reason="body"} 1`)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !strings.Contains(scrape(t, m), `jtt_segment_evictions_total{cause="expired"} 1`) {
+		if time.Now().After(deadline) {
+			t.Fatalf("segment eviction not counted:\n%s", scrape(t, m))
+		}
+		pool.Pending() // expired entries are evicted during maintenance
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	_ = conn.Close()
+	waitSample(t, m, `jtt_session_events_total{type="offline"} 1`)
+	waitSample(t, m, `jtt_terminals_online{version="2019"} 0`)
+}
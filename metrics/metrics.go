@@ -0,0 +1,379 @@
+// Package metrics exposes counters and gauges of the codec, the segment pool and the server in the Prometheus
+// text exposition format, without external dependencies.
+//
+// A Registry gathers the metric families of its collectors and serves them over HTTP:
+//
+//	m := metrics.New()
+//	pool := segment.NewPool(segment.WithEvictionHandler(m.ObserveEviction))
+//	srv := server.New(router, append(m.ServerOptions(), server.WithSegmentPool(pool))...)
+//	cancel := m.Instrument(srv)
+//	defer cancel()
+//
+//	registry := metrics.NewRegistry()
+//	registry.MustRegister(m)
+//	http.Handle("/metrics", registry)
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrDuplicateMetric is returned when registering a collector with a metric name already registered.
+var ErrDuplicateMetric = errors.New("duplicate metric")
+
+// Type is the type of a metric family.
+type Type string
+
+const (
+	TypeCounter Type = "counter"
+	TypeGauge   Type = "gauge"
+)
+
+// Label is a label of a sample.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a value of a metric family with its labels.
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// Family is a metric with its samples, one per combination of label values.
+type Family struct {
+	Name    string
+	Help    string
+	Type    Type
+	Samples []Sample
+}
+
+// Collector collects metric families. Collect is called on each scrape and must be safe for concurrent use.
+type Collector interface {
+	// Describe returns the names of the families collected, used to reject duplicates on registration.
+	Describe() []string
+	// Collect returns the current value of the families.
+	Collect() []Family
+}
+
+// Registry gathers the metric families of its collectors. It's safe for concurrent use.
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []Collector
+	names      map[string]struct{}
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]struct{})}
+}
+
+// Register adds the collector to the registry, it fails with ErrDuplicateMetric if one of its
+// families is already registered.
+func (r *Registry) Register(c Collector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := c.Describe()
+	for _, name := range names {
+		if _, ok := r.names[name]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateMetric, name)
+		}
+	}
+	for _, name := range names {
+		r.names[name] = struct{}{}
+	}
+	r.collectors = append(r.collectors, c)
+	return nil
+}
+
+// MustRegister is like Register but panics on error.
+func (r *Registry) MustRegister(collectors ...Collector) {
+	for _, c := range collectors {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Gather collects the families of all collectors sorted by name.
+func (r *Registry) Gather() []Family {
+	r.mu.RLock()
+	collectors := slices.Clone(r.collectors)
+	r.mu.RUnlock()
+
+	var families []Family
+	for _, c := range collectors {
+		families = append(families, c.Collect()...)
+	}
+	slices.SortStableFunc(families, func(a, b Family) int { return strings.Compare(a.Name, b.Name) })
+	return families
+}
+
+// WriteText writes the gathered families in the Prometheus text exposition format (version 0.0.4).
+func (r *Registry) WriteText(w io.Writer) error {
+	return WriteText(w, r.Gather())
+}
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// ServeHTTP serves the gathered families in the Prometheus text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_ = r.WriteText(w)
+}
+
+// WriteText writes the families in the Prometheus text exposition format (version 0.0.4).
+func WriteText(w io.Writer, families []Family) error {
+	var b strings.Builder
+	for _, f := range families {
+		if f.Help != "" {
+			b.WriteString("# HELP ")
+			b.WriteString(f.Name)
+			b.WriteByte(' ')
+			b.WriteString(escapeHelp(f.Help))
+			b.WriteByte('\n')
+		}
+		b.WriteString("# TYPE ")
+		b.WriteString(f.Name)
+		b.WriteByte(' ')
+		b.WriteString(string(f.Type))
+		b.WriteByte('\n')
+		for _, s := range f.Samples {
+			b.WriteString(f.Name)
+			if len(s.Labels) > 0 {
+				b.WriteByte('{')
+				for i, l := range s.Labels {
+					if i > 0 {
+						b.WriteByte(',')
+					}
+					b.WriteString(l.Name)
+					b.WriteString(`="`)
+					b.WriteString(escapeLabelValue(l.Value))
+					b.WriteByte('"')
+				}
+				b.WriteByte('}')
+			}
+			b.WriteByte(' ')
+			b.WriteString(formatValue(s.Value))
+			b.WriteByte('\n')
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string       { return helpReplacer.Replace(s) }
+func escapeLabelValue(s string) string { return labelReplacer.Replace(s) }
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// value is a float64 updated atomically.
+type value struct {
+	bits atomic.Uint64
+}
+
+func (v *value) load() float64 { return math.Float64frombits(v.bits.Load()) }
+
+func (v *value) store(f float64) { v.bits.Store(math.Float64bits(f)) }
+
+func (v *value) add(delta float64) {
+	for {
+		old := v.bits.Load()
+		if v.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	name, help string
+	v          value
+}
+
+// NewCounter creates a counter.
+func NewCounter(name, help string) *Counter {
+	return &Counter{name: name, help: help}
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc() { c.v.add(1) }
+
+// Add increments the counter by delta, negative deltas are ignored.
+func (c *Counter) Add(delta float64) {
+	if delta > 0 {
+		c.v.add(delta)
+	}
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() float64 { return c.v.load() }
+
+func (c *Counter) Describe() []string { return []string{c.name} }
+
+func (c *Counter) Collect() []Family {
+	return []Family{{Name: c.name, Help: c.help, Type: TypeCounter, Samples: []Sample{{Value: c.Value()}}}}
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	name, help string
+	v          value
+}
+
+// NewGauge creates a gauge.
+func NewGauge(name, help string) *Gauge {
+	return &Gauge{name: name, help: help}
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) { g.v.store(v) }
+
+// Add adds delta to the gauge.
+func (g *Gauge) Add(delta float64) { g.v.add(delta) }
+
+// Inc increments the gauge by 1.
+func (g *Gauge) Inc() { g.v.add(1) }
+
+// Dec decrements the gauge by 1.
+func (g *Gauge) Dec() { g.v.add(-1) }
+
+// Value returns the current value of the gauge.
+func (g *Gauge) Value() float64 { return g.v.load() }
+
+func (g *Gauge) Describe() []string { return []string{g.name} }
+
+func (g *Gauge) Collect() []Family {
+	return []Family{{Name: g.name, Help: g.help, Type: TypeGauge, Samples: []Sample{{Value: g.Value()}}}}
+}
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	name, help string
+	labels     []string
+
+	mu       sync.RWMutex
+	counters map[string]*labeledCounter
+}
+
+type labeledCounter struct {
+	values  []string
+	counter Counter
+}
+
+// NewCounterVec creates a counter partitioned by the label names.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{name: name, help: help, labels: labels, counters: make(map[string]*labeledCounter)}
+}
+
+// With returns the counter for the label values, given in the order of the label names.
+// It panics if the number of values doesn't match the label names.
+func (v *CounterVec) With(values ...string) *Counter {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.RLock()
+	c, ok := v.counters[key]
+	v.mu.RUnlock()
+	if ok {
+		return &c.counter
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok = v.counters[key]; !ok {
+		c = &labeledCounter{values: slices.Clone(values)}
+		v.counters[key] = c
+	}
+	return &c.counter
+}
+
+func (v *CounterVec) Describe() []string { return []string{v.name} }
+
+func (v *CounterVec) Collect() []Family {
+	v.mu.RLock()
+	samples := make([]Sample, 0, len(v.counters))
+	for _, c := range v.counters {
+		samples = append(samples, Sample{Labels: labelPairs(v.labels, c.values), Value: c.counter.Value()})
+	}
+	v.mu.RUnlock()
+	sortSamples(samples)
+	return []Family{{Name: v.name, Help: v.help, Type: TypeCounter, Samples: samples}}
+}
+
+// GaugeFunc is a gauge whose samples are computed on each collection, e.g. from the state of a server.
+type GaugeFunc struct {
+	name, help string
+	fn         func() []Sample
+}
+
+// NewGaugeFunc creates a gauge with a single sample computed by fn.
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	return &GaugeFunc{name: name, help: help, fn: func() []Sample { return []Sample{{Value: fn()}} }}
+}
+
+// NewGaugeVecFunc creates a gauge whose samples are computed by fn, keyed by the values of a single label.
+func NewGaugeVecFunc(name, help, label string, fn func() map[string]float64) *GaugeFunc {
+	return &GaugeFunc{name: name, help: help, fn: func() []Sample {
+		values := fn()
+		samples := make([]Sample, 0, len(values))
+		for labelValue, v := range values {
+			samples = append(samples, Sample{Labels: []Label{{Name: label, Value: labelValue}}, Value: v})
+		}
+		sortSamples(samples)
+		return samples
+	}}
+}
+
+func (g *GaugeFunc) Describe() []string { return []string{g.name} }
+
+func (g *GaugeFunc) Collect() []Family {
+	return []Family{{Name: g.name, Help: g.help, Type: TypeGauge, Samples: g.fn()}}
+}
+
+func labelPairs(names, values []string) []Label {
+	labels := make([]Label, len(names))
+	for i, name := range names {
+		labels[i] = Label{Name: name, Value: values[i]}
+	}
+	return labels
+}
+
+// sortSamples sorts the samples by label values for a stable output.
+func sortSamples(samples []Sample) {
+	slices.SortFunc(samples, func(a, b Sample) int {
+		for i := range min(len(a.Labels), len(b.Labels)) {
+			if c := strings.Compare(a.Labels[i].Value, b.Labels[i].Value); c != 0 {
+				return c
+			}
+		}
+		return len(a.Labels) - len(b.Labels)
+	})
+}
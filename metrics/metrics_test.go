@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"errors"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	requests := NewCounterVec("requests_total", "Requests by code.", "code", "method")
+	requests.With("200", "get").Add(3)
+	requests.With("500", "get").Inc()
+	requests.With("200", "get").Inc()
+	temperature := NewGauge("temperature", "Temperature in \\degrees\nCelsius.")
+	temperature.Set(-1.5)
+	infinite := NewGaugeFunc("infinite", "", func() float64 { return math.Inf(1) })
+	labeled := NewGaugeVecFunc("labeled", "Escaped label values.", "name", func() map[string]float64 {
+		return map[string]float64{`a"b\c`: 1}
+	})
+
+	registry := NewRegistry()
+	registry.MustRegister(requests, temperature, infinite, labeled)
+
+	var b strings.Builder
+	if err := registry.WriteText(&b); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	want := `# TYPE infinite gauge
+infinite +Inf
+# HELP labeled Escaped label values.
+# TYPE labeled gauge
+labeled{name="a\"b\\c"} 1
+# HELP requests_total Requests by code.
+# TYPE requests_total counter
+requests_total{code="200",method="get"} 4
+requests_total{code="500",method="get"} 1
+# HELP temperature Temperature in \\degrees\nCelsius.
+# TYPE temperature gauge
+temperature -1.5
+`
+	if got := b.String(); got != want {
+		t.Errorf("WriteText =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegistry_Duplicate(t *testing.T) {
+	registry := NewRegistry()
+	registry.MustRegister(NewCounter("total", ""))
+	if err := registry.Register(NewGauge("total", "")); !errors.Is(err, ErrDuplicateMetric) {
+		t.Errorf("Register = %v, want %v", err, ErrDuplicateMetric)
+	}
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	registry := NewRegistry()
+	counter := NewCounter("total", "Total.")
+	counter.Add(2)
+	counter.Add(-1) // ignored
+	registry.MustRegister(counter)
+
+	rec := httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, ContentType)
+	}
+	if !strings.Contains(rec.Body.String(), "\ntotal 2\n") {
+		t.Errorf("unexpected body:\n%s", rec.Body.String())
+	}
+}
@@ -187,8 +187,41 @@ type Msg interface {
 	Decode([]byte) (int, error)
 }
 
+// VersionedMsg 由字段布局随协议版本变化的消息体实现
+//
+//	Message 解码时将消息头中的协议版本（MsgHeader.Version，2011 版由 DecodeOptions.Versions 推断）同步至消息体后再解码，
+//	编码时要求消息体与消息头的协议版本一致，否则返回 ErrVersionMismatch。
+//	Codec.EncodeFrames 补全消息头的协议版本时会将其同步至消息体。
+type VersionedMsg interface {
+	Msg
+	ProtocolVersion() VersionType
+	SetProtocolVersion(VersionType)
+}
+
+var (
+	_ VersionedMsg = (*T808_0x0100)(nil)
+	_ VersionedMsg = (*T808_0x0102)(nil)
+	_ VersionedMsg = (*T808_0x0107)(nil)
+	_ VersionedMsg = (*T808_0x0702)(nil)
+	_ VersionedMsg = (*T808_0x8300)(nil)
+	_ VersionedMsg = (*T808_0x8500)(nil)
+	_ VersionedMsg = (*T808_0x8600)(nil)
+	_ VersionedMsg = (*T808_0x8602)(nil)
+	_ VersionedMsg = (*T808_0x8604)(nil)
+	_ VersionedMsg = (*T808_0x8606)(nil)
+)
+
+// Validator 由需要额外校验字段取值（如枚举范围、BCD 数字）的消息体实现，仅在严格模式下于解码后调用
+//
+//	返回 *DecodeError 时 Offset 为相对消息体起始位置的偏移，Field 为消息体内的字段路径。
+type Validator interface {
+	Validate() error
+}
+
 // Message 消息包
 type Message struct {
 	Header *MsgHeader
 	Body   Msg
+
+	buf []byte // DecodeInto 复用的反转义缓冲区
 }
@@ -12,11 +12,19 @@ import (
 
 type Reader struct {
 	d []byte
-	r *bytes.Reader
+	r bytes.Reader
 }
 
 func NewReader(data []byte) *Reader {
-	return &Reader{d: data, r: bytes.NewReader(data)}
+	reader := &Reader{}
+	reader.Reset(data)
+	return reader
+}
+
+// Reset 重置 Reader 以读取 data，便于复用 Reader 避免内存分配
+func (reader *Reader) Reset(data []byte) {
+	reader.d = data
+	reader.r.Reset(data)
 }
 
 func (reader *Reader) Len() int {
@@ -107,36 +115,19 @@ func (reader *Reader) ReadUint64() (uint64, error) {
 
 // ReadBcdTime 对应 JT808 类型 BCD.
 func (reader *Reader) ReadBcdTime() (time.Time, error) {
-	if reader.r.Len() < 6 {
-		return time.Time{}, io.ErrUnexpectedEOF
-	}
-
-	var buf [6]byte
-	n, err := reader.r.Read(buf[:])
+	buf, err := reader.Read(6)
 	if err != nil {
 		return time.Time{}, err
 	}
-	if n != len(buf) {
-		return time.Time{}, io.ErrUnexpectedEOF
-	}
-	return FromBCDTime(buf[:])
+	return FromBCDTime(buf)
 }
 
 // ReadBcd 对应 JT808 类型 BCD.
 func (reader *Reader) ReadBcd(n int) (string, error) {
-	if reader.r.Len() < n {
-		return "", io.ErrUnexpectedEOF
-	}
-
-	var buf = make([]byte, n)
-	n, err := reader.r.Read(buf[:])
+	buf, err := reader.Read(n)
 	if err != nil {
 		return "", err
 	}
-	if n != len(buf) {
-		return "", io.ErrUnexpectedEOF
-	}
-
 	return BcdToString(buf), nil
 }
 
@@ -147,9 +138,22 @@ func (reader *Reader) ReadString(size ...int) (string, error) {
 		return "", err
 	}
 
-	text, err := io.ReadAll(transform.NewReader(bytes.NewReader(data), simplifiedchinese.GB18030.NewDecoder()))
+	// ASCII 为 GB18030 子集，无需转码
+	if isASCII(data) {
+		return BytesToString(data), nil
+	}
+	text, _, err := transform.Bytes(simplifiedchinese.GB18030.NewDecoder(), data)
 	if err != nil {
 		return "", err
 	}
 	return BytesToString(text), nil
 }
+
+func isASCII(data []byte) bool {
+	for _, b := range data {
+		if b >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,179 @@
+package jtt
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MsgFactory 消息体构造函数，每次调用返回一个新的消息体实例
+type MsgFactory func() Msg
+
+// Registry 消息 ID 与消息体类型的映射表，并发安全
+//
+//	除标准消息外，可通过 Register 覆盖已有实现，或注册 0x0F00~0x0FFF（终端上行）、
+//	0x8F00~0x8FFF（平台下行）等厂商自定义消息。
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[MsgID]MsgFactory
+}
+
+// NewRegistry 创建一个空的消息注册表
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[MsgID]MsgFactory)}
+}
+
+// Register 注册消息体构造函数，已存在的 MsgID 将被覆盖；factory 为 nil 时移除注册
+func (r *Registry) Register(msgID MsgID, factory MsgFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if factory == nil {
+		delete(r.factories, msgID)
+		return
+	}
+	r.factories[msgID] = factory
+}
+
+// Lookup 返回 MsgID 对应的构造函数
+func (r *Registry) Lookup(msgID MsgID) (MsgFactory, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	factory, ok := r.factories[msgID]
+	return factory, ok
+}
+
+// New 根据 MsgID 创建消息体，未注册时返回 ErrMessageNotRegistered
+func (r *Registry) New(msgID MsgID) (Msg, error) {
+	factory, ok := r.Lookup(msgID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMessageNotRegistered, msgID)
+	}
+	return factory(), nil
+}
+
+// MsgIDs 返回已注册的全部 MsgID（无序）
+func (r *Registry) MsgIDs() []MsgID {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := make([]MsgID, 0, len(r.factories))
+	for id := range r.factories {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Clone 复制注册表，便于在默认注册表基础上做局部定制
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c := &Registry{factories: make(map[MsgID]MsgFactory, len(r.factories))}
+	for id, factory := range r.factories {
+		c.factories[id] = factory
+	}
+	return c
+}
+
+var defaultRegistry = newDefaultRegistry()
+
+// DefaultRegistry 返回包级默认注册表，Message.Decode 未指定消息体时使用该表
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// Register 向默认注册表注册消息体构造函数，已存在的 MsgID 将被覆盖；factory 为 nil 时移除注册
+func Register(msgID MsgID, factory MsgFactory) {
+	defaultRegistry.Register(msgID, factory)
+}
+
+// NewMsg 根据 MsgID 从默认注册表创建消息体，未注册时返回 ErrMessageNotRegistered
+func NewMsg(msgID MsgID) (Msg, error) {
+	return defaultRegistry.New(msgID)
+}
+
+// newDefaultRegistry 注册本包实现的全部标准消息
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
+	for _, factory := range []MsgFactory{
+		func() Msg { return &T1078_0x1205{} },
+		func() Msg { return &T1078_0x9205{} },
+		func() Msg { return &T808_0x0001{} },
+		func() Msg { return &T808_0x0002{} },
+		func() Msg { return &T808_0x0003{} },
+		func() Msg { return &T808_0x0004{} },
+		func() Msg { return &T808_0x0005{} },
+		func() Msg { return &T808_0x0100{} },
+		func() Msg { return &T808_0x0102{} },
+		func() Msg { return &T808_0x0104{} },
+		func() Msg { return &T808_0x0107{} },
+		func() Msg { return &T808_0x0108{} },
+		func() Msg { return &T808_0x0200{} },
+		func() Msg { return &T808_0x0201{} },
+		func() Msg { return &T808_0x0301{} },
+		func() Msg { return &T808_0x0302{} },
+		func() Msg { return &T808_0x0303{} },
+		func() Msg { return &T808_0x0500{} },
+		func() Msg { return &T808_0x0608{} },
+		func() Msg { return &T808_0x0700{} },
+		func() Msg { return &T808_0x0701{} },
+		func() Msg { return &T808_0x0702{} },
+		func() Msg { return &T808_0x0704{} },
+		func() Msg { return &T808_0x0705{} },
+		func() Msg { return &T808_0x0800{} },
+		func() Msg { return &T808_0x0801{} },
+		func() Msg { return &T808_0x0802{} },
+		func() Msg { return &T808_0x0805{} },
+		func() Msg { return &T808_0x0900{} },
+		func() Msg { return &T808_0x0901{} },
+		func() Msg { return &T808_0x0A00{} },
+		func() Msg { return &T808_0x0E10{} },
+		func() Msg { return &T808_0x0E11{} },
+		func() Msg { return &T808_0x0E12{} },
+		func() Msg { return &T808_0x8001{} },
+		func() Msg { return &T808_0x8003{} },
+		func() Msg { return &T808_0x8004{} },
+		func() Msg { return &T808_0x8100{} },
+		func() Msg { return &T808_0x8103{} },
+		func() Msg { return &T808_0x8104{} },
+		func() Msg { return &T808_0x8105{} },
+		func() Msg { return &T808_0x8106{} },
+		func() Msg { return &T808_0x8107{} },
+		func() Msg { return &T808_0x8108{} },
+		func() Msg { return &T808_0x8201{} },
+		func() Msg { return &T808_0x8202{} },
+		func() Msg { return &T808_0x8203{} },
+		func() Msg { return &T808_0x8204{} },
+		func() Msg { return &T808_0x8300{} },
+		func() Msg { return &T808_0x8301{} },
+		func() Msg { return &T808_0x8302{} },
+		func() Msg { return &T808_0x8303{} },
+		func() Msg { return &T808_0x8304{} },
+		func() Msg { return &T808_0x8400{} },
+		func() Msg { return &T808_0x8401{} },
+		func() Msg { return &T808_0x8500{} },
+		func() Msg { return &T808_0x8600{} },
+		func() Msg { return &T808_0x8601{} },
+		func() Msg { return &T808_0x8602{} },
+		func() Msg { return &T808_0x8603{} },
+		func() Msg { return &T808_0x8604{} },
+		func() Msg { return &T808_0x8605{} },
+		func() Msg { return &T808_0x8606{} },
+		func() Msg { return &T808_0x8607{} },
+		func() Msg { return &T808_0x8608{} },
+		func() Msg { return &T808_0x8700{} },
+		func() Msg { return &T808_0x8701{} },
+		func() Msg { return &T808_0x8702{} },
+		func() Msg { return &T808_0x8800{} },
+		func() Msg { return &T808_0x8801{} },
+		func() Msg { return &T808_0x8802{} },
+		func() Msg { return &T808_0x8803{} },
+		func() Msg { return &T808_0x8804{} },
+		func() Msg { return &T808_0x8805{} },
+		func() Msg { return &T808_0x8900{} },
+		func() Msg { return &T808_0x8A00{} },
+		func() Msg { return &T808_0x8E10{} },
+		func() Msg { return &T808_0x8E11{} },
+		func() Msg { return &T808_0x8E12{} },
+	} {
+		r.Register(factory().MsgID(), factory)
+	}
+	return r
+}
@@ -0,0 +1,79 @@
+package jtt
+
+import (
+	"errors"
+	"testing"
+)
+
+// vendorMsg 厂商自定义消息，用于测试注册
+type vendorMsg struct {
+	Payload []byte
+}
+
+func (m *vendorMsg) MsgID() MsgID { return 0x0F01 }
+
+func (m *vendorMsg) Encode() ([]byte, error) { return m.Payload, nil }
+
+func (m *vendorMsg) Decode(data []byte) (int, error) {
+	m.Payload = append([]byte(nil), data...)
+	return len(data), nil
+}
+
+func TestRegistry_Default(t *testing.T) {
+	for _, id := range DefaultRegistry().MsgIDs() {
+		msg, err := NewMsg(id)
+		if err != nil {
+			t.Fatalf("NewMsg(%s): %v", id, err)
+		}
+		if msg.MsgID() != id {
+			t.Fatalf("NewMsg(%s): got body for %s", id, msg.MsgID())
+		}
+	}
+
+	msg, err := NewMsg(MsgT808_0x0200)
+	if err != nil {
+		t.Fatalf("NewMsg(0x0200): %v", err)
+	}
+	if _, ok := msg.(*T808_0x0200); !ok {
+		t.Fatalf("NewMsg(0x0200): unexpected type %T", msg)
+	}
+
+	if _, err := NewMsg(0x0F01); !errors.Is(err, ErrMessageNotRegistered) {
+		t.Fatalf("expect ErrMessageNotRegistered, got %v", err)
+	}
+}
+
+func TestRegistry_DecodeVendorMsg(t *testing.T) {
+	data, err := (&Message{
+		Header: &MsgHeader{PhoneNumber: "13800138000", SerialNumber: 7},
+		Body:   &vendorMsg{Payload: []byte{0x01, 0x02, 0x7e}},
+	}).Encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	m := &Message{}
+	if err := m.Decode(data); !errors.Is(err, ErrMessageNotRegistered) {
+		t.Fatalf("expect ErrMessageNotRegistered, got %v", err)
+	}
+	if m.Header == nil || m.Header.SerialNumber != 7 {
+		t.Fatalf("expect header to be decoded, got %+v", m.Header)
+	}
+	if raw, ok := m.Body.(*RawMsg); !ok || raw.ID != 0x0F01 {
+		t.Fatalf("expect raw body, got %#v", m.Body)
+	}
+
+	r := DefaultRegistry().Clone()
+	r.Register(0x0F01, func() Msg { return &vendorMsg{} })
+	got, err := r.Decode(data)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	body, ok := got.Body.(*vendorMsg)
+	if !ok || string(body.Payload) != string([]byte{0x01, 0x02, 0x7e}) {
+		t.Fatalf("unexpected body %#v", got.Body)
+	}
+	if _, err := DecodeMessage(data); !errors.Is(err, ErrMessageNotRegistered) {
+		t.Fatalf("default registry must not be affected by clone, got %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package jtt
+
+import "time"
+
+// RetryPolicy 消息应答超时重传策略
+//
+//	按协议规定，首次发送的应答超时时间 T0 = Timeout，第 N+1 次重传的应答超时时间 T(N+1) = T(N) × (N+1)。
+type RetryPolicy struct {
+	Timeout time.Duration // 首次发送的应答超时时间
+	Times   int           // 重传次数，0 表示不重传
+}
+
+// TimeoutAfter 返回重传 retransmissions 次后的应答超时时间
+func (p RetryPolicy) TimeoutAfter(retransmissions int) time.Duration {
+	timeout := p.Timeout
+	for n := 2; n <= retransmissions; n++ {
+		timeout *= time.Duration(n)
+	}
+	return timeout
+}
+
+// Enabled 是否启用超时重传
+func (p RetryPolicy) Enabled() bool { return p.Timeout > 0 && p.Times > 0 }
@@ -0,0 +1,15 @@
+package jtt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_TimeoutAfter(t *testing.T) {
+	p := RetryPolicy{Timeout: 10 * time.Second, Times: 3}
+	for retransmissions, want := range []time.Duration{10 * time.Second, 10 * time.Second, 20 * time.Second, 60 * time.Second} {
+		if got := p.TimeoutAfter(retransmissions); got != want {
+			t.Errorf("TimeoutAfter(%d) = %v, want %v", retransmissions, got, want)
+		}
+	}
+}
@@ -1,11 +1,19 @@
 package jtt
 
+import (
+	"maps"
+	"time"
+)
+
 // Segment 分包消息结构.
 type Segment struct {
-	PhoneNumber string            `json:"phoneNumber"`
-	MsgID       MsgID             `json:"msgId"`
-	Total       uint16            `json:"total"`
-	Data        map[uint16][]byte `json:"data"`
+	PhoneNumber  string            `json:"phoneNumber"`
+	MsgID        MsgID             `json:"msgId"`
+	SerialNumber uint16            `json:"serialNumber"` // 第一包的消息流水号
+	Total        uint16            `json:"total"`
+	Data         map[uint16][]byte `json:"data"`
+	UpdatedAt    time.Time         `json:"updatedAt"`    // 最近一次收到分包的时间
+	RetransmitAt time.Time         `json:"retransmitAt"` // 最近一次发起补传请求的时间
 }
 
 func (s *Segment) IsComplete() bool {
@@ -16,6 +24,17 @@ func (s *Segment) Merge(info *SegmentInfo, body []byte) {
 	s.Data[info.Index] = body
 }
 
+// Missing 返回尚未收到的包序号，按升序排列
+func (s *Segment) Missing() []uint16 {
+	missing := make([]uint16, 0, max(int(s.Total)-len(s.Data), 0))
+	for i := uint16(1); i <= s.Total; i++ {
+		if _, ok := s.Data[i]; !ok {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
 func (s *Segment) GetBody() []byte {
 	body := make([]byte, 0, s.Total*1023) // 预分配容量，避免扩容。分包长度固定最大 1023
 	for i := uint16(1); i <= s.Total; i++ {
@@ -24,10 +43,20 @@ func (s *Segment) GetBody() []byte {
 	return body
 }
 
+// Clone 返回分包缓存的副本，分包数据的切片与原缓存共用
+func (s *Segment) Clone() *Segment {
+	clone := *s
+	clone.Data = maps.Clone(s.Data)
+	return &clone
+}
+
 func (s *Segment) Reset() {
 	s.PhoneNumber = ""
 	s.MsgID = MsgID(0)
 	s.Total = 0
+	s.SerialNumber = 0
+	s.UpdatedAt = time.Time{}
+	s.RetransmitAt = time.Time{}
 	// 清空map而不是重新分配，可以重用内存
 	for k := range s.Data {
 		delete(s.Data, k)
@@ -1,11 +1,12 @@
 package segment
 
 import (
+	"bytes"
+	"fmt"
 	"strconv"
 	"sync"
 	"time"
 
-	"github.com/maypok86/otter/v2"
 	"github.com/ryan961/jtt"
 )
 
@@ -18,104 +19,226 @@ var (
 )
 
 type Pool struct {
-	pool *otter.Cache[string, *jtt.Segment]
+	store SegmentStore
 
 	capacity        int
 	initialCapacity int
 	variableTTL     time.Duration
+	registry        *jtt.Registry
+	keyFunc         KeyFunc
+	onEvict         EvictionHandler
+
+	retransmitIdle time.Duration
+	onRetransmit   RetransmitHandler
+	done           chan struct{}
+	closeOnce      sync.Once
 }
 
 func NewPool(opts ...PoolOptions) *Pool {
 	p := &Pool{
-		capacity:        3 * 1024 * 1024 * 1024, // 3G
+		capacity:        3 * 1024 * 1024 * 1024,
 		initialCapacity: 1000,
 		variableTTL:     300 * time.Second,
+		registry:        jtt.DefaultRegistry(),
+		keyFunc:         KeyByMsgID,
+		done:            make(chan struct{}),
 	}
 	for _, opt := range opts {
 		opt(p)
 	}
 
-	p.pool = otter.Must(&otter.Options[string, *jtt.Segment]{
-		MaximumSize:      p.capacity,
-		InitialCapacity:  p.initialCapacity,
-		ExpiryCalculator: otter.ExpiryWriting[string, *jtt.Segment](p.variableTTL),
-		OnAtomicDeletion: func(e otter.DeletionEvent[string, *jtt.Segment]) {
-			if e.Cause == otter.CauseOverflow || e.Cause == otter.CauseExpiration {
-				if e.Value != nil {
-					e.Value.Reset()
-					segmentPool.Put(e.Value)
-				}
-			}
-		},
-	})
+	if p.store == nil {
+		p.store = newMemoryStore(p.capacity, p.initialCapacity, p.variableTTL, p.onEvict)
+	}
+	if p.retransmitIdle > 0 && p.onRetransmit != nil {
+		go p.watchRetransmit()
+	}
 	return p
 }
 
+// KeyFunc returns the cache key of a segment packet, packets with the same key are merged together.
+type KeyFunc func(header *jtt.MsgHeader) string
+
+// KeyByMsgID keys segments by phone number and message ID, so a terminal can upload only one
+// segmented message per message ID at a time. This is the default.
+func KeyByMsgID(header *jtt.MsgHeader) string {
+	return header.PhoneNumber + ":" + strconv.FormatInt(int64(header.MsgID), 10)
+}
+
+// KeyBySerialNumber keys segments by phone number, message ID and the serial number of the first packet,
+// so concurrent uploads of the same message ID are kept apart. The serial number of the first packet is
+// derived from the packet's serial number and index, assuming consecutive serial numbers as the protocol requires.
+func KeyBySerialNumber(header *jtt.MsgHeader) string {
+	first := header.SerialNumber
+	if header.SegmentInfo != nil && header.SegmentInfo.Index > 0 {
+		first -= header.SegmentInfo.Index - 1
+	}
+	return KeyByMsgID(header) + ":" + strconv.FormatUint(uint64(first), 10)
+}
+
 // Cache adds a segment to the cache, returns true and the complete body if the segment is complete.
-// Otherwise, returns false and nil.
+// Otherwise, returns false and nil. Rejected packets (see Put) are ignored.
 func (s *Pool) Cache(header *jtt.MsgHeader, body []byte) (isCompleted bool, buffers []byte) {
-	if header == nil || header.SegmentInfo == nil {
-		return false, nil
-	}
-	key := header.PhoneNumber + ":" + strconv.FormatInt(int64(header.MsgID), 10)
-	// Use atomic per-key compute to avoid global lock and ensure correctness under concurrency
-	_, _ = s.pool.Compute(key, func(oldValue *jtt.Segment, found bool) (*jtt.Segment, otter.ComputeOp) {
-		var segment *jtt.Segment
-		if !found || oldValue == nil {
-			segment = segmentPool.Get().(*jtt.Segment)
-			segment.PhoneNumber = header.PhoneNumber
-			segment.MsgID = header.MsgID
-			segment.Total = header.SegmentInfo.Total
-		} else {
-			segment = oldValue
-		}
-
-		segment.Merge(header.SegmentInfo, body)
-		if segment.IsComplete() {
-			buffers = segment.GetBody()
-			// recycle and remove from cache
-			segment.Reset()
-			segmentPool.Put(segment)
-			return nil, otter.InvalidateOp
-		}
-		return segment, otter.WriteOp
-	})
-	// buffers != nil implies completion occurred during compute
-	return buffers != nil, buffers
+	isCompleted, buffers, _ = s.Put(header, body, 0)
+	return isCompleted, buffers
 }
 
 // CacheWithTimeout adds a segment to the cache with a specific timeout, returns true and the complete body
-// if the segment is complete. Otherwise, returns false and nil.
+// if the segment is complete. Otherwise, returns false and nil. Rejected packets (see Put) are ignored.
 func (s *Pool) CacheWithTimeout(header *jtt.MsgHeader, body []byte, timeout time.Duration) (isCompleted bool, buffers []byte) {
+	isCompleted, buffers, _ = s.Put(header, body, timeout)
+	return isCompleted, buffers
+}
+
+// Put adds a segment to the cache, returns true and the complete body if the segment is complete.
+// If timeout > 0, the TTL of the still incomplete segment is set to timeout.
+//
+// Conflicting packets are reported with an *Error:
+//   - ErrIndexOutOfRange: the index is 0 or greater than the total, the packet is rejected.
+//   - ErrDuplicateIndex: the index has already been received with different content, the packet is rejected.
+//     Identical retransmitted packets are accepted silently.
+//   - ErrTotalChanged: the terminal restarted the upload with a new total, the stale packets are discarded
+//     and the segment restarts from this packet.
+func (s *Pool) Put(header *jtt.MsgHeader, body []byte, timeout time.Duration) (isCompleted bool, buffers []byte, err error) {
+	result, err := s.merge(header, body, timeout)
+	if result == nil {
+		return false, nil, err
+	}
+	return true, result.body, err
+}
+
+// CacheMessage adds a decoded segment packet to the cache. Once all packets have arrived, it returns the
+// reassembled message with a synthesized header (segment info cleared, serial number of the first packet kept)
+// and a body decoded through the pool's registry. Otherwise, returns nil.
+//
+// Messages without segment info are returned as is. If the reassembled body cannot be decoded,
+// the message is returned with a *jtt.RawMsg body along with the error. Conflicting packets are
+// reported as described in Put.
+func (s *Pool) CacheMessage(msg *jtt.Message) (*jtt.Message, error) {
+	return s.CacheMessageWithTimeout(msg, 0)
+}
+
+// CacheMessageWithTimeout is like CacheMessage but sets a specific timeout for the incomplete segment.
+func (s *Pool) CacheMessageWithTimeout(msg *jtt.Message, timeout time.Duration) (*jtt.Message, error) {
+	if msg == nil || msg.Header == nil {
+		return nil, jtt.ErrInvalidHeader
+	}
+	if msg.Header.SegmentInfo == nil {
+		return msg, nil
+	}
+
+	var body []byte
+	if msg.Body != nil {
+		var err error
+		if body, err = msg.Body.Encode(); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := s.merge(msg.Header, body, timeout)
+	if result == nil {
+		return nil, err
+	}
+	return s.assemble(msg.Header, result)
+}
+
+// completed is the result of a completed segment.
+type completed struct {
+	serialNumber uint16
+	body         []byte
+}
+
+// merge adds a segment to the cache and returns the completed result once all segments have arrived.
+// If timeout > 0, the TTL of the still incomplete segment is set to timeout.
+func (s *Pool) merge(header *jtt.MsgHeader, body []byte, timeout time.Duration) (*completed, error) {
 	if header == nil || header.SegmentInfo == nil {
-		return false, nil
+		return nil, nil
+	}
+	key := s.keyFunc(header)
+	info := header.SegmentInfo
+	newError := func(err error) *Error {
+		return &Error{Key: key, SerialNumber: header.SerialNumber, Index: info.Index, Total: info.Total, Err: err}
+	}
+	if info.Index == 0 || info.Index > info.Total {
+		return nil, newError(ErrIndexOutOfRange)
 	}
-	key := header.PhoneNumber + ":" + strconv.FormatInt(int64(header.MsgID), 10)
-	_, ok := s.pool.Compute(key, func(oldValue *jtt.Segment, found bool) (*jtt.Segment, otter.ComputeOp) {
-		var segment *jtt.Segment
-		if !found || oldValue == nil {
-			segment = segmentPool.Get().(*jtt.Segment)
+
+	var (
+		result *completed
+		err    *Error
+	)
+	storeErr := s.store.Merge(key, func(segment *jtt.Segment, found bool) (*jtt.Segment, StoreOp) {
+		switch {
+		case !found || len(segment.Data) == 0:
+		case segment.Total != info.Total:
+			// the upload restarted with a new total, drop the stale packets
+			err = newError(ErrTotalChanged)
+			err.CachedTotal = segment.Total
+			segment.Reset()
+		default:
+			if data, ok := segment.Data[info.Index]; ok {
+				if !bytes.Equal(data, body) {
+					err = newError(ErrDuplicateIndex)
+				}
+				return segment, StoreKeep
+			}
+		}
+		if len(segment.Data) == 0 {
 			segment.PhoneNumber = header.PhoneNumber
 			segment.MsgID = header.MsgID
-			segment.Total = header.SegmentInfo.Total
-		} else {
-			segment = oldValue
+			segment.Total = info.Total
 		}
 
-		segment.Merge(header.SegmentInfo, body)
+		if _, ok := segment.Data[1]; !ok {
+			// the first packet is not yet received, infer its serial number assuming consecutive serial numbers
+			segment.SerialNumber = header.SerialNumber - (info.Index - 1)
+		}
+		segment.Merge(info, body)
+		segment.UpdatedAt = time.Now()
 		if segment.IsComplete() {
-			buffers = segment.GetBody()
-			// recycle and remove from cache
+			result = &completed{serialNumber: segment.SerialNumber, body: segment.GetBody()}
+			// recycle and remove from the store
 			segment.Reset()
 			segmentPool.Put(segment)
-			return nil, otter.InvalidateOp
+			return nil, StoreComplete
 		}
-		return segment, otter.WriteOp
+		return segment, StoreWrite
 	})
-	if ok && buffers == nil {
+	if storeErr != nil {
+		return nil, storeErr
+	}
+	if result == nil && timeout > 0 {
 		// still incomplete, set TTL for the key
-		s.pool.SetExpiresAfter(key, timeout)
+		s.store.Expire(key, timeout)
+	}
+	if err != nil {
+		return result, err
+	}
+	// result != nil implies completion occurred during merge
+	return result, nil
+}
+
+// assemble builds the reassembled message from the header of the last arrived packet.
+func (s *Pool) assemble(last *jtt.MsgHeader, result *completed) (*jtt.Message, error) {
+	header := last.Clone()
+	header.SerialNumber = result.serialNumber
+	header.SegmentInfo = nil
+	if header.Property == nil {
+		header.Property = &jtt.Property{}
+	}
+	header.Property.Segmentation = 0
+	header.Property.BodyLength = uint16(len(result.body))
+
+	msg := &jtt.Message{Header: header}
+	body, err := s.registry.New(header.MsgID)
+	if err != nil {
+		msg.Body = &jtt.RawMsg{ID: header.MsgID, Data: result.body}
+		return msg, err
+	}
+	if _, err := jtt.DecodeBody(header, body, result.body); err != nil {
+		msg.Body = &jtt.RawMsg{ID: header.MsgID, Data: result.body}
+		return msg, fmt.Errorf("decode body %s: %w", header.MsgID, err)
 	}
-	// buffers != nil implies completion occurred during compute
-	return buffers != nil, buffers
+	msg.Body = body
+	return msg, nil
 }
@@ -133,3 +133,54 @@ func TestPool_CacheWithTimeout_ConcurrentSameKey(t *testing.T) {
 		t.Fatalf("merged body mismatch: expected %v, got %v", expected, result)
 	}
 }
+
+func TestMemoryStore_GetDuringMerge(t *testing.T) {
+	store := NewMemoryStore(100, 10, time.Minute)
+	defer store.Close()
+
+	total := uint16(50)
+	key := KeyByMsgID(createTestHeader("13800138000", jtt.MsgT808_0x0801, total, 1))
+	merge := func(index uint16) {
+		_ = store.Merge(key, func(segment *jtt.Segment, found bool) (*jtt.Segment, StoreOp) {
+			segment.Total = total
+			segment.Data[index] = makeBody(index)
+			return segment, StoreUpdate
+		})
+	}
+	merge(1)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := uint16(2); i <= total; i++ {
+			merge(i)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			segment, ok := store.Get(key)
+			if !ok {
+				t.Error("segment not found")
+				return
+			}
+			before := len(segment.Data)
+			_ = segment.Missing()
+			if len(segment.Data) != before {
+				t.Error("returned segment changed by a merge")
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	segment, ok := store.Get(key)
+	if !ok || !segment.IsComplete() {
+		t.Fatalf("Get = %v, %v, want the complete segment", segment, ok)
+	}
+	segment.Data[1] = nil
+	if stored, _ := store.Get(key); stored.Data[1] == nil {
+		t.Error("modifying the returned segment changed the stored one")
+	}
+}
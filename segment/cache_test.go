@@ -2,6 +2,7 @@ package segment
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 	"time"
 
@@ -169,7 +170,7 @@ func TestPool_CacheWithTimeout(t *testing.T) {
 	// Create and cache the second segment with timeout
 	header2 := createTestHeader(phoneNumber, msgID, total, 2)
 	body2 := createTestBody(2, "timeout")
-	isCompleted, _ = pool.CacheWithTimeout(header2, body2, timeout)
+	isCompleted, buffers = pool.CacheWithTimeout(header2, body2, timeout)
 
 	// Now it should be complete
 	if !isCompleted {
@@ -245,3 +246,124 @@ func TestPool_Cache_NoSegmentInfo(t *testing.T) {
 		t.Error("Expected nil buffers with no segment info in CacheWithTimeout")
 	}
 }
+
+// TestPool_CacheMessage tests reassembling decoded packets into a typed message
+func TestPool_CacheMessage(t *testing.T) {
+	pool := NewPool()
+
+	content := bytes.Repeat([]byte("0123456789"), 250)
+	msg := &jtt.Message{
+		Header: &jtt.MsgHeader{PhoneNumber: "13800138000", SerialNumber: 100},
+		Body:   &jtt.T808_0x0900{TransparentMsgType: 0x41, TransparentMsgContent: content},
+	}
+	packets, err := msg.EncodeSegments(1023, nil)
+	if err != nil {
+		t.Fatalf("encode segments: %v", err)
+	}
+	if len(packets) != 3 {
+		t.Fatalf("expected 3 packets, got %d", len(packets))
+	}
+
+	// deliver out of order, the first packet last
+	var result *jtt.Message
+	for i, idx := range []int{2, 1, 0} {
+		packet, err := jtt.DecodeMessage(packets[idx])
+		if err != nil {
+			t.Fatalf("decode packet %d: %v", idx+1, err)
+		}
+		result, err = pool.CacheMessage(packet)
+		if err != nil {
+			t.Fatalf("cache packet %d: %v", idx+1, err)
+		}
+		if i < 2 && result != nil {
+			t.Fatalf("expected incomplete message after packet %d", idx+1)
+		}
+	}
+	if result == nil {
+		t.Fatal("expected completed message after all packets")
+	}
+
+	if result.Header.SerialNumber != 100 {
+		t.Errorf("expected serial number of first packet 100, got %d", result.Header.SerialNumber)
+	}
+	if result.Header.SegmentInfo != nil || result.Header.IsSegment() {
+		t.Errorf("expected segment info to be cleared, got %+v", result.Header.SegmentInfo)
+	}
+	body, ok := result.Body.(*jtt.T808_0x0900)
+	if !ok {
+		t.Fatalf("expected *jtt.T808_0x0900 body, got %T", result.Body)
+	}
+	if body.TransparentMsgType != 0x41 || !bytes.Equal(body.TransparentMsgContent, content) {
+		t.Error("reassembled body mismatch")
+	}
+}
+
+// TestPool_Put_Conflicts tests rejection of out-of-range and duplicate packets and restart on a changed total
+func TestPool_Put_Conflicts(t *testing.T) {
+	pool := NewPool()
+	phone := "13800138000"
+	msgID := jtt.MsgT808_0x0801
+
+	// out-of-range index must not count toward completion
+	for _, idx := range []uint16{0, 3} {
+		_, _, err := pool.Put(createTestHeader(phone, msgID, 2, idx), []byte("x"), 0)
+		if !errors.Is(err, ErrIndexOutOfRange) {
+			t.Fatalf("index %d: expected ErrIndexOutOfRange, got %v", idx, err)
+		}
+	}
+
+	// identical retransmission is accepted, different content is rejected
+	if _, _, err := pool.Put(createTestHeader(phone, msgID, 2, 1), []byte("first"), 0); err != nil {
+		t.Fatalf("put packet 1: %v", err)
+	}
+	if _, _, err := pool.Put(createTestHeader(phone, msgID, 2, 1), []byte("first"), 0); err != nil {
+		t.Fatalf("put identical packet 1: %v", err)
+	}
+	_, _, err := pool.Put(createTestHeader(phone, msgID, 2, 1), []byte("other"), 0)
+	var segErr *Error
+	if !errors.As(err, &segErr) || !errors.Is(err, ErrDuplicateIndex) || segErr.Index != 1 {
+		t.Fatalf("expected duplicate *Error, got %v", err)
+	}
+
+	// restart with a new total drops the stale packets
+	_, _, err = pool.Put(createTestHeader(phone, msgID, 3, 1), []byte("new1"), 0)
+	if !errors.As(err, &segErr) || !errors.Is(err, ErrTotalChanged) || segErr.CachedTotal != 2 || segErr.Total != 3 {
+		t.Fatalf("expected total changed *Error, got %v", err)
+	}
+	pool.Put(createTestHeader(phone, msgID, 3, 2), []byte("new2"), 0)
+	isCompleted, buffers, err := pool.Put(createTestHeader(phone, msgID, 3, 3), []byte("new3"), 0)
+	if err != nil || !isCompleted {
+		t.Fatalf("expected completion after restart, got %v (%v)", isCompleted, err)
+	}
+	if string(buffers) != "new1new2new3" {
+		t.Errorf("expected body of restarted upload, got %q", buffers)
+	}
+}
+
+// TestPool_KeyBySerialNumber tests that concurrent uploads of the same message ID are kept apart
+func TestPool_KeyBySerialNumber(t *testing.T) {
+	pool := NewPool(WithKeyFunc(KeyBySerialNumber))
+	phone := "13800138000"
+	msgID := jtt.MsgT808_0x0801
+
+	packet := func(firstSerial, total, index uint16) *jtt.MsgHeader {
+		header := createTestHeader(phone, msgID, total, index)
+		header.SerialNumber = firstSerial + index - 1
+		return header
+	}
+
+	pool.Cache(packet(10, 2, 1), []byte("a1"))
+	pool.Cache(packet(20, 2, 1), []byte("b1"))
+	if n := len(pool.Pending()); n != 2 {
+		t.Fatalf("expected 2 pending uploads, got %d", n)
+	}
+
+	isCompleted, buffers := pool.Cache(packet(20, 2, 2), []byte("b2"))
+	if !isCompleted || string(buffers) != "b1b2" {
+		t.Fatalf("expected upload b to complete, got %v %q", isCompleted, buffers)
+	}
+	isCompleted, buffers = pool.Cache(packet(10, 2, 2), []byte("a2"))
+	if !isCompleted || string(buffers) != "a1a2" {
+		t.Fatalf("expected upload a to complete, got %v %q", isCompleted, buffers)
+	}
+}
@@ -0,0 +1,37 @@
+package segment
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrIndexOutOfRange segment index is 0 or greater than the total
+	ErrIndexOutOfRange = errors.New("segment index out of range")
+	// ErrTotalChanged segment total differs from the cached segment
+	ErrTotalChanged = errors.New("segment total changed")
+	// ErrDuplicateIndex segment index already received with different content
+	ErrDuplicateIndex = errors.New("duplicate segment index")
+)
+
+// Error describes a rejected or conflicting segment packet, it unwraps to one of the sentinel errors above.
+type Error struct {
+	Key          string // cache key of the segment
+	SerialNumber uint16 // serial number of the packet
+	Index        uint16 // index of the packet
+	Total        uint16 // total of the packet
+	CachedTotal  uint16 // total of the cached segment, only set for ErrTotalChanged
+	Err          error
+}
+
+func (e *Error) Error() string {
+	if errors.Is(e.Err, ErrTotalChanged) {
+		return fmt.Sprintf("%s: key=%s serial=%d index=%d total=%d cached total=%d",
+			e.Err, e.Key, e.SerialNumber, e.Index, e.Total, e.CachedTotal)
+	}
+	return fmt.Sprintf("%s: key=%s serial=%d index=%d total=%d", e.Err, e.Key, e.SerialNumber, e.Index, e.Total)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,233 @@
+package segment
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+const (
+	fileStoreExt     = ".seg"
+	fileStoreStripes = 64
+)
+
+// fileRecord is the on-disk representation of a segment.
+type fileRecord struct {
+	Segment   *jtt.Segment `json:"segment"`
+	ExpiresAt time.Time    `json:"expiresAt"`
+}
+
+// FileStore is a SegmentStore that keeps every segment in its own file under a directory, so partially
+// uploaded messages survive process restarts and can be shared by gateway instances on a common volume.
+//
+// Writes are atomic (write to a temporary file, then rename). Merge is atomic per key within a process;
+// instances sharing a directory should route a terminal to one instance at a time.
+type FileStore struct {
+	dir   string
+	ttl   time.Duration
+	locks [fileStoreStripes]sync.Mutex
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewFileStore creates a FileStore under dir, segments are expired ttl after the last write.
+// Expired segments are removed lazily on access and by a background sweep every ttl.
+func NewFileStore(dir string, ttl time.Duration) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &FileStore{dir: dir, ttl: ttl, done: make(chan struct{})}
+	if ttl > 0 {
+		go s.sweep()
+	}
+	return s, nil
+}
+
+func (s *FileStore) Get(key string) (*jtt.Segment, bool) {
+	mu := s.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	record, err := s.read(key)
+	if err != nil || record == nil {
+		return nil, false
+	}
+	return record.Segment, true
+}
+
+func (s *FileStore) Merge(key string, fn MergeFunc) error {
+	mu := s.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	record, err := s.read(key)
+	if err != nil {
+		return err
+	}
+	found := record != nil
+	if !found {
+		record = &fileRecord{Segment: &jtt.Segment{Data: make(map[uint16][]byte)}}
+	}
+	if record.Segment.Data == nil {
+		record.Segment.Data = make(map[uint16][]byte)
+	}
+
+	segment, op := fn(record.Segment, found)
+	switch op {
+	case StoreUpdate:
+		if !found {
+			record.ExpiresAt = s.expiresAt()
+		}
+		record.Segment = segment
+		return s.write(key, record)
+	case StoreWrite:
+		record.Segment = segment
+		record.ExpiresAt = s.expiresAt()
+		return s.write(key, record)
+	case StoreComplete:
+		if found {
+			return s.remove(key)
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) Expire(key string, ttl time.Duration) {
+	mu := s.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	record, err := s.read(key)
+	if err != nil || record == nil {
+		return
+	}
+	record.ExpiresAt = time.Now().Add(ttl)
+	_ = s.write(key, record)
+}
+
+func (s *FileStore) Keys() []string {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil
+	}
+	keys := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, fileStoreExt) {
+			continue
+		}
+		key, err := base64.RawURLEncoding.DecodeString(strings.TrimSuffix(name, fileStoreExt))
+		if err != nil {
+			continue
+		}
+		keys = append(keys, string(key))
+	}
+	return keys
+}
+
+// Close stops the background sweep, stored segments are kept on disk.
+func (s *FileStore) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
+
+// Purge removes all expired segments.
+func (s *FileStore) Purge() {
+	for _, key := range s.Keys() {
+		mu := s.lock(key)
+		mu.Lock()
+		_, _ = s.read(key) // read removes expired records
+		mu.Unlock()
+	}
+}
+
+func (s *FileStore) sweep() {
+	ticker := time.NewTicker(s.ttl)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.Purge()
+		}
+	}
+}
+
+func (s *FileStore) lock(key string) *sync.Mutex {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return &s.locks[h.Sum32()%fileStoreStripes]
+}
+
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.dir, base64.RawURLEncoding.EncodeToString([]byte(key))+fileStoreExt)
+}
+
+func (s *FileStore) expiresAt() time.Time {
+	if s.ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(s.ttl)
+}
+
+// read loads the record stored under key, expired records are removed and reported as not found.
+func (s *FileStore) read(key string) (*fileRecord, error) {
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	record := &fileRecord{}
+	if err := json.Unmarshal(data, record); err != nil || record.Segment == nil {
+		// corrupted record, drop it
+		return nil, s.remove(key)
+	}
+	if !record.ExpiresAt.IsZero() && time.Now().After(record.ExpiresAt) {
+		return nil, s.remove(key)
+	}
+	return record, nil
+}
+
+func (s *FileStore) write(key string, record *fileRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(key))
+}
+
+func (s *FileStore) remove(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package segment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+// TestFileStore_SurvivesRestart tests that segments kept by a FileStore survive a pool restart
+func TestFileStore_SurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	phone := "13800138000"
+	msgID := jtt.MsgT808_0x0801
+
+	store, err := NewFileStore(dir, time.Minute)
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	pool := NewPool(WithStore(store))
+	for _, idx := range []uint16{1, 3} {
+		header := createTestHeader(phone, msgID, 3, idx)
+		header.SerialNumber = 40 + idx - 1
+		if isCompleted, _ := pool.Cache(header, createTestBody(idx, "disk")); isCompleted {
+			t.Fatalf("expected incomplete segment after packet %d", idx)
+		}
+	}
+	if err := pool.Close(); err != nil {
+		t.Fatalf("close pool: %v", err)
+	}
+
+	// restart with a new store on the same directory
+	store, err = NewFileStore(dir, time.Minute)
+	if err != nil {
+		t.Fatalf("reopen store: %v", err)
+	}
+	pool = NewPool(WithStore(store))
+	defer pool.Close()
+
+	pending := pool.Pending()
+	if len(pending) != 1 || len(pending[0].Missing) != 1 || pending[0].Missing[0] != 2 || pending[0].SerialNumber != 40 {
+		t.Fatalf("unexpected pending after restart: %+v", pending)
+	}
+
+	header := createTestHeader(phone, msgID, 3, 2)
+	header.SerialNumber = 41
+	isCompleted, buffers := pool.Cache(header, createTestBody(2, "disk"))
+	if !isCompleted {
+		t.Fatal("expected completed segment after restart")
+	}
+	expected := string(createTestBody(1, "disk")) + string(createTestBody(2, "disk")) + string(createTestBody(3, "disk"))
+	if string(buffers) != expected {
+		t.Errorf("expected merged body %q, got %q", expected, buffers)
+	}
+	if keys := store.Keys(); len(keys) != 0 {
+		t.Errorf("expected completed segment to be removed, got keys %v", keys)
+	}
+}
+
+// TestFileStore_Expire tests that expired segments are dropped
+func TestFileStore_Expire(t *testing.T) {
+	store, err := NewFileStore(t.TempDir(), time.Minute)
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	pool := NewPool(WithStore(store))
+	defer pool.Close()
+
+	pool.CacheWithTimeout(createTestHeader("13800138000", jtt.MsgT808_0x0801, 2, 1), []byte("x"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := store.Get(KeyByMsgID(createTestHeader("13800138000", jtt.MsgT808_0x0801, 2, 1))); ok {
+		t.Error("expected expired segment to be dropped")
+	}
+	store.Purge()
+	if keys := store.Keys(); len(keys) != 0 {
+		t.Errorf("expected no keys after purge, got %v", keys)
+	}
+}
@@ -1,12 +1,16 @@
 package segment
 
-import "time"
+import (
+	"time"
+
+	"github.com/ryan961/jtt"
+)
 
 type PoolOptions func(pool *Pool)
 
-// WithCapacity sets the future cache capacity.
+// WithCapacity sets the maximum number of segments kept by the default memory store.
 //
-// By default, the capacity is 10*1024*1024.
+// By default, the capacity is 3*1024*1024*1024.
 func WithCapacity(capacity int) PoolOptions {
 	return func(p *Pool) {
 		p.capacity = capacity
@@ -33,3 +37,53 @@ func WithVariableTTL(variableTTL time.Duration) PoolOptions {
 		p.variableTTL = variableTTL
 	}
 }
+
+// WithRegistry sets the registry used by CacheMessage to decode the reassembled body.
+//
+// By default, the registry is jtt.DefaultRegistry().
+func WithRegistry(registry *jtt.Registry) PoolOptions {
+	return func(p *Pool) {
+		p.registry = registry
+	}
+}
+
+// WithRetransmitHandler enables the retransmit hook: once a segment has received no packet (and no retransmit
+// request has been issued) for the idle period, the handler is called with a ready jtt.T808_0x8003 for uplink
+// messages or jtt.T808_0x0005 for downlink messages. Call Pool.Close to stop the background goroutine.
+//
+// By default, the retransmit hook is disabled.
+func WithRetransmitHandler(idle time.Duration, handler RetransmitHandler) PoolOptions {
+	return func(p *Pool) {
+		p.retransmitIdle = idle
+		p.onRetransmit = handler
+	}
+}
+
+// WithEvictionHandler sets the function called when the default memory store drops an incomplete segment,
+// either expired or over capacity, e.g. to count lost uploads.
+//
+// By default, evicted segments are dropped silently.
+func WithEvictionHandler(handler EvictionHandler) PoolOptions {
+	return func(p *Pool) {
+		p.onEvict = handler
+	}
+}
+
+// WithKeyFunc sets the function to key segment packets, see KeyByMsgID and KeyBySerialNumber.
+//
+// By default, the key func is KeyByMsgID.
+func WithKeyFunc(keyFunc KeyFunc) PoolOptions {
+	return func(p *Pool) {
+		p.keyFunc = keyFunc
+	}
+}
+
+// WithStore sets the storage backend of the pool, see NewMemoryStore and NewFileStore.
+// Capacity and TTL options only apply to the default memory store.
+//
+// By default, the store is NewMemoryStore(capacity, initialCapacity, variableTTL).
+func WithStore(store SegmentStore) PoolOptions {
+	return func(p *Pool) {
+		p.store = store
+	}
+}
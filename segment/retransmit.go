@@ -0,0 +1,147 @@
+package segment
+
+import (
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+// Pending describes a segmented message that is still being received.
+type Pending struct {
+	Key          string    `json:"key"`
+	PhoneNumber  string    `json:"phoneNumber"`
+	MsgID        jtt.MsgID `json:"msgId"`
+	SerialNumber uint16    `json:"serialNumber"` // serial number of the first packet
+	Total        uint16    `json:"total"`
+	Missing      []uint16  `json:"missing"` // missing packet indexes in ascending order
+	UpdatedAt    time.Time `json:"updatedAt"`
+	RetransmitAt time.Time `json:"retransmitAt"`
+}
+
+// RetransmitRequest builds the request for the missing packets.
+//
+// Uplink messages (collected by the platform) are answered with jtt.T808_0x8003, downlink messages
+// (collected by the terminal) with jtt.T808_0x0005.
+func (p Pending) RetransmitRequest() jtt.Msg {
+	ids := append([]uint16(nil), p.Missing...)
+	if p.MsgID&0x8000 != 0 {
+		return &jtt.T808_0x0005{
+			OriginalMsgSerialNo: p.SerialNumber,
+			TotalCount:          uint16(len(ids)),
+			PackageIDList:       ids,
+		}
+	}
+	return &jtt.T808_0x8003{
+		OriginalMsgSerialNo: p.SerialNumber,
+		TotalCount:          uint16(len(ids)),
+		PackageIDList:       ids,
+	}
+}
+
+// RetransmitHandler is called with the pending segment and the ready retransmit request
+// (*jtt.T808_0x8003 or *jtt.T808_0x0005) once the segment has been idle for the configured period.
+type RetransmitHandler func(pending Pending, request jtt.Msg)
+
+// Pending returns a snapshot of all segmented messages that are still being received.
+func (s *Pool) Pending() []Pending {
+	var pending []Pending
+	for _, key := range s.store.Keys() {
+		if p, ok := s.snapshot(key); ok {
+			pending = append(pending, p)
+		}
+	}
+	return pending
+}
+
+// Len returns the number of segmented messages that are still being received. It's an estimate for
+// stores that expire segments lazily.
+func (s *Pool) Len() int {
+	if store, ok := s.store.(interface{ Len() int }); ok {
+		return store.Len()
+	}
+	return len(s.store.Keys())
+}
+
+// snapshot copies the state of the segment under the per-key lock.
+func (s *Pool) snapshot(key string) (p Pending, ok bool) {
+	_ = s.store.Merge(key, func(segment *jtt.Segment, found bool) (*jtt.Segment, StoreOp) {
+		if found {
+			p = newPending(key, segment)
+			ok = true
+		}
+		return segment, StoreKeep
+	})
+	return p, ok
+}
+
+func newPending(key string, segment *jtt.Segment) Pending {
+	return Pending{
+		Key:          key,
+		PhoneNumber:  segment.PhoneNumber,
+		MsgID:        segment.MsgID,
+		SerialNumber: segment.SerialNumber,
+		Total:        segment.Total,
+		Missing:      segment.Missing(),
+		UpdatedAt:    segment.UpdatedAt,
+		RetransmitAt: segment.RetransmitAt,
+	}
+}
+
+// Close stops the background goroutines of the pool and closes its store.
+func (s *Pool) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		err = s.store.Close()
+	})
+	return err
+}
+
+// watchRetransmit periodically checks for idle segments and calls the retransmit handler.
+func (s *Pool) watchRetransmit() {
+	interval := s.retransmitIdle / 2
+	if interval <= 0 {
+		interval = s.retransmitIdle
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.checkRetransmit(now)
+		}
+	}
+}
+
+// checkRetransmit calls the retransmit handler for every segment idle since the last packet
+// or the last retransmit request for longer than the configured period.
+func (s *Pool) checkRetransmit(now time.Time) {
+	for _, key := range s.store.Keys() {
+		var (
+			p     Pending
+			fired bool
+		)
+		_ = s.store.Merge(key, func(segment *jtt.Segment, found bool) (*jtt.Segment, StoreOp) {
+			if !found {
+				return segment, StoreKeep
+			}
+			last := segment.UpdatedAt
+			if segment.RetransmitAt.After(last) {
+				last = segment.RetransmitAt
+			}
+			if now.Sub(last) < s.retransmitIdle {
+				return segment, StoreKeep
+			}
+			segment.RetransmitAt = now
+			p = newPending(key, segment)
+			fired = true
+			return segment, StoreUpdate
+		})
+		if fired && len(p.Missing) > 0 {
+			s.onRetransmit(p, p.RetransmitRequest())
+		}
+	}
+}
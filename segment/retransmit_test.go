@@ -0,0 +1,119 @@
+package segment
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+// TestPool_Pending tests reporting missing packets of in-flight segments
+func TestPool_Pending(t *testing.T) {
+	pool := NewPool()
+	defer pool.Close()
+
+	for _, idx := range []uint16{2, 4} {
+		header := createTestHeader("13800138000", jtt.MsgT808_0x0801, 5, idx)
+		header.SerialNumber = 20 + idx - 1
+		pool.Cache(header, createTestBody(idx, "media"))
+	}
+
+	pending := pool.Pending()
+	if len(pending) != 1 {
+		t.Fatalf("expected 1 pending segment, got %d", len(pending))
+	}
+	p := pending[0]
+	if p.PhoneNumber != "13800138000" || p.MsgID != jtt.MsgT808_0x0801 || p.Total != 5 {
+		t.Errorf("unexpected pending %+v", p)
+	}
+	if p.SerialNumber != 20 {
+		t.Errorf("expected inferred first serial number 20, got %d", p.SerialNumber)
+	}
+	if !reflect.DeepEqual(p.Missing, []uint16{1, 3, 5}) {
+		t.Errorf("expected missing [1 3 5], got %v", p.Missing)
+	}
+
+	req, ok := p.RetransmitRequest().(*jtt.T808_0x8003)
+	if !ok {
+		t.Fatalf("expected *jtt.T808_0x8003, got %T", p.RetransmitRequest())
+	}
+	if req.OriginalMsgSerialNo != 20 || req.TotalCount != 3 || !reflect.DeepEqual(req.PackageIDList, []uint16{1, 3, 5}) {
+		t.Errorf("unexpected request %+v", req)
+	}
+}
+
+// TestPool_RetransmitHandler tests the idle retransmit hook for uplink and downlink messages
+func TestPool_RetransmitHandler(t *testing.T) {
+	type fired struct {
+		pending Pending
+		request jtt.Msg
+	}
+	ch := make(chan fired, 4)
+	pool := NewPool(WithRetransmitHandler(50*time.Millisecond, func(pending Pending, request jtt.Msg) {
+		ch <- fired{pending, request}
+	}))
+	defer pool.Close()
+
+	uplink := createTestHeader("13800138000", jtt.MsgT808_0x0801, 2, 1)
+	uplink.SerialNumber = 7
+	pool.Cache(uplink, createTestBody(1, "up"))
+	downlink := createTestHeader("13800138000", jtt.MsgT808_0x8108, 3, 2)
+	downlink.SerialNumber = 9
+	pool.Cache(downlink, createTestBody(2, "down"))
+
+	got := make(map[jtt.MsgID]jtt.Msg)
+	deadline := time.After(2 * time.Second)
+	for len(got) < 2 {
+		select {
+		case f := <-ch:
+			got[f.pending.MsgID] = f.request
+		case <-deadline:
+			t.Fatalf("timeout waiting for retransmit requests, got %d", len(got))
+		}
+	}
+
+	up, ok := got[jtt.MsgT808_0x0801].(*jtt.T808_0x8003)
+	if !ok || up.OriginalMsgSerialNo != 7 || !reflect.DeepEqual(up.PackageIDList, []uint16{2}) {
+		t.Errorf("unexpected uplink request %#v", got[jtt.MsgT808_0x0801])
+	}
+	down, ok := got[jtt.MsgT808_0x8108].(*jtt.T808_0x0005)
+	if !ok || down.OriginalMsgSerialNo != 8 || !reflect.DeepEqual(down.PackageIDList, []uint16{1, 3}) {
+		t.Errorf("unexpected downlink request %#v", got[jtt.MsgT808_0x8108])
+	}
+}
+
+// TestPool_EvictionHandler tests reporting incomplete segments dropped on expiration
+func TestPool_EvictionHandler(t *testing.T) {
+	evicted := make(chan Pending, 1)
+	pool := NewPool(WithVariableTTL(50*time.Millisecond), WithEvictionHandler(func(pending Pending, cause EvictionCause) {
+		if cause == EvictExpired {
+			evicted <- pending
+		}
+	}))
+	defer pool.Close()
+
+	header := createTestHeader("13800138000", jtt.MsgT808_0x0801, 3, 1)
+	pool.Cache(header, createTestBody(1, "media"))
+	if n := pool.Len(); n != 1 {
+		t.Fatalf("expected 1 segment, got %d", n)
+	}
+
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case p := <-evicted:
+			if p.PhoneNumber != "13800138000" || p.MsgID != jtt.MsgT808_0x0801 || !reflect.DeepEqual(p.Missing, []uint16{2, 3}) {
+				t.Errorf("unexpected evicted segment %+v", p)
+			}
+			if n := pool.Len(); n != 0 {
+				t.Errorf("expected empty pool, got %d", n)
+			}
+			return
+		case <-deadline:
+			t.Fatal("expected the expired segment to be evicted")
+		case <-time.After(20 * time.Millisecond):
+			pool.Pending() // expired entries are evicted during maintenance
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package segment
+
+import (
+	"time"
+
+	"github.com/maypok86/otter/v2"
+	"github.com/ryan961/jtt"
+)
+
+// StoreOp tells SegmentStore.Merge what to do with the segment returned by the merge function.
+type StoreOp int
+
+const (
+	// StoreKeep leaves the stored segment unchanged.
+	StoreKeep StoreOp = iota
+	// StoreUpdate persists the segment and keeps its current expiration.
+	StoreUpdate
+	// StoreWrite persists the segment and resets its expiration to the store's TTL.
+	StoreWrite
+	// StoreComplete removes the segment, either completed or discarded.
+	StoreComplete
+)
+
+// MergeFunc computes the new state of a segment. It's called with the stored segment and whether it was found,
+// a new empty segment is passed if not found.
+type MergeFunc func(segment *jtt.Segment, found bool) (*jtt.Segment, StoreOp)
+
+// SegmentStore is the storage backend of Pool. Implementations must be safe for concurrent use, and Merge
+// must be atomic per key.
+type SegmentStore interface {
+	// Get returns a copy of the segment stored under key, later merges don't change it.
+	Get(key string) (*jtt.Segment, bool)
+	// Merge atomically computes the segment stored under key, see StoreOp.
+	Merge(key string, fn MergeFunc) error
+	// Expire sets the time to live of the segment stored under key.
+	Expire(key string, ttl time.Duration)
+	// Keys returns the keys of all stored segments.
+	Keys() []string
+	// Close releases the resources of the store.
+	Close() error
+}
+
+// EvictionCause is the reason an incomplete segment was dropped by the store.
+type EvictionCause int
+
+const (
+	// EvictExpired means the segment received no packet within its TTL.
+	EvictExpired EvictionCause = iota + 1
+	// EvictOverflow means the segment was dropped to keep the store within its capacity.
+	EvictOverflow
+)
+
+func (c EvictionCause) String() string {
+	switch c {
+	case EvictExpired:
+		return "expired"
+	case EvictOverflow:
+		return "overflow"
+	}
+	return "unknown"
+}
+
+// EvictionHandler is called with a snapshot of an incomplete segment dropped by the store.
+type EvictionHandler func(pending Pending, cause EvictionCause)
+
+// memoryStore is the in-process SegmentStore backed by otter.
+type memoryStore struct {
+	cache *otter.Cache[string, *jtt.Segment]
+}
+
+// NewMemoryStore creates an in-process SegmentStore backed by otter, segments are expired ttl after the last write.
+// This is the default store of Pool.
+func NewMemoryStore(capacity, initialCapacity int, ttl time.Duration) SegmentStore {
+	return newMemoryStore(capacity, initialCapacity, ttl, nil)
+}
+
+func newMemoryStore(capacity, initialCapacity int, ttl time.Duration, onEvict EvictionHandler) *memoryStore {
+	return &memoryStore{
+		cache: otter.Must(&otter.Options[string, *jtt.Segment]{
+			MaximumSize:      capacity,
+			InitialCapacity:  initialCapacity,
+			ExpiryCalculator: otter.ExpiryWriting[string, *jtt.Segment](ttl),
+			OnAtomicDeletion: func(e otter.DeletionEvent[string, *jtt.Segment]) {
+				if e.Cause != otter.CauseOverflow && e.Cause != otter.CauseExpiration || e.Value == nil {
+					return
+				}
+				if onEvict != nil {
+					cause := EvictExpired
+					if e.Cause == otter.CauseOverflow {
+						cause = EvictOverflow
+					}
+					onEvict(newPending(e.Key, e.Value), cause)
+				}
+				e.Value.Reset()
+				segmentPool.Put(e.Value)
+			},
+		}),
+	}
+}
+
+func (s *memoryStore) Get(key string) (*jtt.Segment, bool) {
+	var segment *jtt.Segment
+	// Merge modifies the stored segment in place, copy it under the same lock
+	s.cache.Compute(key, func(oldValue *jtt.Segment, found bool) (*jtt.Segment, otter.ComputeOp) {
+		if found && oldValue != nil {
+			segment = oldValue.Clone()
+		}
+		return oldValue, otter.CancelOp
+	})
+	return segment, segment != nil
+}
+
+func (s *memoryStore) Merge(key string, fn MergeFunc) error {
+	s.cache.Compute(key, func(oldValue *jtt.Segment, found bool) (*jtt.Segment, otter.ComputeOp) {
+		segment := oldValue
+		if !found || segment == nil {
+			found = false
+			segment = segmentPool.Get().(*jtt.Segment)
+		}
+
+		newValue, op := fn(segment, found)
+		switch op {
+		case StoreUpdate:
+			if found && newValue == segment {
+				// modified in place, keep the current expiration
+				return oldValue, otter.CancelOp
+			}
+			return newValue, otter.WriteOp
+		case StoreWrite:
+			return newValue, otter.WriteOp
+		case StoreComplete:
+			if found {
+				return nil, otter.InvalidateOp
+			}
+			return nil, otter.CancelOp
+		default:
+			if !found {
+				segmentPool.Put(segment)
+			}
+			return oldValue, otter.CancelOp
+		}
+	})
+	return nil
+}
+
+func (s *memoryStore) Expire(key string, ttl time.Duration) {
+	s.cache.SetExpiresAfter(key, ttl)
+}
+
+func (s *memoryStore) Keys() []string {
+	var keys []string
+	for key := range s.cache.Keys() {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Len returns the number of stored segments, see Pool.Len.
+func (s *memoryStore) Len() int {
+	return s.cache.EstimatedSize()
+}
+
+func (s *memoryStore) Close() error {
+	s.cache.StopAllGoroutines()
+	return nil
+}
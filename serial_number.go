@@ -1,6 +1,8 @@
 package jtt
 
 import (
+	"encoding/json"
+	"io"
 	"math"
 	"sync"
 )
@@ -35,6 +37,116 @@ var (
 )
 
 // GenerateSerialNumber 生成消息序列号，取值范围 [1, 65535}
+//
+//	所有终端共用同一序列，按终端维护独立序列使用 SerialGenerator。
 func GenerateSerialNumber() uint16 {
 	return serialNumber.Get()
 }
+
+// SerialGenerator 消息流水号生成器，按 key（通常为终端手机号）维护独立的循环自增序列，实现需可并发使用
+type SerialGenerator interface {
+	// Next 返回 key 的下一个流水号
+	Next(key string) uint16
+}
+
+// SerialGeneratorFunc 函数形式的 SerialGenerator
+type SerialGeneratorFunc func(key string) uint16
+
+func (fn SerialGeneratorFunc) Next(key string) uint16 { return fn(key) }
+
+// GlobalSerialGenerator 忽略 key，所有终端共用 GenerateSerialNumber 的全局序列
+var GlobalSerialGenerator SerialGenerator = SerialGeneratorFunc(func(string) uint16 { return GenerateSerialNumber() })
+
+// SerialFunc 将 SerialGenerator 转换为 key 的流水号函数，用于 Message.EncodeSegments
+func SerialFunc(gen SerialGenerator, key string) func() uint16 {
+	return func() uint16 { return gen.Next(key) }
+}
+
+// MemorySerialGenerator 内存 SerialGenerator，每个 key 的流水号从 1 开始循环自增，取值范围 [1, 65535]
+//
+//	可通过 Snapshot 保存各 key 的下一个流水号，重启后通过 Restore 或 NewMemorySerialGeneratorFromSnapshot 恢复。
+type MemorySerialGenerator struct {
+	mu   sync.Mutex
+	next map[string]uint16
+}
+
+// NewMemorySerialGenerator 创建内存 SerialGenerator
+func NewMemorySerialGenerator() *MemorySerialGenerator {
+	return &MemorySerialGenerator{next: make(map[string]uint16)}
+}
+
+// NewMemorySerialGeneratorFromSnapshot 由 Snapshot 的结果创建内存 SerialGenerator
+func NewMemorySerialGeneratorFromSnapshot(snapshot map[string]uint16) *MemorySerialGenerator {
+	g := NewMemorySerialGenerator()
+	g.Restore(snapshot)
+	return g
+}
+
+func (g *MemorySerialGenerator) Next(key string) uint16 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	val := g.next[key]
+	if val == 0 {
+		val = 1
+	}
+	if val == math.MaxUint16 {
+		g.next[key] = 1 // 超过最大值后，循环到 1
+	} else {
+		g.next[key] = val + 1
+	}
+	return val
+}
+
+// Delete 删除 key 的序列，下一次从 1 开始
+func (g *MemorySerialGenerator) Delete(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.next, key)
+}
+
+// Snapshot 返回各 key 的下一个流水号
+func (g *MemorySerialGenerator) Snapshot() map[string]uint16 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	snapshot := make(map[string]uint16, len(g.next))
+	for key, val := range g.next {
+		snapshot[key] = val
+	}
+	return snapshot
+}
+
+// Restore 按 Snapshot 的结果恢复各 key 的下一个流水号，未包含的 key 保持不变
+func (g *MemorySerialGenerator) Restore(snapshot map[string]uint16) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for key, val := range snapshot {
+		g.next[key] = val
+	}
+}
+
+// WriteTo 将 Snapshot 的结果以 JSON 格式写入 w，用于持久化
+func (g *MemorySerialGenerator) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.Marshal(g.Snapshot())
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// ReadFrom 从 r 读取 WriteTo 写入的 JSON 并恢复各 key 的下一个流水号
+func (g *MemorySerialGenerator) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return int64(len(data)), err
+	}
+	var snapshot map[string]uint16
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return int64(len(data)), err
+	}
+	g.Restore(snapshot)
+	return int64(len(data)), nil
+}
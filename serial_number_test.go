@@ -0,0 +1,109 @@
+package jtt
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestMemorySerialGenerator(t *testing.T) {
+	gen := NewMemorySerialGenerator()
+	for want := uint16(1); want <= 3; want++ {
+		if got := gen.Next("a"); got != want {
+			t.Fatalf("expect %d, got %d", want, got)
+		}
+	}
+	if got := gen.Next("b"); got != 1 {
+		t.Fatalf("expect independent sequence per key, got %d", got)
+	}
+
+	gen.Restore(map[string]uint16{"c": math.MaxUint16})
+	if got := gen.Next("c"); got != math.MaxUint16 {
+		t.Fatalf("expect %d, got %d", math.MaxUint16, got)
+	}
+	if got := gen.Next("c"); got != 1 {
+		t.Fatalf("expect wrap around to 1, got %d", got)
+	}
+
+	var buf bytes.Buffer
+	if _, err := gen.WriteTo(&buf); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+	restored := NewMemorySerialGenerator()
+	if _, err := restored.ReadFrom(&buf); err != nil {
+		t.Fatalf("read snapshot: %v", err)
+	}
+	if got := restored.Next("a"); got != 4 {
+		t.Fatalf("expect restored sequence to continue at 4, got %d", got)
+	}
+	if got := NewMemorySerialGeneratorFromSnapshot(gen.Snapshot()).Next("b"); got != 2 {
+		t.Fatalf("expect restored sequence to continue at 2, got %d", got)
+	}
+}
+
+func TestCodec_SerialGenerator(t *testing.T) {
+	gen := NewMemorySerialGenerator()
+	codec := NewCodec(WithSerialGenerator(gen))
+
+	encode := func(phone string, serial uint16) uint16 {
+		m := &Message{Header: &MsgHeader{PhoneNumber: phone, SerialNumber: serial}, Body: &T808_0x8001{}}
+		if _, err := codec.Encode(m); err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		return m.Header.SerialNumber
+	}
+	if a1, a2, b1 := encode("13800138000", 0), encode("13800138000", 0), encode("13800138001", 0); a1 != 1 || a2 != 2 || b1 != 1 {
+		t.Fatalf("expect per-terminal serials 1, 2, 1, got %d, %d, %d", a1, a2, b1)
+	}
+	if got := encode("13800138000", 100); got != 100 {
+		t.Fatalf("expect explicit serial kept, got %d", got)
+	}
+
+	m := &Message{
+		Header: &MsgHeader{PhoneNumber: "13800138000"},
+		Body:   &T808_0x0900{TransparentMsgType: 0x41, TransparentMsgContent: make([]byte, 2000)},
+	}
+	packets, err := codec.EncodeSegments(m, 1000, nil)
+	if err != nil {
+		t.Fatalf("encode segments: %v", err)
+	}
+	if len(packets) != 3 || m.Header.SerialNumber != 3 || gen.Next("13800138000") != 6 {
+		t.Fatalf("expect segments to take serials 3..5, got %d packets from %d", len(packets), m.Header.SerialNumber)
+	}
+}
+
+func TestCodec_EncodeFrames(t *testing.T) {
+	gen := NewMemorySerialGenerator()
+	codec := NewCodec()
+
+	text := &T808_0x8300{Text: "hello"}
+	m := &Message{Body: text}
+	frames, last, err := codec.EncodeFrames(m, "13800138000", Version2019, gen)
+	if err != nil {
+		t.Fatalf("encode frames: %v", err)
+	}
+	if m.Header.PhoneNumber != "13800138000" || m.Header.Version != Version2019 || m.Header.ProtocolVersion != 1 {
+		t.Fatalf("expect header filled from the terminal, got %+v", m.Header)
+	}
+	if text.ProtocolVersion() != Version2019 || len(frames) != 1 || last != 1 {
+		t.Fatalf("expect 1 frame with serial 1 and body version 2019, got %d frames, last %d, body %d", len(frames), last, text.ProtocolVersion())
+	}
+
+	for _, serial := range []uint16{0, 100} {
+		m = &Message{
+			Header: &MsgHeader{SerialNumber: serial},
+			Body:   &T808_0x0900{TransparentMsgType: 0x41, TransparentMsgContent: make([]byte, 2000)},
+		}
+		frames, last, err = codec.EncodeFrames(m, "13800138000", Version2013, gen)
+		if err != nil {
+			t.Fatalf("encode frames: %v", err)
+		}
+		want := uint16(3)
+		if serial != 0 {
+			want = serial + 1
+		}
+		if len(frames) != 2 || last != want {
+			t.Fatalf("expect 2 frames ending with serial %d, got %d frames ending with %d", want, len(frames), last)
+		}
+	}
+}
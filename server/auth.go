@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ryan961/jtt"
+)
+
+// AuthFlow is a Handler running the registration (0x0100 → 0x8100), authentication (0x0102) and logout (0x0003)
+// of terminals against a TerminalDirectory, it answers these messages itself. Other messages go to the next
+// handler once the session is authenticated. Messages of unauthenticated sessions are answered with a failure
+// and rejected with ErrNotAuthenticated.
+//
+// Sessions of a server with an AuthFlow handler are indexed by phone number once authenticated,
+// see WithAuthRequired.
+type AuthFlow struct {
+	directory TerminalDirectory
+	next      Handler
+}
+
+// NewAuthFlow creates an AuthFlow dispatching the messages of authenticated sessions to next, usually a *Router.
+func NewAuthFlow(directory TerminalDirectory, next Handler) *AuthFlow {
+	return &AuthFlow{directory: directory, next: next}
+}
+
+func (f *AuthFlow) ServeMessage(ctx context.Context, req *Request) error {
+	switch body := req.Message.Body.(type) {
+	case *jtt.T808_0x0100:
+		return f.register(ctx, req, body)
+	case *jtt.T808_0x0102:
+		return f.authenticate(ctx, req, body)
+	case *jtt.T808_0x0003:
+		return f.logout(ctx, req)
+	}
+	if !req.Session.Authenticated() {
+		if answeredByGeneralReply(req.Message.Header.MsgID) {
+			_ = req.Reply(jtt.ReplyResultFailure)
+		}
+		req.SkipReply()
+		return fmt.Errorf("%s: %w", req.Message.Header.MsgID, ErrNotAuthenticated)
+	}
+	return f.next.ServeMessage(ctx, req)
+}
+
+func (f *AuthFlow) register(ctx context.Context, req *Request, reg *jtt.T808_0x0100) error {
+	req.Session.SetAuthenticated(false)
+	authCode, result, err := f.directory.Register(ctx, req.Session.PhoneNumber(), reg)
+	if err != nil {
+		// no reply, the terminal registers again
+		return err
+	}
+	req.SkipReply()
+	return req.Session.Send(&jtt.T808_0x8100{
+		ReplyMsgSerialNo: req.Message.Header.SerialNumber,
+		Result:           result,
+		AuthCode:         authCode,
+	})
+}
+
+func (f *AuthFlow) authenticate(ctx context.Context, req *Request, auth *jtt.T808_0x0102) error {
+	if err := f.directory.Authenticate(ctx, req.Session.PhoneNumber(), auth); err != nil {
+		req.Session.SetAuthenticated(false)
+		_ = req.Reply(jtt.ReplyResult(err))
+		return err
+	}
+	req.Session.SetAuthenticated(true)
+	return req.Reply(jtt.ReplyResultSuccess)
+}
+
+func (f *AuthFlow) logout(ctx context.Context, req *Request) error {
+	req.Session.SetAuthenticated(false)
+	err := f.directory.Unregister(ctx, req.Session.PhoneNumber())
+	if replyErr := req.Reply(jtt.ReplyResult(err)); err == nil {
+		err = replyErr
+	}
+	return err
+}
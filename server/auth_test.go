@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+func TestMemoryDirectory_Register(t *testing.T) {
+	ctx := context.Background()
+	dir := NewMemoryDirectory(false)
+	dir.Provision(Terminal{TerminalID: "T000001", PlateColor: 1, PlateNumber: "A12345"})
+	dir.Provision(Terminal{TerminalID: "T000002"})
+
+	tests := []struct {
+		name  string
+		phone string
+		reg   *jtt.T808_0x0100
+		want  byte
+	}{
+		{"unknown terminal", "13800000001", &jtt.T808_0x0100{TerminalID: "T999999"}, jtt.RegisterResultTerminalNotFound},
+		{"wrong vehicle", "13800000001", &jtt.T808_0x0100{TerminalID: "T000001", PlateColor: 1, PlateNumber: "B12345"}, jtt.RegisterResultVehicleNotFound},
+		{"success", "13800000001", &jtt.T808_0x0100{TerminalID: "T000001", PlateColor: 1, PlateNumber: "A12345"}, jtt.RegisterResultSuccess},
+		{"registered again", "13800000001", &jtt.T808_0x0100{TerminalID: "T000001", PlateColor: 1, PlateNumber: "A12345"}, jtt.RegisterResultSuccess},
+		{"terminal registered", "13800000002", &jtt.T808_0x0100{TerminalID: "T000001", PlateColor: 1, PlateNumber: "A12345"}, jtt.RegisterResultTerminalRegistered},
+		{"vehicle registered", "13800000002", &jtt.T808_0x0100{TerminalID: "T000002", PlateColor: 1, PlateNumber: "A12345"}, jtt.RegisterResultVehicleRegistered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authCode, result, err := dir.Register(ctx, tt.phone, tt.reg)
+			if err != nil {
+				t.Fatalf("Register: %v", err)
+			}
+			if result != tt.want {
+				t.Fatalf("Register result = %d, want %d", result, tt.want)
+			}
+			if (authCode != "") != (result == jtt.RegisterResultSuccess) {
+				t.Errorf("Register auth code = %q with result %d", authCode, result)
+			}
+		})
+	}
+
+	open := NewMemoryDirectory(true)
+	if _, result, _ := open.Register(ctx, "13800000003", &jtt.T808_0x0100{TerminalID: "T999999"}); result != jtt.RegisterResultSuccess {
+		t.Errorf("open directory Register result = %d, want %d", result, jtt.RegisterResultSuccess)
+	}
+}
+
+func TestMemoryDirectory_Authenticate(t *testing.T) {
+	ctx := context.Background()
+	dir := NewMemoryDirectory(false)
+	dir.Provision(Terminal{TerminalID: "T000001", IMEI: "123456789012345"})
+	authCode, _, err := dir.Register(ctx, "13800000001", &jtt.T808_0x0100{TerminalID: "T000001"})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	auth2019 := func(authCode, imei string) *jtt.T808_0x0102 {
+		auth := &jtt.T808_0x0102{AuthCode: authCode, IMEI: imei, SoftwareVersion: "v1.2"}
+		auth.SetProtocolVersion(jtt.Version2019)
+		return auth
+	}
+	if err := dir.Authenticate(ctx, "13800000002", &jtt.T808_0x0102{AuthCode: authCode}); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("Authenticate unregistered = %v, want %v", err, ErrAuthFailed)
+	}
+	if err := dir.Authenticate(ctx, "13800000001", &jtt.T808_0x0102{AuthCode: "wrong"}); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("Authenticate wrong code = %v, want %v", err, ErrAuthFailed)
+	}
+	if err := dir.Authenticate(ctx, "13800000001", auth2019(authCode, "999999999999999")); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("Authenticate wrong IMEI = %v, want %v", err, ErrAuthFailed)
+	}
+	if err := dir.Authenticate(ctx, "13800000001", auth2019(authCode, "123456789012345")); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if terminal, _ := dir.Terminal("13800000001"); terminal.SoftwareVersion != "v1.2" {
+		t.Errorf("SoftwareVersion = %q, want %q", terminal.SoftwareVersion, "v1.2")
+	}
+
+	if err := dir.Unregister(ctx, "13800000001"); err != nil {
+		t.Fatalf("Unregister: %v", err)
+	}
+	if err := dir.Authenticate(ctx, "13800000001", &jtt.T808_0x0102{AuthCode: authCode}); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("Authenticate after Unregister = %v, want %v", err, ErrAuthFailed)
+	}
+}
+
+func TestAuthFlow(t *testing.T) {
+	locations := make(chan *Request, 1)
+	router := NewRouter()
+	router.HandleFunc(jtt.MsgT808_0x0200, func(ctx context.Context, req *Request) error {
+		locations <- req
+		return nil
+	})
+	srv := New(NewAuthFlow(NewMemoryDirectory(true), router), WithAutoReply(true))
+	events := make(chan Event, 4)
+	srv.Subscribe(func(e Event) { events <- e })
+	addr := startServer(t, srv)
+	term := dialTerminal(t, "tcp", addr, "13812345678")
+
+	expectReply := func(header *jtt.MsgHeader, result byte) {
+		t.Helper()
+		m := term.receive()
+		reply, ok := m.Body.(*jtt.T808_0x8001)
+		if !ok || *reply != *jtt.NewPlatformReply(header, result) {
+			t.Fatalf("received %s %+v, want a general reply with result %d", m.Header.MsgID, m.Body, result)
+		}
+	}
+
+	// blocked until authenticated
+	expectReply(term.send(&jtt.T808_0x0200{}), jtt.ReplyResultFailure)
+
+	header := term.send(&jtt.T808_0x0100{ManufacturerID: "ABCDE", TerminalModel: "M1", TerminalID: "T1", PlateNumber: "A12345"})
+	m := term.receive()
+	registered, ok := m.Body.(*jtt.T808_0x8100)
+	if !ok || registered.Result != jtt.RegisterResultSuccess || registered.ReplyMsgSerialNo != header.SerialNumber {
+		t.Fatalf("received %s %+v, want a successful registration reply", m.Header.MsgID, m.Body)
+	}
+
+	expectReply(term.send(&jtt.T808_0x0102{AuthCode: "wrong"}), jtt.ReplyResultFailure)
+	expectReply(term.send(&jtt.T808_0x0102{AuthCode: registered.AuthCode}), jtt.ReplyResultSuccess)
+
+	expectReply(term.send(&jtt.T808_0x0200{}), jtt.ReplyResultSuccess)
+	select {
+	case req := <-locations:
+		if !req.Session.Authenticated() {
+			t.Error("session not authenticated")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("location not dispatched after authentication")
+	}
+
+	for _, want := range []EventType{EventOnline, EventAuthenticated} {
+		if e := <-events; e.Type != want || e.Session.PhoneNumber() != term.phone {
+			t.Errorf("event = %s of %s, want %s of %s", e.Type, e.Session.PhoneNumber(), want, term.phone)
+		}
+	}
+}
+
+func TestAuthFlow_PhoneChangeRefused(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc(jtt.MsgT808_0x0200, func(ctx context.Context, req *Request) error { return nil })
+	srv := New(NewAuthFlow(NewMemoryDirectory(true), router), WithAutoReply(true))
+	addr := startServer(t, srv)
+	victim := dialTerminal(t, "tcp", addr, "13812345678")
+	authenticate(t, victim)
+	attacker := dialTerminal(t, "tcp", addr, "13812345679")
+	authenticate(t, attacker)
+	session, _ := srv.Session(victim.phone)
+
+	// the authenticated attacker reports locations as the victim
+	attacker.phone = victim.phone
+	attacker.send(&jtt.T808_0x0200{})
+	m, err := attacker.receiveWithin(2 * time.Second)
+	var ne net.Error
+	if m != nil || errors.As(err, &ne) && ne.Timeout() {
+		t.Fatalf("attacker received %v, %v, want the connection closed", m, err)
+	}
+	if got, ok := srv.Session(victim.phone); !ok || got != session || !got.Authenticated() {
+		t.Fatalf("Session(%s) isn't the authenticated session of the victim", victim.phone)
+	}
+	header := victim.send(&jtt.T808_0x0200{})
+	if m = victim.receive(); m.Header.MsgID != jtt.MsgT808_0x8001 || m.Body.(*jtt.T808_0x8001).ReplyMsgSerialNo != header.SerialNumber {
+		t.Errorf("victim received %s %+v, want the reply of its location", m.Header.MsgID, m.Body)
+	}
+}
+
+func TestAuthFlow_UnauthenticatedSessionNotIndexed(t *testing.T) {
+	for _, network := range []string{"tcp", "udp"} {
+		t.Run(network, func(t *testing.T) {
+			router := NewRouter()
+			router.HandleFunc(jtt.MsgT808_0x0002, func(ctx context.Context, req *Request) error { return nil })
+			srv := New(NewAuthFlow(NewMemoryDirectory(true), router), WithAutoReply(true))
+			// the attacker connects to another listener, UDP datagrams of a phone number on the same
+			// connection are handled by the session of the terminal
+			addr, other := startServer(t, srv), startServer(t, srv)
+			if network == "udp" {
+				addr, other = startUDPServer(t, srv), startUDPServer(t, srv)
+			}
+			victim := dialTerminal(t, network, addr, "13812345678")
+			expectResult(t, victim, victim.send(&jtt.T808_0x0002{}), jtt.ReplyResultFailure)
+			if _, ok := srv.Session(victim.phone); ok {
+				t.Fatalf("Session(%s) found before authentication", victim.phone)
+			}
+			authCode := authenticate(t, victim)
+			session, ok := srv.Session(victim.phone)
+			if !ok {
+				t.Fatalf("Session(%s) not found after authentication", victim.phone)
+			}
+
+			// a new connection with the phone number of the victim is rejected, the victim's session is kept
+			attacker := dialTerminal(t, network, other, victim.phone)
+			expectResult(t, attacker, attacker.send(&jtt.T808_0x0002{}), jtt.ReplyResultFailure)
+			if got, _ := srv.Session(victim.phone); got != session || session.closed() {
+				t.Fatalf("Session(%s) isn't the session of the victim", victim.phone)
+			}
+			expectResult(t, victim, victim.send(&jtt.T808_0x0002{}), jtt.ReplyResultSuccess)
+
+			// with the auth code, the connection is the terminal reconnecting and replaces its previous session
+			expectResult(t, attacker, attacker.send(&jtt.T808_0x0102{AuthCode: authCode}), jtt.ReplyResultSuccess)
+			select {
+			case <-session.Done():
+			case <-time.After(2 * time.Second):
+				t.Fatal("previous session not closed")
+			}
+			if got, _ := srv.Session(victim.phone); got == session {
+				t.Errorf("Session(%s) is the previous session", victim.phone)
+			}
+		})
+	}
+}
+
+// authenticate registers and authenticates the terminal, it returns the auth code.
+func authenticate(t *testing.T, term *terminal) string {
+	t.Helper()
+	term.send(&jtt.T808_0x0100{ManufacturerID: "ABCDE", TerminalModel: "M1", TerminalID: term.phone[4:], PlateNumber: term.phone})
+	registered, ok := term.receive().Body.(*jtt.T808_0x8100)
+	if !ok || registered.Result != jtt.RegisterResultSuccess {
+		t.Fatalf("registration of %s failed", term.phone)
+	}
+	expectResult(t, term, term.send(&jtt.T808_0x0102{AuthCode: registered.AuthCode}), jtt.ReplyResultSuccess)
+	return registered.AuthCode
+}
+
+// expectResult receives the general reply of the message with the header.
+func expectResult(t *testing.T, term *terminal, header *jtt.MsgHeader, result byte) {
+	t.Helper()
+	m := term.receive()
+	if reply, ok := m.Body.(*jtt.T808_0x8001); !ok || *reply != *jtt.NewPlatformReply(header, result) {
+		t.Fatalf("%s received %s %+v, want a general reply with result %d", term.phone, m.Header.MsgID, m.Body, result)
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+
+	"github.com/ryan961/jtt"
+)
+
+// Terminal is a terminal known to the platform.
+type Terminal struct {
+	PhoneNumber    string
+	ManufacturerID string
+	TerminalModel  string
+	TerminalID     string
+	PlateColor     byte
+	PlateNumber    string
+	// AuthCode is issued on registration.
+	AuthCode string
+	// IMEI and SoftwareVersion are reported by 2019 terminals on authentication,
+	// a provisioned IMEI must match the reported one.
+	IMEI            string
+	SoftwareVersion string
+}
+
+// TerminalDirectory is the platform's store of terminals used by AuthFlow. It must be safe for concurrent use.
+type TerminalDirectory interface {
+	// Register registers the terminal with the phone number. It returns the auth code on success or the
+	// rejection result of the 0x8100 reply, jtt.RegisterResultVehicleRegistered to
+	// jtt.RegisterResultTerminalNotFound.
+	Register(ctx context.Context, phoneNumber string, reg *jtt.T808_0x0100) (authCode string, result byte, err error)
+	// Authenticate checks the auth code (and the IMEI of 2019 terminals) of the terminal with the phone number.
+	// It returns an error wrapping ErrAuthFailed if the terminal is rejected.
+	Authenticate(ctx context.Context, phoneNumber string, auth *jtt.T808_0x0102) error
+	// Unregister removes the registration of the terminal with the phone number, e.g. on logout (0x0003).
+	Unregister(ctx context.Context, phoneNumber string) error
+}
+
+// MemoryDirectory is an in-memory TerminalDirectory.
+//
+// Terminals are provisioned by terminal ID with Provision. A provisioned terminal with a plate number only
+// registers with that plate, an open directory also registers terminals that aren't provisioned.
+// A terminal ID or plate number is registered to a single phone number at a time.
+type MemoryDirectory struct {
+	open bool
+
+	mu          sync.RWMutex
+	provisioned map[string]Terminal  // by terminal ID
+	registered  map[string]*Terminal // by phone number
+}
+
+var _ TerminalDirectory = (*MemoryDirectory)(nil)
+
+// NewMemoryDirectory creates an empty directory, an open directory registers any terminal.
+func NewMemoryDirectory(open bool) *MemoryDirectory {
+	return &MemoryDirectory{
+		open:        open,
+		provisioned: make(map[string]Terminal),
+		registered:  make(map[string]*Terminal),
+	}
+}
+
+// Provision adds or replaces a terminal allowed to register, keyed by its TerminalID.
+func (d *MemoryDirectory) Provision(t Terminal) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.provisioned[t.TerminalID] = t
+}
+
+// Terminal returns the registered terminal with the phone number.
+func (d *MemoryDirectory) Terminal(phoneNumber string) (Terminal, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	t, ok := d.registered[phoneNumber]
+	if !ok {
+		return Terminal{}, false
+	}
+	return *t, true
+}
+
+func (d *MemoryDirectory) Register(_ context.Context, phoneNumber string, reg *jtt.T808_0x0100) (string, byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t, ok := d.provisioned[reg.TerminalID]
+	switch {
+	case !ok && !d.open:
+		return "", jtt.RegisterResultTerminalNotFound, nil
+	case ok && t.PlateNumber != "" && (t.PlateNumber != reg.PlateNumber || t.PlateColor != reg.PlateColor):
+		return "", jtt.RegisterResultVehicleNotFound, nil
+	}
+	for phone, other := range d.registered {
+		if phone == phoneNumber {
+			continue
+		}
+		if other.TerminalID == reg.TerminalID {
+			return "", jtt.RegisterResultTerminalRegistered, nil
+		}
+		if reg.PlateNumber != "" && other.PlateNumber == reg.PlateNumber && other.PlateColor == reg.PlateColor {
+			return "", jtt.RegisterResultVehicleRegistered, nil
+		}
+	}
+
+	authCode, err := newAuthCode()
+	if err != nil {
+		return "", 0, err
+	}
+	d.registered[phoneNumber] = &Terminal{
+		PhoneNumber:    phoneNumber,
+		ManufacturerID: reg.ManufacturerID,
+		TerminalModel:  reg.TerminalModel,
+		TerminalID:     reg.TerminalID,
+		PlateColor:     reg.PlateColor,
+		PlateNumber:    reg.PlateNumber,
+		AuthCode:       authCode,
+		IMEI:           t.IMEI,
+	}
+	return authCode, jtt.RegisterResultSuccess, nil
+}
+
+func (d *MemoryDirectory) Authenticate(_ context.Context, phoneNumber string, auth *jtt.T808_0x0102) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.registered[phoneNumber]
+	switch {
+	case !ok:
+		return authError("terminal not registered")
+	case t.AuthCode != auth.AuthCode:
+		return authError("auth code mismatch")
+	case auth.ProtocolVersion() == jtt.Version2019 && t.IMEI != "" && t.IMEI != auth.IMEI:
+		return authError("IMEI mismatch")
+	}
+	if auth.ProtocolVersion() == jtt.Version2019 {
+		t.IMEI, t.SoftwareVersion = auth.IMEI, auth.SoftwareVersion
+	}
+	return nil
+}
+
+func (d *MemoryDirectory) Unregister(_ context.Context, phoneNumber string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.registered, phoneNumber)
+	return nil
+}
+
+// newAuthCode returns a random auth code of 16 hex digits.
+func newAuthCode() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ryan961/jtt"
+)
+
+var (
+	// ErrServerClosed is returned by Serve and ListenAndServe after Shutdown or Close
+	ErrServerClosed = errors.New("server closed")
+	// ErrSessionClosed is returned when writing to a closed session
+	ErrSessionClosed = errors.New("session closed")
+	// ErrNoReply is reported when the terminal didn't answer a message after all its retransmissions
+	ErrNoReply = errors.New("no reply from terminal")
+	// ErrSessionBusy is reported when a message is dropped because the handlers of a UDP session can't keep up
+	ErrSessionBusy = errors.New("session busy")
+	// ErrAuthFailed is returned when a terminal is rejected on authentication (0x0102)
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrNotAuthenticated is returned by AuthFlow for messages of terminals that aren't authenticated
+	ErrNotAuthenticated = errors.New("terminal not authenticated")
+	// ErrPhoneMismatch is the close reason of sessions receiving a message with another phone number than their own
+	ErrPhoneMismatch = errors.New("phone number mismatch")
+	// ErrIdleTimeout is the close reason of sessions without received messages within their idle timeout
+	ErrIdleTimeout = errors.New("session idle timeout")
+	// ErrHandlerPanic is returned by the Recover middleware when a handler panicked
+	ErrHandlerPanic = errors.New("handler panic")
+	// ErrRateLimited is returned by the RateLimit middleware for messages over the rate limit of a terminal
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// ReplyError is the error of a request the terminal answered with a general reply (0x0001) other than success.
+type ReplyError = jtt.ReplyError
+
+func authError(reason string) error {
+	return fmt.Errorf("%w: %s", ErrAuthFailed, reason)
+}
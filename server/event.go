@@ -0,0 +1,81 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is the type of a session lifecycle event.
+type EventType int
+
+const (
+	// EventOnline is fired when a terminal comes online, i.e. its first message is received on a session,
+	// or the session is authenticated if authentication is required (see WithAuthRequired).
+	EventOnline EventType = iota + 1
+	// EventAuthenticated is fired when a session is authenticated, see Session.SetAuthenticated.
+	EventAuthenticated
+	// EventOffline is fired when the session of a terminal is closed, unless a newer session of the
+	// same terminal replaced it.
+	EventOffline
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventOnline:
+		return "online"
+	case EventAuthenticated:
+		return "authenticated"
+	case EventOffline:
+		return "offline"
+	}
+	return "unknown"
+}
+
+// Event is a session lifecycle event.
+type Event struct {
+	Type    EventType
+	Session *Session
+	Time    time.Time
+	// Err is the reason an EventOffline session was closed, e.g. ErrIdleTimeout, nil if the connection was closed.
+	Err error
+}
+
+// subscribers are the functions receiving lifecycle events.
+type subscribers struct {
+	mu   sync.RWMutex
+	next int
+	fns  map[int]func(Event)
+}
+
+// Subscribe registers a function receiving the session lifecycle events (online, authenticated, offline),
+// e.g. to track the status of a fleet. The function is called synchronously and must not block.
+// The returned function cancels the subscription.
+func (s *Server) Subscribe(fn func(Event)) (cancel func()) {
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+	if s.events.fns == nil {
+		s.events.fns = make(map[int]func(Event))
+	}
+	id := s.events.next
+	s.events.next++
+	s.events.fns[id] = fn
+	return func() {
+		s.events.mu.Lock()
+		defer s.events.mu.Unlock()
+		delete(s.events.fns, id)
+	}
+}
+
+func (s *Server) emit(typ EventType, session *Session, err error) {
+	s.events.mu.RLock()
+	fns := make([]func(Event), 0, len(s.events.fns))
+	for _, fn := range s.events.fns {
+		fns = append(fns, fn)
+	}
+	s.events.mu.RUnlock()
+
+	event := Event{Type: typ, Session: session, Time: time.Now(), Err: err}
+	for _, fn := range fns {
+		fn(event)
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ryan961/jtt"
+)
+
+// Request is a decoded message received on a session.
+type Request struct {
+	Session *Session
+	Message *jtt.Message
+
+	replyTo   *jtt.MsgHeader
+	skipReply bool
+}
+
+// SkipReply disables the automatic 0x8001 reply to the message (see WithAutoReply),
+// e.g. when the handler sends a dedicated reply itself.
+func (r *Request) SkipReply() { r.skipReply = true }
+
+// Reply sends the platform general reply (0x8001) with the result to the message and skips the automatic reply.
+// The reply to a segmented message answers the packet that completed it.
+func (r *Request) Reply(result byte) error {
+	r.SkipReply()
+	header := r.replyTo
+	if header == nil {
+		header = r.Message.Header
+	}
+	return r.Session.Send(jtt.NewPlatformReply(header, result))
+}
+
+// Handler handles a message received on a session. Handlers of a session are called sequentially
+// in the order the messages were received, apart from the read loop: the replies answering the requests
+// of the session (see Session.Request) are matched as they're received, handlers may wait for them.
+type Handler interface {
+	ServeMessage(ctx context.Context, req *Request) error
+}
+
+// HandlerFunc adapts an ordinary function to a Handler.
+type HandlerFunc func(ctx context.Context, req *Request) error
+
+func (fn HandlerFunc) ServeMessage(ctx context.Context, req *Request) error {
+	return fn(ctx, req)
+}
+
+// Router dispatches messages to the handler registered for their MsgID. It's safe for concurrent use.
+//
+// Messages without a registered handler go to the not found handler, which returns jtt.ErrMethodNotImplemented
+// by default.
+type Router struct {
+	mu          sync.RWMutex
+	handlers    map[jtt.MsgID]Handler
+	notFound    Handler
+	middlewares []Middleware
+}
+
+// NewRouter creates an empty router.
+func NewRouter() *Router {
+	return &Router{handlers: make(map[jtt.MsgID]Handler)}
+}
+
+// Handle registers the handler for the message ID, a nil handler removes the registration.
+func (r *Router) Handle(msgID jtt.MsgID, handler Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if handler == nil {
+		delete(r.handlers, msgID)
+		return
+	}
+	r.handlers[msgID] = handler
+}
+
+// HandleFunc registers the handler function for the message ID.
+func (r *Router) HandleFunc(msgID jtt.MsgID, fn func(ctx context.Context, req *Request) error) {
+	r.Handle(msgID, HandlerFunc(fn))
+}
+
+// NotFound sets the handler for messages without a registered handler.
+func (r *Router) NotFound(handler Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notFound = handler
+}
+
+// Use appends middlewares wrapping all the handlers of the router, including the not found handler.
+// The first middleware is the outermost one.
+func (r *Router) Use(middlewares ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// Handler returns the handler for the message ID and whether it's registered, without the middlewares.
+func (r *Router) Handler(msgID jtt.MsgID) (Handler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if handler, ok := r.handlers[msgID]; ok {
+		return handler, true
+	}
+	if r.notFound != nil {
+		return r.notFound, false
+	}
+	return notImplemented, false
+}
+
+func (r *Router) ServeMessage(ctx context.Context, req *Request) error {
+	handler, _ := r.Handler(req.Message.Header.MsgID)
+	r.mu.RLock()
+	middlewares := r.middlewares
+	r.mu.RUnlock()
+	return Chain(handler, middlewares...).ServeMessage(ctx, req)
+}
+
+var notImplemented = HandlerFunc(func(context.Context, *Request) error {
+	return jtt.ErrMethodNotImplemented
+})
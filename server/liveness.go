@@ -0,0 +1,65 @@
+package server
+
+import (
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+// DefaultHeartbeatMisses is the default number of missed heartbeat intervals after which a session is closed.
+const DefaultHeartbeatMisses = 3
+
+// HeartbeatInterval returns the heartbeat interval of the terminal, 0 if liveness isn't tracked.
+func (s *Session) HeartbeatInterval() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.heartbeat
+}
+
+// SetHeartbeatInterval sets the heartbeat interval of the terminal, usually the value of ParamHeartbeatInterval.
+// The session is closed with ErrIdleTimeout when no message is received within the server's heartbeat misses
+// (see WithHeartbeat) times the interval. An interval of 0 disables the liveness tracking of the session.
+func (s *Session) SetHeartbeatInterval(interval time.Duration) {
+	s.mu.Lock()
+	s.heartbeat = interval
+	s.mu.Unlock()
+	s.scheduleLiveness(interval)
+}
+
+// scheduleLiveness schedules the next liveness check after d, or stops the checks if d is 0.
+func (s *Session) scheduleLiveness(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d <= 0 || s.closed() {
+		if s.liveness != nil {
+			s.liveness.Stop()
+		}
+		return
+	}
+	if s.liveness == nil {
+		s.liveness = time.AfterFunc(d, s.checkLiveness)
+		return
+	}
+	s.liveness.Reset(d)
+}
+
+// checkLiveness closes the session if the terminal missed too many heartbeats. Otherwise, if enabled,
+// it probes a silent terminal with a link check (0x8204) once per missed interval.
+func (s *Session) checkLiveness() {
+	interval := s.HeartbeatInterval()
+	if interval <= 0 || s.closed() {
+		return
+	}
+	idle := time.Since(s.LastActive())
+	if idle >= interval*time.Duration(s.server.heartbeatMisses) {
+		_ = s.closeWithError(ErrIdleTimeout)
+		return
+	}
+	if s.server.linkProbe && idle >= interval {
+		if err := s.Send(&jtt.T808_0x8204{}); err != nil {
+			s.server.reportError(s, nil, err)
+		}
+	}
+	// next check at the next interval since the last received message
+	s.scheduleLiveness(interval - idle%interval)
+}
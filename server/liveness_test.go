@@ -0,0 +1,61 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+func TestSession_Liveness(t *testing.T) {
+	srv := New(NewRouter(), WithHeartbeat(50*time.Millisecond, 3), WithLinkProbe(true))
+	offline := make(chan Event, 1)
+	srv.Subscribe(func(e Event) {
+		if e.Type == EventOffline {
+			offline <- e
+		}
+	})
+	addr := startServer(t, srv)
+	term := dialTerminal(t, "tcp", addr, "13812345678")
+	term.send(&jtt.T808_0x0002{})
+	waitSession(t, srv, term)
+
+	// the silent terminal is probed before its session is closed
+	if m := term.receive(); m.Header.MsgID != jtt.MsgT808_0x8204 {
+		t.Fatalf("received %s, want %s", m.Header.MsgID, jtt.MsgT808_0x8204)
+	}
+	select {
+	case e := <-offline:
+		if !errors.Is(e.Err, ErrIdleTimeout) || e.Session.PhoneNumber() != term.phone {
+			t.Errorf("offline event = %+v, want %v of %s", e, ErrIdleTimeout, term.phone)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("session not closed")
+	}
+	if _, ok := srv.Session(term.phone); ok {
+		t.Errorf("Session(%s) found after the idle timeout", term.phone)
+	}
+}
+
+func TestSession_ApplyParamsHeartbeat(t *testing.T) {
+	srv := New(NewRouter())
+	addr := startServer(t, srv)
+	term := dialTerminal(t, "tcp", addr, "13812345678")
+	term.send(&jtt.T808_0x0002{})
+	waitSession(t, srv, term)
+	session, _ := srv.Session(term.phone)
+
+	if got := session.HeartbeatInterval(); got != 0 {
+		t.Fatalf("HeartbeatInterval() = %v, want 0", got)
+	}
+	// the interval read back by 0x0104
+	term.send(&jtt.T808_0x0104{Params: []*jtt.Param{(&jtt.Param{}).SetHeartbeatInterval(30)}})
+	deadline := time.Now().Add(2 * time.Second)
+	for session.HeartbeatInterval() != 30*time.Second {
+		if time.Now().After(deadline) {
+			t.Fatalf("HeartbeatInterval() = %v, want %v", session.HeartbeatInterval(), 30*time.Second)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+// Middleware wraps a Handler with a cross-cutting concern, e.g. logging or rate limiting.
+type Middleware func(Handler) Handler
+
+// Chain wraps the handler with the middlewares, the first middleware is the outermost one.
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Recover returns a middleware recovering from panics of the handler. The message is answered with a
+// failure (0x8001) and the panic is returned as an error wrapping ErrHandlerPanic, with the stack trace.
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *Request) (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					err = fmt.Errorf("%w: %v\n%s", ErrHandlerPanic, p, debug.Stack())
+					if answeredByGeneralReply(req.Message.Header.MsgID) {
+						_ = req.Reply(jtt.ReplyResultFailure)
+					}
+				}
+			}()
+			return next.ServeMessage(ctx, req)
+		})
+	}
+}
+
+// Logger returns a middleware logging each message once handled: the header fields (message ID, phone number,
+// serial number, protocol version and, for reassembled messages, the segment count), the duration and the error.
+// Messages are logged at slog.LevelInfo, or slog.LevelError if the handler failed.
+func Logger(logger *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *Request) error {
+			start := time.Now()
+			err := next.ServeMessage(ctx, req)
+
+			header := req.Message.Header
+			attrs := []slog.Attr{
+				slog.String("session", req.Session.ID()),
+				slog.String("msgID", header.MsgID.String()),
+				slog.String("phone", header.PhoneNumber),
+				slog.Int("serial", int(header.SerialNumber)),
+				slog.String("version", header.Version.String()),
+			}
+			if req.replyTo != nil && req.replyTo.SegmentInfo != nil {
+				attrs = append(attrs, slog.Int("segments", int(req.replyTo.SegmentInfo.Total)))
+			}
+			attrs = append(attrs, slog.Duration("duration", time.Since(start)))
+			level := slog.LevelInfo
+			if err != nil {
+				level = slog.LevelError
+				attrs = append(attrs, slog.Any("error", err))
+			}
+			logger.LogAttrs(ctx, level, "message handled", attrs...)
+			return err
+		})
+	}
+}
+
+// RateLimit returns a middleware limiting the rate of messages per terminal with a token bucket refilled with
+// rate tokens per second up to burst tokens. Only the messages with the IDs are limited, all messages if none
+// is given. Messages over the limit are rejected with ErrRateLimited without calling the handler.
+//
+// Buckets are kept by phone number, a terminal reconnecting keeps its bucket. The bucket of a session whose
+// phone number is unknown is kept by the session. Buckets refilled up to burst are dropped as they're idle.
+func RateLimit(rate float64, burst int, msgIDs ...jtt.MsgID) Middleware {
+	limited := make(map[jtt.MsgID]bool, len(msgIDs))
+	for _, msgID := range msgIDs {
+		limited[msgID] = true
+	}
+	limiter := &rateLimiter{rate: rate, burst: burst, buckets: make(map[string]*tokenBucket)}
+	key := new(int) // unique session value key of the middleware
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *Request) error {
+			if len(limited) > 0 && !limited[req.Message.Header.MsgID] {
+				return next.ServeMessage(ctx, req)
+			}
+			now := time.Now()
+			var bucket *tokenBucket
+			if phone := req.Session.PhoneNumber(); phone != "" {
+				bucket = limiter.bucket(phone, now)
+			} else {
+				value, _ := req.Session.values.LoadOrStore(key, &tokenBucket{tokens: float64(burst), last: now})
+				bucket = value.(*tokenBucket)
+			}
+			if !bucket.allow(rate, burst, now) {
+				return fmt.Errorf("%s from %s: %w", req.Message.Header.MsgID, req.Session.PhoneNumber(), ErrRateLimited)
+			}
+			return next.ServeMessage(ctx, req)
+		})
+	}
+}
+
+// rateLimitSweepInterval is the interval at which RateLimit drops the idle buckets.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimiter is the token buckets of RateLimit by phone number.
+type rateLimiter struct {
+	rate  float64
+	burst int
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+func (l *rateLimiter) bucket(phone string, now time.Time) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[phone]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.burst), last: now}
+		l.buckets[phone] = b
+	}
+	return b
+}
+
+// sweep drops the buckets refilled up to burst, they're the same as new ones.
+func (l *rateLimiter) sweep(now time.Time) {
+	l.swept = now
+	for phone, b := range l.buckets {
+		if b.full(l.rate, l.burst, now) {
+			delete(l.buckets, phone)
+		}
+	}
+}
+
+// tokenBucket is the rate limiting state of a terminal.
+type tokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) allow(rate float64, burst int, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *tokenBucket) full(rate float64, burst int, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens+now.Sub(b.last).Seconds()*rate >= float64(burst)
+}
+
+// Latency returns a middleware measuring the duration of the handler of each message,
+// observe is called with the message ID, the duration and the error of the handler.
+func Latency(observe func(msgID jtt.MsgID, d time.Duration, err error)) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *Request) error {
+			start := time.Now()
+			err := next.ServeMessage(ctx, req)
+			observe(req.Message.Header.MsgID, time.Since(start), err)
+			return err
+		})
+	}
+}
+
+// LatencyStats are the handler latency statistics of a message ID.
+type LatencyStats struct {
+	Count  uint64
+	Errors uint64
+	Total  time.Duration
+	Max    time.Duration
+}
+
+// Mean returns the mean latency.
+func (s LatencyStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// LatencyRecorder records the handler latency statistics per message ID, use its Observe method with Latency.
+// It's safe for concurrent use.
+type LatencyRecorder struct {
+	mu    sync.Mutex
+	stats map[jtt.MsgID]*LatencyStats
+}
+
+// NewLatencyRecorder creates an empty recorder.
+func NewLatencyRecorder() *LatencyRecorder {
+	return &LatencyRecorder{stats: make(map[jtt.MsgID]*LatencyStats)}
+}
+
+// Observe records the latency of a handled message.
+func (r *LatencyRecorder) Observe(msgID jtt.MsgID, d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats, ok := r.stats[msgID]
+	if !ok {
+		stats = &LatencyStats{}
+		r.stats[msgID] = stats
+	}
+	stats.Count++
+	if err != nil {
+		stats.Errors++
+	}
+	stats.Total += d
+	stats.Max = max(stats.Max, d)
+}
+
+// Stats returns a snapshot of the statistics per message ID.
+func (r *LatencyRecorder) Stats() map[jtt.MsgID]LatencyStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := make(map[jtt.MsgID]LatencyStats, len(r.stats))
+	for msgID, s := range r.stats {
+		stats[msgID] = *s
+	}
+	return stats
+}
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+// recordTransport records the frames written to a session.
+type recordTransport struct {
+	mu     sync.Mutex
+	frames [][]byte
+}
+
+func (t *recordTransport) write(frames [][]byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.frames = append(t.frames, frames...)
+	return nil
+}
+
+func (t *recordTransport) stopReading() {}
+
+func (t *recordTransport) close() error { return nil }
+
+func (t *recordTransport) messages(tb testing.TB) []*jtt.Message {
+	tb.Helper()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	messages := make([]*jtt.Message, 0, len(t.frames))
+	for _, frame := range t.frames {
+		m, err := jtt.DecodeMessage(frame)
+		if err != nil {
+			tb.Fatalf("decode: %v", err)
+		}
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+// newTestRequest creates a request of a session writing to the returned transport.
+func newTestRequest(srv *Server, body jtt.Msg) (*Request, *recordTransport) {
+	t := &recordTransport{}
+	session := newSession(srv, "tcp", t, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 6808})
+	header := &jtt.MsgHeader{MsgID: body.MsgID(), PhoneNumber: "13812345678", SerialNumber: 7}
+	session.observe(header)
+	return &Request{Session: session, Message: &jtt.Message{Header: header, Body: body}}, t
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, req *Request) error {
+				calls = append(calls, name)
+				return next.ServeMessage(ctx, req)
+			})
+		}
+	}
+	router := NewRouter()
+	router.Use(trace("first"), trace("second"))
+	router.HandleFunc(jtt.MsgT808_0x0002, func(ctx context.Context, req *Request) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+
+	req, _ := newTestRequest(New(router), &jtt.T808_0x0002{})
+	if err := router.ServeMessage(context.Background(), req); err != nil {
+		t.Fatalf("ServeMessage: %v", err)
+	}
+	if got := strings.Join(calls, ","); got != "first,second,handler" {
+		t.Errorf("calls = %s, want first,second,handler", got)
+	}
+
+	// the not found handler is wrapped too
+	calls = nil
+	req, _ = newTestRequest(New(router), &jtt.T808_0x0200{})
+	if err := router.ServeMessage(context.Background(), req); !errors.Is(err, jtt.ErrMethodNotImplemented) {
+		t.Fatalf("ServeMessage = %v, want %v", err, jtt.ErrMethodNotImplemented)
+	}
+	if got := strings.Join(calls, ","); got != "first,second" {
+		t.Errorf("calls = %s, want first,second", got)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	handler := Chain(HandlerFunc(func(ctx context.Context, req *Request) error {
+		panic("boom")
+	}), Recover())
+	req, transport := newTestRequest(New(NewRouter()), &jtt.T808_0x0200{})
+
+	err := handler.ServeMessage(context.Background(), req)
+	if !errors.Is(err, ErrHandlerPanic) || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("ServeMessage = %v, want %v", err, ErrHandlerPanic)
+	}
+	messages := transport.messages(t)
+	if len(messages) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(messages))
+	}
+	reply, ok := messages[0].Body.(*jtt.T808_0x8001)
+	if !ok || *reply != *jtt.NewPlatformReply(req.Message.Header, jtt.ReplyResultFailure) {
+		t.Errorf("sent %s %+v, want a failure reply", messages[0].Header.MsgID, messages[0].Body)
+	}
+	if !req.skipReply {
+		t.Error("automatic reply not skipped")
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	handler := Chain(HandlerFunc(func(ctx context.Context, req *Request) error {
+		return errors.New("storage unavailable")
+	}), Logger(logger))
+	req, _ := newTestRequest(New(NewRouter()), &jtt.T808_0x0200{})
+	req.replyTo = &jtt.MsgHeader{SegmentInfo: &jtt.SegmentInfo{Total: 3, Index: 3}}
+
+	_ = handler.ServeMessage(context.Background(), req)
+	for _, want := range []string{
+		"level=ERROR", "msgID=" + jtt.MsgT808_0x0200.String(), "phone=13812345678", "serial=7",
+		"version=2013", "segments=3", `error="storage unavailable"`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log %q doesn't contain %q", buf.String(), want)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	handler := Chain(HandlerFunc(func(ctx context.Context, req *Request) error { return nil }),
+		RateLimit(0, 2, jtt.MsgT808_0x0200))
+	srv := New(NewRouter())
+	location, _ := newTestRequest(srv, &jtt.T808_0x0200{})
+	heartbeat := &Request{Session: location.Session, Message: &jtt.Message{
+		Header: &jtt.MsgHeader{MsgID: jtt.MsgT808_0x0002},
+		Body:   &jtt.T808_0x0002{},
+	}}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := handler.ServeMessage(ctx, location); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	if err := handler.ServeMessage(ctx, location); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("ServeMessage over the burst = %v, want %v", err, ErrRateLimited)
+	}
+	if err := handler.ServeMessage(ctx, heartbeat); err != nil {
+		t.Errorf("ServeMessage of an unlimited message = %v", err)
+	}
+	// buckets are per terminal, the new session of the same terminal shares its bucket
+	reconnected, _ := newTestRequest(srv, &jtt.T808_0x0200{})
+	if err := handler.ServeMessage(ctx, reconnected); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("ServeMessage after reconnecting = %v, want %v", err, ErrRateLimited)
+	}
+	other, _ := newTestRequest(srv, &jtt.T808_0x0200{})
+	other.Session = newSession(srv, "tcp", &recordTransport{}, other.Session.RemoteAddr())
+	other.Message.Header.PhoneNumber = "13812345679"
+	other.Session.observe(other.Message.Header)
+	if err := handler.ServeMessage(ctx, other); err != nil {
+		t.Errorf("ServeMessage of another terminal = %v", err)
+	}
+}
+
+func TestRateLimit_Reconnect(t *testing.T) {
+	handled := make(chan struct{}, 3)
+	errs := make(chan error, 3)
+	router := NewRouter()
+	router.Use(RateLimit(0, 2, jtt.MsgT808_0x0200))
+	router.HandleFunc(jtt.MsgT808_0x0200, func(ctx context.Context, req *Request) error {
+		handled <- struct{}{}
+		return nil
+	})
+	srv := New(router, WithErrorHandler(func(session *Session, m *jtt.Message, err error) {
+		errs <- err
+	}))
+	addr := startServer(t, srv)
+
+	for i := 0; i < 2; i++ {
+		term := dialTerminal(t, "tcp", addr, "13812345678")
+		term.send(&jtt.T808_0x0200{})
+		select {
+		case <-handled:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("message %d not handled", i)
+		}
+		_ = term.conn.Close()
+	}
+
+	term := dialTerminal(t, "tcp", addr, "13812345678")
+	term.send(&jtt.T808_0x0200{})
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrRateLimited) {
+			t.Errorf("error = %v, want %v", err, ErrRateLimited)
+		}
+	case <-handled:
+		t.Error("message over the burst handled after reconnecting")
+	case <-time.After(2 * time.Second):
+		t.Fatal("message over the burst not rejected")
+	}
+}
+
+func TestRateLimiter_Sweep(t *testing.T) {
+	now := time.Now()
+	l := &rateLimiter{rate: 0.01, burst: 2, buckets: make(map[string]*tokenBucket), swept: now}
+	l.bucket("13812345678", now)
+	l.bucket("13812345679", now).allow(l.rate, l.burst, now)
+
+	// the bucket without messages is full, the other one is refilled after 100s
+	l.bucket("13812345680", now.Add(rateLimitSweepInterval))
+	if _, ok := l.buckets["13812345678"]; ok {
+		t.Error("full bucket not dropped")
+	}
+	if _, ok := l.buckets["13812345679"]; !ok {
+		t.Error("bucket refilling dropped")
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := &tokenBucket{tokens: 1, last: now}
+	if !b.allow(10, 1, now) || b.allow(10, 1, now) {
+		t.Fatal("bucket of 1 token allowed != 1 message")
+	}
+	if !b.allow(10, 1, now.Add(100*time.Millisecond)) {
+		t.Error("bucket not refilled after 1/rate")
+	}
+}
+
+func TestLatency(t *testing.T) {
+	recorder := NewLatencyRecorder()
+	handler := Chain(HandlerFunc(func(ctx context.Context, req *Request) error {
+		if req.Message.Header.MsgID == jtt.MsgT808_0x0200 {
+			return errors.New("failed")
+		}
+		return nil
+	}), Latency(recorder.Observe))
+	srv := New(NewRouter())
+	for _, body := range []jtt.Msg{&jtt.T808_0x0002{}, &jtt.T808_0x0002{}, &jtt.T808_0x0200{}} {
+		req, _ := newTestRequest(srv, body)
+		_ = handler.ServeMessage(context.Background(), req)
+	}
+
+	stats := recorder.Stats()
+	if s := stats[jtt.MsgT808_0x0002]; s.Count != 2 || s.Errors != 0 || s.Max > s.Total || s.Mean() > s.Max {
+		t.Errorf("0x0002 stats = %+v", s)
+	}
+	if s := stats[jtt.MsgT808_0x0200]; s.Count != 1 || s.Errors != 1 {
+		t.Errorf("0x0200 stats = %+v", s)
+	}
+}
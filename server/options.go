@@ -0,0 +1,168 @@
+package server
+
+import (
+	"time"
+
+	"github.com/ryan961/jtt"
+	"github.com/ryan961/jtt/segment"
+)
+
+type Option func(s *Server)
+
+// WithCodec sets the codec used to decode received frames and encode sent messages.
+//
+// By default, the codec is jtt.NewCodec().
+func WithCodec(codec *jtt.Codec) Option {
+	return func(s *Server) {
+		s.codec = codec
+	}
+}
+
+// WithSerialGenerator sets the generator of serial numbers for sent messages, keyed by phone number.
+//
+// By default, the generator is jtt.NewMemorySerialGenerator().
+func WithSerialGenerator(serials jtt.SerialGenerator) Option {
+	return func(s *Server) {
+		s.serials = serials
+	}
+}
+
+// WithSegmentPool sets the pool used to reassemble segmented messages, the pool is not closed by the server.
+//
+// By default, the server creates a segment.NewPool() and closes it on shutdown.
+func WithSegmentPool(pool *segment.Pool) Option {
+	return func(s *Server) {
+		s.segments = pool
+	}
+}
+
+// WithMaxFrameSize sets the maximum size of a received frame, see jtt.WithMaxFrameSize.
+//
+// By default, the max frame size is jtt.DefaultMaxFrameSize.
+func WithMaxFrameSize(size int) Option {
+	return func(s *Server) {
+		s.maxFrameSize = size
+	}
+}
+
+// WithWriteTimeout sets the timeout of writing a message to a terminal.
+//
+// By default, the write timeout is 10 * time.Second.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.writeTimeout = timeout
+	}
+}
+
+// WithTCPRetryPolicy sets the default retransmission schedule of the requests sent on TCP sessions,
+// see Session.SetRetryPolicy and Session.ApplyParams to change it per terminal.
+//
+// By default, the policy is DefaultTCPRetryPolicy.
+func WithTCPRetryPolicy(policy RetryPolicy) Option {
+	return func(s *Server) {
+		s.tcpRetry = policy
+	}
+}
+
+// WithUDPRetryPolicy sets the default retransmission schedule of UDP sessions,
+// see Session.SetRetryPolicy and Session.ApplyParams to change it per terminal.
+//
+// By default, the policy is DefaultUDPRetryPolicy.
+func WithUDPRetryPolicy(policy RetryPolicy) Option {
+	return func(s *Server) {
+		s.udpRetry = policy
+	}
+}
+
+// WithUDPIdleTimeout sets the duration after which a UDP session without received messages is closed.
+//
+// By default, the idle timeout is 5 * time.Minute.
+func WithUDPIdleTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.udpIdle = timeout
+	}
+}
+
+// WithAutoReply enables the automatic platform general reply (0x8001) to terminal messages once their handler
+// returns, with the result mapped from the handler's error by jtt.ReplyResult. Messages that can't be decoded
+// are answered with jtt.ReplyResultInvalid and each packet of a segmented message is acknowledged.
+//
+// Terminal replies (0x0001, 0x0104, ...) and messages with a dedicated platform reply (0x0100, 0x0801, ...)
+// aren't answered, handlers can skip the reply of other messages with Request.SkipReply.
+//
+// By default, auto reply is disabled.
+func WithAutoReply(enabled bool) Option {
+	return func(s *Server) {
+		s.autoReply = enabled
+	}
+}
+
+// WithAuthRequired sets whether sessions are indexed by phone number only once authenticated
+// (see Session.SetAuthenticated): found by Server.Session, reported online and replacing the previous
+// session of the terminal. Either way, an unauthenticated session never replaces an authenticated one.
+//
+// By default, authentication is required if the handler of the server is an *AuthFlow.
+// Enable it when the AuthFlow is wrapped, e.g. by Chain.
+func WithAuthRequired(required bool) Option {
+	return func(s *Server) {
+		s.authRequired = required
+	}
+}
+
+// WithHeartbeat sets the default heartbeat interval of terminals and the number of missed intervals after
+// which a session without received messages is closed with ErrIdleTimeout. The interval of a terminal
+// follows its ParamHeartbeatInterval, see Session.ApplyParams and Session.SetHeartbeatInterval.
+//
+// By default, the interval is 0 (liveness is only tracked for terminals with a known heartbeat interval)
+// and misses is DefaultHeartbeatMisses.
+func WithHeartbeat(interval time.Duration, misses int) Option {
+	return func(s *Server) {
+		s.heartbeat = interval
+		if misses > 0 {
+			s.heartbeatMisses = misses
+		}
+	}
+}
+
+// WithLinkProbe enables sending a link check (0x8204) to terminals silent for a heartbeat interval,
+// once per missed interval, before their session is closed.
+//
+// By default, link probes are disabled.
+func WithLinkProbe(enabled bool) Option {
+	return func(s *Server) {
+		s.linkProbe = enabled
+	}
+}
+
+// WithErrorHandler sets the function called with the errors of a session: frames that can't be decoded,
+// rejected segment packets, errors returned by handlers and messages left unanswered by the terminal.
+// m is nil if the header couldn't be decoded, session is also nil for such UDP datagrams.
+//
+// By default, errors are ignored.
+func WithErrorHandler(fn func(session *Session, m *jtt.Message, err error)) Option {
+	return func(s *Server) {
+		s.onError = fn
+	}
+}
+
+// WithDiscardHandler sets the function called with the data discarded while splitting received frames,
+// e.g. garbage between frames or frames with a bad checksum, see jtt.WithDiscardReasonHandler.
+// session is nil for UDP datagrams, data is only valid during the call.
+//
+// By default, discarded data is ignored.
+func WithDiscardHandler(fn func(session *Session, reason jtt.DiscardReason, data []byte)) Option {
+	return func(s *Server) {
+		s.onDiscard = fn
+	}
+}
+
+// WithDecodeErrorHandler sets the function called with the frames that can't be decoded, before they're
+// reported to the error handler. Messages without a registered body type aren't decode errors.
+// session is nil for UDP datagrams whose header couldn't be decoded, frame is only valid during the call.
+//
+// By default, decode errors are only reported to the error handler.
+func WithDecodeErrorHandler(fn func(session *Session, frame []byte, err error)) Option {
+	return func(s *Server) {
+		s.onDecodeError = fn
+	}
+}
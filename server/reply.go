@@ -0,0 +1,73 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/ryan961/jtt"
+)
+
+// reply sends the automatic platform general reply to the message with the header, see WithAutoReply.
+func (s *Server) reply(session *Session, header *jtt.MsgHeader, result byte) {
+	if !s.autoReply || !answeredByGeneralReply(header.MsgID) {
+		return
+	}
+	reply := &jtt.Message{Body: jtt.NewPlatformReply(header, result)}
+	if err := session.Write(reply); err != nil && !errors.Is(err, ErrSessionClosed) {
+		s.reportError(session, reply, err)
+	}
+}
+
+// replySerialNumber returns the serial number of the message a terminal reply answers.
+func replySerialNumber(body jtt.Msg) (uint16, bool) {
+	switch body := body.(type) {
+	case *jtt.T808_0x0001:
+		return body.ReplyMsgSerialNo, true
+	case *jtt.T808_0x0104:
+		return body.ReplyMsgSerialNo, true
+	case *jtt.T808_0x0201:
+		return body.ReplyMsgSerialNo, true
+	case *jtt.T808_0x0302:
+		return body.RespSerialNo, true
+	case *jtt.T808_0x0500:
+		return body.ReplyMsgSerialNo, true
+	case *jtt.T808_0x0700:
+		return body.ReplyMsgSerialNo, true
+	case *jtt.T808_0x0802:
+		return body.ReplyMsgSerialNo, true
+	case *jtt.T808_0x0805:
+		return body.ReplyMsgSerialNo, true
+	case *jtt.T808_0x0E11:
+		return body.ReplyMsgSerialNo, true
+	case *jtt.T1078_0x1205:
+		return body.ReplyMsgSerialNo, true
+	}
+	return 0, false
+}
+
+// expectsReply reports whether the terminal is expected to answer a platform message,
+// platform replies to terminal messages aren't answered.
+func expectsReply(body jtt.Msg) bool {
+	switch body.MsgID() {
+	case jtt.MsgT808_0x8001, jtt.MsgT808_0x8003, jtt.MsgT808_0x8100, jtt.MsgT808_0x8800:
+		return false
+	}
+	return true
+}
+
+// answeredByGeneralReply reports whether the platform answers a terminal message with a general reply (0x8001).
+// Terminal replies aren't answered and some messages have a dedicated platform reply.
+func answeredByGeneralReply(msgID jtt.MsgID) bool {
+	switch msgID {
+	case jtt.MsgT808_0x0001, jtt.MsgT808_0x0104, jtt.MsgT808_0x0107, jtt.MsgT808_0x0201, jtt.MsgT808_0x0302,
+		jtt.MsgT808_0x0500, jtt.MsgT808_0x0700, jtt.MsgT808_0x0802, jtt.MsgT808_0x0805, jtt.MsgT808_0x0E11,
+		jtt.MsgT1078_0x1205:
+		return false
+	case jtt.MsgT808_0x0005: // answered by retransmitting the packets
+		return false
+	case jtt.MsgT808_0x0100: // 0x8100
+		return false
+	case jtt.MsgT808_0x0801: // 0x8800
+		return false
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ryan961/jtt"
+)
+
+func TestServer_AutoReply(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc(jtt.MsgT808_0x0002, func(ctx context.Context, req *Request) error { return nil })
+	router.HandleFunc(jtt.MsgT808_0x0200, func(ctx context.Context, req *Request) error {
+		return errors.New("storage unavailable")
+	})
+	router.HandleFunc(jtt.MsgT808_0x0100, func(ctx context.Context, req *Request) error { return nil })
+	router.HandleFunc(jtt.MsgT808_0x0900, func(ctx context.Context, req *Request) error { return nil })
+	router.HandleFunc(jtt.MsgT808_0x0102, func(ctx context.Context, req *Request) error {
+		req.SkipReply()
+		return req.Session.Send(jtt.NewPlatformReply(req.Message.Header, jtt.ReplyResultAlarmConfirmed))
+	})
+	srv := New(router, WithAutoReply(true))
+	addr := startServer(t, srv)
+	term := dialTerminal(t, "tcp", addr, "13812345678")
+
+	expectReply := func(header *jtt.MsgHeader, result byte) {
+		t.Helper()
+		m := term.receive()
+		reply, ok := m.Body.(*jtt.T808_0x8001)
+		if !ok {
+			t.Fatalf("received %s, want %s", m.Header.MsgID, jtt.MsgT808_0x8001)
+		}
+		want := jtt.NewPlatformReply(header, result)
+		if *reply != *want {
+			t.Fatalf("reply = %+v, want %+v", reply, want)
+		}
+	}
+
+	expectReply(term.send(&jtt.T808_0x0002{}), jtt.ReplyResultSuccess)
+	expectReply(term.send(&jtt.T808_0x0200{}), jtt.ReplyResultFailure)
+	expectReply(term.send(&jtt.RawMsg{ID: 0x0F01, Data: []byte{1}}), jtt.ReplyResultUnsupported)
+	expectReply(term.send(&jtt.RawMsg{ID: jtt.MsgT808_0x0200, Data: []byte{1, 2, 3}}), jtt.ReplyResultInvalid)
+	expectReply(term.send(&jtt.T808_0x0102{AuthCode: "auth"}), jtt.ReplyResultAlarmConfirmed)
+
+	// 0x0100 is answered by 0x8100, not by the general reply
+	term.send(&jtt.T808_0x0100{ManufacturerID: "ABCDE", TerminalModel: "M1", TerminalID: "T1", PlateNumber: "A12345"})
+	expectReply(term.send(&jtt.T808_0x0002{}), jtt.ReplyResultSuccess)
+
+	// each packet of a segmented message is acknowledged
+	m := &jtt.Message{Header: term.header(), Body: &jtt.T808_0x0900{TransparentMsgContent: bytes.Repeat([]byte{0xAA}, 2500)}}
+	var headers []*jtt.MsgHeader
+	frames, err := m.EncodeSegments(0, func() uint16 {
+		term.serial++
+		headers = append(headers, &jtt.MsgHeader{MsgID: jtt.MsgT808_0x0900, SerialNumber: term.serial})
+		return term.serial
+	})
+	if err != nil {
+		t.Fatalf("EncodeSegments: %v", err)
+	}
+	term.write(frames...)
+	for _, header := range headers {
+		expectReply(header, jtt.ReplyResultSuccess)
+	}
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+// responses are the terminal messages answering platform messages, other messages are answered by 0x0001.
+var responses = map[jtt.MsgID]jtt.MsgID{
+	jtt.MsgT808_0x8104:  jtt.MsgT808_0x0104,
+	jtt.MsgT808_0x8106:  jtt.MsgT808_0x0104,
+	jtt.MsgT808_0x8107:  jtt.MsgT808_0x0107,
+	jtt.MsgT808_0x8201:  jtt.MsgT808_0x0201,
+	jtt.MsgT808_0x8302:  jtt.MsgT808_0x0302,
+	jtt.MsgT808_0x8500:  jtt.MsgT808_0x0500,
+	jtt.MsgT808_0x8608:  jtt.MsgT808_0x0608,
+	jtt.MsgT808_0x8700:  jtt.MsgT808_0x0700,
+	jtt.MsgT808_0x8702:  jtt.MsgT808_0x0702,
+	jtt.MsgT808_0x8801:  jtt.MsgT808_0x0805,
+	jtt.MsgT808_0x8802:  jtt.MsgT808_0x0802,
+	jtt.MsgT808_0x8E11:  jtt.MsgT808_0x0E11,
+	jtt.MsgT808_0x8E12:  jtt.MsgT808_0x0E12,
+	jtt.MsgT1078_0x9205: jtt.MsgT1078_0x1205,
+}
+
+// ResponseMsgID returns the ID of the terminal message answering a platform message,
+// e.g. 0x0104 for 0x8104, or 0x0001 for messages answered by the terminal general reply.
+func ResponseMsgID(msgID jtt.MsgID) jtt.MsgID {
+	if response, ok := responses[msgID]; ok {
+		return response
+	}
+	return jtt.MsgT808_0x0001
+}
+
+// pending is a sent message waiting for the reply of the terminal.
+type pending struct {
+	m        *jtt.Message
+	frames   [][]byte
+	last     uint16 // serial number of the last packet, answered by the terminal
+	response jtt.MsgID
+	sentAt   time.Time
+	count    int  // retransmissions
+	acked    bool // acknowledged by 0x0001, waiting for the response
+	timer    *time.Timer
+	done     chan result // nil if nobody waits for the reply
+}
+
+type result struct {
+	m   *jtt.Message
+	err error
+}
+
+func newPending(m *jtt.Message, frames [][]byte, last uint16, done chan result) *pending {
+	return &pending{m: m, frames: frames, last: last, response: ResponseMsgID(m.Header.MsgID), sentAt: time.Now(), done: done}
+}
+
+// Request sends a message to the terminal and waits for its reply: the response expected for the message ID
+// (see ResponseMsgID) or the terminal general reply (0x0001). A general reply other than success ends the
+// request with a *ReplyError, while a successful one keeps waiting for the response of messages that have one.
+//
+// The reply is matched on its reply serial number, that of the last packet of a segmented message, or on its
+// message ID for responses without one (0x0107, 0x0608, 0x0702). The message is retransmitted following the
+// session's RetryPolicy, Request returns ErrNoReply once it's exhausted.
+//
+// Replies are read while the handlers of the session run, a handler may wait for the reply of its own session.
+// A TCP session stops reading while its queue of received messages is full (e.g. a terminal sending many
+// messages meanwhile), the request may then end with ErrNoReply.
+func (s *Session) Request(ctx context.Context, msg jtt.Msg) (*jtt.Message, error) {
+	m := &jtt.Message{Header: &jtt.MsgHeader{}, Body: msg}
+	frames, last, err := s.encode(m)
+	if err != nil {
+		return nil, err
+	}
+	p := newPending(m, frames, last, make(chan result, 1))
+	s.track(p)
+	defer s.untrack(p)
+	if err := s.writeFrames(frames); err != nil {
+		return nil, err
+	}
+
+	select {
+	case r := <-p.done:
+		return r.m, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.done:
+		return nil, ErrSessionClosed
+	}
+}
+
+// track registers the pending message and schedules its retransmissions.
+// InFlight returns the number of sent messages waiting for the reply of the terminal.
+func (s *Session) InFlight() int {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	return len(s.pending)
+}
+
+func (s *Session) track(p *pending) {
+	policy := s.RetryPolicy()
+	serial := p.last
+
+	s.pendingMu.Lock()
+	previous := s.pending[serial]
+	if previous != nil {
+		previous.stop()
+	}
+	s.pending[serial] = p
+	if policy.Timeout > 0 {
+		p.timer = time.AfterFunc(policy.TimeoutAfter(0), func() { s.timeout(serial, p) })
+	}
+	s.pendingMu.Unlock()
+
+	if previous != nil {
+		// the serial number wrapped around before the terminal answered
+		s.finish(previous, nil, ErrNoReply)
+	}
+}
+
+func (s *Session) untrack(p *pending) {
+	serial := p.last
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	if s.pending[serial] == p {
+		p.stop()
+		delete(s.pending, serial)
+	}
+}
+
+// timeout retransmits the pending message, or gives up after the retry policy's times.
+func (s *Session) timeout(serial uint16, p *pending) {
+	policy := s.RetryPolicy()
+	s.pendingMu.Lock()
+	if s.pending[serial] != p {
+		s.pendingMu.Unlock()
+		return
+	}
+	if p.count >= policy.Times {
+		delete(s.pending, serial)
+		s.pendingMu.Unlock()
+		s.finish(p, nil, ErrNoReply)
+		return
+	}
+	p.count++
+	p.timer.Reset(policy.TimeoutAfter(p.count))
+	acked := p.acked
+	s.pendingMu.Unlock()
+
+	if acked {
+		return
+	}
+	if err := s.writeFrames(p.frames); err != nil {
+		s.server.reportError(s, p.m, err)
+	}
+}
+
+// acknowledge completes the pending message answered by the terminal message m.
+func (s *Session) acknowledge(m *jtt.Message) {
+	serial, ok := replySerialNumber(m.Body)
+	s.pendingMu.Lock()
+	var p *pending
+	if ok {
+		p = s.pending[serial]
+	} else {
+		serial, p = s.awaiting(m.Header.MsgID)
+	}
+	if p == nil {
+		s.pendingMu.Unlock()
+		return
+	}
+
+	var err error
+	if ack, isAck := m.Body.(*jtt.T808_0x0001); isAck {
+		err = jtt.ReplyResultError(ack.ReplyMsgID, ack.Result)
+		switch {
+		case ack.ReplyMsgID != p.m.Header.MsgID:
+			p = nil
+		case err != nil:
+		case p.response != jtt.MsgT808_0x0001:
+			p.acked = true
+			p = nil
+		}
+	} else if m.Header.MsgID != p.response {
+		p = nil
+	}
+	if p == nil {
+		s.pendingMu.Unlock()
+		return
+	}
+	p.stop()
+	delete(s.pending, serial)
+	s.pendingMu.Unlock()
+
+	if params, ok := p.m.Body.(*jtt.T808_0x8103); ok && err == nil {
+		s.ApplyParams(params.Params)
+	}
+	s.finish(p, m, err)
+}
+
+// awaiting returns the oldest pending message expecting a response with the message ID.
+func (s *Session) awaiting(response jtt.MsgID) (uint16, *pending) {
+	var (
+		serial uint16
+		oldest *pending
+	)
+	for k, p := range s.pending {
+		if p.response == response && (oldest == nil || p.sentAt.Before(oldest.sentAt)) {
+			serial, oldest = k, p
+		}
+	}
+	return serial, oldest
+}
+
+// finish delivers the reply of a completed pending message, errors without a waiting request are reported.
+func (s *Session) finish(p *pending, m *jtt.Message, err error) {
+	if p.done != nil {
+		p.done <- result{m: m, err: err}
+		return
+	}
+	if err != nil {
+		s.server.reportError(s, p.m, err)
+	}
+}
+
+func (s *Session) stopPending() {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	for serial, p := range s.pending {
+		p.stop()
+		delete(s.pending, serial)
+	}
+}
+
+func (p *pending) stop() {
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+}
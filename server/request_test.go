@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+// startRequest runs session.Request in the background.
+func startRequest(ctx context.Context, session *Session, msg jtt.Msg) <-chan result {
+	done := make(chan result, 1)
+	go func() {
+		m, err := session.Request(ctx, msg)
+		done <- result{m: m, err: err}
+	}()
+	return done
+}
+
+func waitResult(t *testing.T, done <-chan result) result {
+	t.Helper()
+	select {
+	case r := <-done:
+		return r
+	case <-time.After(2 * time.Second):
+		t.Fatal("Request didn't return")
+		return result{}
+	}
+}
+
+func TestSession_Request(t *testing.T) {
+	srv := New(NewRouter())
+	addr := startServer(t, srv)
+	term := dialTerminal(t, "tcp", addr, "13812345678")
+	term.send(&jtt.T808_0x0002{})
+	waitSession(t, srv, term)
+	session, _ := srv.Session(term.phone)
+	ctx := context.Background()
+
+	t.Run("response", func(t *testing.T) {
+		done := startRequest(ctx, session, &jtt.T808_0x8104{})
+		query := term.receive()
+		if n := session.InFlight(); n != 1 {
+			t.Errorf("InFlight = %d, want 1", n)
+		}
+		// a reply to another message is ignored
+		term.send(&jtt.T808_0x0104{ReplyMsgSerialNo: query.Header.SerialNumber + 1})
+		term.send(&jtt.T808_0x0104{
+			ReplyMsgSerialNo: query.Header.SerialNumber,
+			Params:           []*jtt.Param{(&jtt.Param{}).SetHeartbeatInterval(30)},
+		})
+		r := waitResult(t, done)
+		if r.err != nil {
+			t.Fatalf("Request: %v", r.err)
+		}
+		reply, ok := r.m.Body.(*jtt.T808_0x0104)
+		if !ok || reply.ReplyMsgSerialNo != query.Header.SerialNumber || len(reply.Params) != 1 {
+			t.Errorf("Request = %+v, want the 0x0104 reply", r.m.Body)
+		}
+		if n := session.InFlight(); n != 0 {
+			t.Errorf("InFlight = %d, want 0", n)
+		}
+	})
+
+	t.Run("acknowledged then response", func(t *testing.T) {
+		done := startRequest(ctx, session, &jtt.T808_0x8201{})
+		query := term.receive()
+		term.send(jtt.NewTerminalReply(query.Header, jtt.ReplyResultSuccess))
+		select {
+		case r := <-done:
+			t.Fatalf("Request returned %v after the general reply", r.m.Header.MsgID)
+		case <-time.After(50 * time.Millisecond):
+		}
+		term.send(&jtt.T808_0x0201{ReplyMsgSerialNo: query.Header.SerialNumber, LocationInfo: &jtt.T808_0x0200{}})
+		if r := waitResult(t, done); r.err != nil || r.m.Header.MsgID != jtt.MsgT808_0x0201 {
+			t.Errorf("Request = %v, %v, want the 0x0201 reply", r.m, r.err)
+		}
+	})
+
+	t.Run("general reply", func(t *testing.T) {
+		done := startRequest(ctx, session, &jtt.T808_0x8105{Command: 4})
+		query := term.receive()
+		term.send(jtt.NewTerminalReply(query.Header, jtt.ReplyResultUnsupported))
+		r := waitResult(t, done)
+		var replyErr *ReplyError
+		if !errors.As(r.err, &replyErr) || replyErr.Result != jtt.ReplyResultUnsupported {
+			t.Fatalf("Request error = %v, want a ReplyError with result %d", r.err, jtt.ReplyResultUnsupported)
+		}
+		if r.m == nil || r.m.Header.MsgID != jtt.MsgT808_0x0001 {
+			t.Errorf("Request = %v, want the 0x0001 reply", r.m)
+		}
+	})
+
+	t.Run("response without serial number", func(t *testing.T) {
+		done := startRequest(ctx, session, &jtt.T808_0x8107{})
+		term.receive()
+		term.send(&jtt.T808_0x0107{ManufacturerID: "ABCDE", TerminalModel: "M1", TerminalID: "T1", ICCID: "12345678901234567890"})
+		if r := waitResult(t, done); r.err != nil || r.m.Header.MsgID != jtt.MsgT808_0x0107 {
+			t.Errorf("Request = %v, %v, want the 0x0107 reply", r.m, r.err)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		done := startRequest(ctx, session, &jtt.T808_0x8104{})
+		term.receive()
+		if r := waitResult(t, done); !errors.Is(r.err, context.DeadlineExceeded) {
+			t.Errorf("Request error = %v, want %v", r.err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func TestSession_RequestSegmented(t *testing.T) {
+	srv := New(NewRouter())
+	addr := startServer(t, srv)
+	term := dialTerminal(t, "tcp", addr, "13812345678")
+	term.send(&jtt.T808_0x0002{})
+	waitSession(t, srv, term)
+	session, _ := srv.Session(term.phone)
+
+	done := startRequest(context.Background(), session, &jtt.T808_0x8900{TransparentMsgType: 0xF0, TransparentMsgContent: make([]byte, 2000)})
+	var packets []*jtt.Message
+	for range 2 {
+		packets = append(packets, term.receive())
+	}
+	// the reply to the first packet doesn't complete the request, the reply to the last one does
+	term.send(jtt.NewTerminalReply(packets[0].Header, jtt.ReplyResultSuccess))
+	select {
+	case r := <-done:
+		t.Fatalf("Request returned %v, %v after the reply to the first packet", r.m, r.err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	term.send(jtt.NewTerminalReply(packets[1].Header, jtt.ReplyResultSuccess))
+	if r := waitResult(t, done); r.err != nil || r.m.Body.(*jtt.T808_0x0001).ReplyMsgSerialNo != packets[1].Header.SerialNumber {
+		t.Errorf("Request = %v, %v, want the reply to the last packet", r.m, r.err)
+	}
+}
+
+func TestSession_RequestFromHandler(t *testing.T) {
+	for _, network := range []string{"tcp", "udp"} {
+		t.Run(network, func(t *testing.T) {
+			replies := make(chan result, 1)
+			router := NewRouter()
+			router.HandleFunc(jtt.MsgT808_0x0002, func(ctx context.Context, req *Request) error {
+				// the reply is read while the handler waits for it
+				m, err := req.Session.Request(ctx, &jtt.T808_0x8104{})
+				replies <- result{m: m, err: err}
+				return err
+			})
+			srv := New(router, WithTCPRetryPolicy(RetryPolicy{Timeout: time.Second}), WithUDPRetryPolicy(RetryPolicy{Timeout: time.Second}))
+			addr := startServer(t, srv)
+			if network == "udp" {
+				addr = startUDPServer(t, srv)
+			}
+			term := dialTerminal(t, network, addr, "13812345678")
+			term.send(&jtt.T808_0x0002{})
+
+			query := term.receive()
+			if query.Header.MsgID != jtt.MsgT808_0x8104 {
+				t.Fatalf("received %s, want %s", query.Header.MsgID, jtt.MsgT808_0x8104)
+			}
+			term.send(&jtt.T808_0x0104{ReplyMsgSerialNo: query.Header.SerialNumber})
+			if r := waitResult(t, replies); r.err != nil || r.m.Header.MsgID != jtt.MsgT808_0x0104 {
+				t.Errorf("Request = %v, %v, want the 0x0104 reply", r.m, r.err)
+			}
+		})
+	}
+}
+
+func TestSession_RequestRetransmission(t *testing.T) {
+	srv := New(NewRouter(), WithTCPRetryPolicy(RetryPolicy{Timeout: 30 * time.Millisecond, Times: 2}))
+	addr := startServer(t, srv)
+	term := dialTerminal(t, "tcp", addr, "13812345678")
+	term.send(&jtt.T808_0x0002{})
+	waitSession(t, srv, term)
+	session, _ := srv.Session(term.phone)
+
+	done := startRequest(context.Background(), session, &jtt.T808_0x8104{})
+	first := term.receive()
+	for i := 1; i <= 2; i++ {
+		if m := term.receive(); m.Header.SerialNumber != first.Header.SerialNumber {
+			t.Errorf("retransmission %d serial number = %d, want %d", i, m.Header.SerialNumber, first.Header.SerialNumber)
+		}
+	}
+	if r := waitResult(t, done); !errors.Is(r.err, ErrNoReply) {
+		t.Errorf("Request error = %v, want %v", r.err, ErrNoReply)
+	}
+
+	// the terminal's parameters change the schedule
+	session.ApplyParams([]*jtt.Param{(&jtt.Param{}).SetTCPRetryInterval(5), (&jtt.Param{}).SetUDPRetryTimes(9)})
+	if got, want := session.RetryPolicy(), (RetryPolicy{Timeout: 5 * time.Second, Times: 2}); got != want {
+		t.Errorf("RetryPolicy() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+// RetryPolicy is the retransmission schedule of a message the terminal doesn't answer, see jtt.RetryPolicy.
+type RetryPolicy = jtt.RetryPolicy
+
+var (
+	// DefaultTCPRetryPolicy is the default retransmission schedule of TCP sessions.
+	DefaultTCPRetryPolicy = RetryPolicy{Timeout: 10 * time.Second, Times: 3}
+	// DefaultUDPRetryPolicy is the default retransmission schedule of UDP sessions.
+	DefaultUDPRetryPolicy = RetryPolicy{Timeout: 10 * time.Second, Times: 3}
+)
+
+// applyRetryParams updates the policy from the terminal parameters with the timeout (in seconds) and times IDs.
+func applyRetryParams(p RetryPolicy, params []*jtt.Param, timeoutID, timesID jtt.ParamID) RetryPolicy {
+	for _, param := range params {
+		if param == nil {
+			continue
+		}
+		switch param.ID() {
+		case timeoutID:
+			if v, err := param.GetUint32(); err == nil {
+				p.Timeout = time.Duration(v) * time.Second
+			}
+		case timesID:
+			if v, err := param.GetUint32(); err == nil {
+				p.Times = int(v)
+			}
+		}
+	}
+	return p
+}
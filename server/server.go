@@ -0,0 +1,443 @@
+// Package server implements a JT/T 808 platform server: it serves terminals over TCP or UDP, splits and decodes
+// frames, reassembles segmented messages and dispatches them to handlers, one session per terminal.
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ryan961/jtt"
+	"github.com/ryan961/jtt/segment"
+)
+
+// Server is a JT/T 808 platform server.
+type Server struct {
+	handler         Handler
+	codec           *jtt.Codec
+	serials         jtt.SerialGenerator
+	segments        *segment.Pool
+	ownSegments     bool
+	maxFrameSize    int
+	writeTimeout    time.Duration
+	tcpRetry        RetryPolicy
+	udpRetry        RetryPolicy
+	udpIdle         time.Duration
+	autoReply       bool
+	authRequired    bool
+	heartbeat       time.Duration
+	heartbeatMisses int
+	linkProbe       bool
+	onError         func(session *Session, m *jtt.Message, err error)
+	onDiscard       func(session *Session, reason jtt.DiscardReason, data []byte)
+	onDecodeError   func(session *Session, frame []byte, err error)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	nextID atomic.Uint64
+	events subscribers
+
+	mu          sync.Mutex
+	listeners   map[net.Listener]struct{}
+	packetConns map[net.PacketConn]struct{}
+	sessions    map[string]*Session // by session ID
+	phones      map[string]*Session // by phone number
+	inShutdown  atomic.Bool
+	conns       sync.WaitGroup
+	closeOnce   sync.Once
+}
+
+// New creates a server dispatching received messages to handler, usually a *Router.
+func New(handler Handler, opts ...Option) *Server {
+	s := &Server{
+		handler:         handler,
+		maxFrameSize:    jtt.DefaultMaxFrameSize,
+		writeTimeout:    10 * time.Second,
+		tcpRetry:        DefaultTCPRetryPolicy,
+		udpRetry:        DefaultUDPRetryPolicy,
+		udpIdle:         5 * time.Minute,
+		heartbeatMisses: DefaultHeartbeatMisses,
+		listeners:       make(map[net.Listener]struct{}),
+		packetConns:     make(map[net.PacketConn]struct{}),
+		sessions:        make(map[string]*Session),
+		phones:          make(map[string]*Session),
+	}
+	_, s.authRequired = handler.(*AuthFlow)
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.codec == nil {
+		s.codec = jtt.NewCodec()
+	}
+	if s.serials == nil {
+		s.serials = jtt.NewMemorySerialGenerator()
+	}
+	if s.segments == nil {
+		s.segments = segment.NewPool()
+		s.ownSegments = true
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+// ListenAndServe listens on the TCP address and serves terminal connections, see Serve.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on the listener and serves each one in its own session.
+// It always returns a non-nil error, ErrServerClosed after Shutdown or Close.
+func (s *Server) Serve(ln net.Listener) error {
+	if !s.trackListener(ln, true) {
+		_ = ln.Close()
+		return ErrServerClosed
+	}
+	defer s.trackListener(ln, false)
+
+	var backoff time.Duration
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				backoff = min(max(2*backoff, 5*time.Millisecond), time.Second)
+				time.Sleep(backoff)
+				continue
+			}
+			return err
+		}
+		backoff = 0
+
+		if !s.addConn() {
+			_ = conn.Close()
+			return ErrServerClosed
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Shutdown gracefully shuts down the server: it stops accepting connections, stops reading from sessions,
+// waits for the handlers in progress to return and closes all sessions. If ctx is done first,
+// the remaining sessions are closed immediately and ctx.Err() is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.inShutdown.Store(true)
+	s.closeListeners()
+	s.stopPacketConns()
+	for _, session := range s.Sessions() {
+		session.transport.stopReading()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.conns.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.release()
+		return nil
+	case <-ctx.Done():
+		_ = s.Close()
+		return ctx.Err()
+	}
+}
+
+// Close immediately closes all listeners and sessions, handlers in progress see their context canceled.
+func (s *Server) Close() error {
+	s.inShutdown.Store(true)
+	s.closeListeners()
+	s.closePacketConns()
+	s.cancel()
+	for _, session := range s.Sessions() {
+		_ = session.Close()
+	}
+	s.release()
+	return nil
+}
+
+// Session returns the session of the terminal with the phone number. If authentication is required
+// (see WithAuthRequired), only authenticated sessions are returned.
+func (s *Server) Session(phoneNumber string) (*Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.phones[phoneNumber]
+	return session, ok
+}
+
+// Sessions returns all open sessions.
+func (s *Server) Sessions() []*Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// Segments returns the pool used to reassemble segmented messages.
+func (s *Server) Segments() *segment.Pool { return s.segments }
+
+func (s *Server) shuttingDown() bool { return s.inShutdown.Load() }
+
+func (s *Server) release() {
+	s.closeOnce.Do(func() {
+		s.cancel()
+		if s.ownSegments {
+			_ = s.segments.Close()
+		}
+	})
+}
+
+func (s *Server) trackListener(ln net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if add {
+		if s.shuttingDown() {
+			return false
+		}
+		s.listeners[ln] = struct{}{}
+	} else {
+		delete(s.listeners, ln)
+	}
+	return true
+}
+
+func (s *Server) closeListeners() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ln := range s.listeners {
+		_ = ln.Close()
+		delete(s.listeners, ln)
+	}
+}
+
+func (s *Server) trackPacketConn(conn net.PacketConn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if add {
+		if s.shuttingDown() {
+			return false
+		}
+		s.packetConns[conn] = struct{}{}
+	} else {
+		delete(s.packetConns, conn)
+	}
+	return true
+}
+
+// stopPacketConns stops the read loops of the packet connections, which close them once their sessions are done.
+func (s *Server) stopPacketConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.packetConns {
+		_ = conn.SetReadDeadline(time.Now())
+	}
+}
+
+func (s *Server) closePacketConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.packetConns {
+		_ = conn.Close()
+		delete(s.packetConns, conn)
+	}
+}
+
+// addConn registers a connection or session goroutine, it fails once the server is shutting down.
+func (s *Server) addConn() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shuttingDown() {
+		return false
+	}
+	s.conns.Add(1)
+	return true
+}
+
+func (s *Server) newSessionID(network string) string {
+	return network + "-" + strconv.FormatUint(s.nextID.Add(1), 10)
+}
+
+func (s *Server) addSession(session *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.id] = session
+}
+
+func (s *Server) removeSession(session *Session) {
+	s.mu.Lock()
+	delete(s.sessions, session.id)
+	offline := s.unbindPhoneLocked(session)
+	s.mu.Unlock()
+
+	if offline {
+		session.mu.RLock()
+		reason := session.closeErr
+		session.mu.RUnlock()
+		s.emit(EventOffline, session, reason)
+	}
+}
+
+// bindPhone indexes the session by its phone number. A previous session of the same terminal
+// (e.g. a stale connection after the terminal reconnected) is closed, unless it's authenticated
+// and the session isn't: the session is then left out of the index until it's authenticated.
+func (s *Server) bindPhone(session *Session) {
+	phone := session.PhoneNumber()
+	if phone == "" {
+		return
+	}
+	s.mu.Lock()
+	previous := s.phones[phone]
+	if previous != nil && previous != session && previous.Authenticated() && !session.Authenticated() {
+		s.mu.Unlock()
+		return
+	}
+	if session.boundPhone != phone {
+		s.unbindPhoneLocked(session)
+	}
+	s.phones[phone] = session
+	session.boundPhone = phone
+	s.mu.Unlock()
+	if previous == session {
+		return
+	}
+	if previous != nil {
+		_ = previous.Close()
+	}
+	s.emit(EventOnline, session, nil)
+}
+
+// unbindPhoneLocked removes the index of the session by phone number, it reports whether the session was indexed.
+// s.mu must be held.
+func (s *Server) unbindPhoneLocked(session *Session) bool {
+	phone := session.boundPhone
+	if phone == "" {
+		return false
+	}
+	session.boundPhone = ""
+	if s.phones[phone] != session {
+		return false // replaced by a newer session of the terminal
+	}
+	delete(s.phones, phone)
+	return true
+}
+
+// newFrameScanner creates the scanner of the frames received on the session, session is nil for UDP datagrams.
+func (s *Server) newFrameScanner(r io.Reader, session *Session) *jtt.FrameScanner {
+	opts := []jtt.FrameScannerOption{jtt.WithMaxFrameSize(s.maxFrameSize)}
+	if s.onDiscard != nil {
+		opts = append(opts, jtt.WithDiscardReasonHandler(func(reason jtt.DiscardReason, data []byte) {
+			s.onDiscard(session, reason, data)
+		}))
+	}
+	return jtt.NewFrameScanner(r, opts...)
+}
+
+// inbound is a received message queued for the handlers of its session.
+type inbound struct {
+	m       *jtt.Message
+	replyTo *jtt.MsgHeader
+}
+
+// handleFrame decodes a frame received on the session, it returns the message to dispatch to the handlers.
+func (s *Server) handleFrame(session *Session, frame []byte) (inbound, bool) {
+	m, err := s.decodeFrame(frame)
+	s.reportDecodeError(session, frame, err)
+	if m.Header == nil {
+		s.reportError(session, nil, err)
+		return inbound{}, false
+	}
+	first, phoneErr := session.observe(m.Header)
+	if phoneErr != nil {
+		// another terminal can't take over the session, nor the index of its own phone number
+		s.reportError(session, m, phoneErr)
+		_ = session.closeWithError(phoneErr)
+		return inbound{}, false
+	}
+	if first && !s.authRequired {
+		s.bindPhone(session)
+	}
+	return s.receive(session, m, err)
+}
+
+// decodeFrame decodes a frame, the header of the message is nil if it couldn't be decoded.
+func (s *Server) decodeFrame(frame []byte) (*jtt.Message, error) {
+	m := &jtt.Message{}
+	err := s.codec.DecodeInto(m, frame)
+	return m, err
+}
+
+// receive reassembles a message decoded with err and completes the request it answers, see Session.Request.
+// It runs on the read loop of the session, before and regardless of the handlers which may wait for
+// the reply. It returns the message to dispatch to the handlers.
+func (s *Server) receive(session *Session, m *jtt.Message, err error) (inbound, bool) {
+	// messages without a registered body type are dispatched with a *jtt.RawMsg body
+	if err != nil && !errors.Is(err, jtt.ErrMessageNotRegistered) {
+		s.reportError(session, m, err)
+		s.reply(session, m.Header, jtt.ReplyResultInvalid)
+		return inbound{}, false
+	}
+
+	// the packet completing a segmented message is answered with the result of its handler
+	replyTo := m.Header
+	if m.Header.IsSegment() {
+		assembled, cacheErr := s.segments.CacheMessage(m)
+		if cacheErr != nil && !errors.Is(cacheErr, jtt.ErrMessageNotRegistered) {
+			if assembled != nil {
+				m = assembled
+			}
+			s.reportError(session, m, cacheErr)
+			s.reply(session, replyTo, jtt.ReplyResult(cacheErr))
+			return inbound{}, false
+		}
+		if assembled == nil {
+			s.reply(session, replyTo, jtt.ReplyResultSuccess)
+			return inbound{}, false
+		}
+		m, err = assembled, cacheErr
+	}
+	if err == nil {
+		session.acknowledge(m)
+		if reply, ok := m.Body.(*jtt.T808_0x0104); ok {
+			session.ApplyParams(reply.Params)
+		}
+	}
+	return inbound{m: m, replyTo: replyTo}, true
+}
+
+func (s *Server) dispatch(session *Session, m *jtt.Message, replyTo *jtt.MsgHeader) {
+	req := &Request{Session: session, Message: m, replyTo: replyTo}
+	err := s.handler.ServeMessage(s.ctx, req)
+	if err != nil {
+		s.reportError(session, m, err)
+	}
+	if !req.skipReply {
+		s.reply(session, replyTo, jtt.ReplyResult(err))
+	}
+}
+
+// reportDecodeError reports a frame that couldn't be decoded, messages without a registered body type aren't errors.
+func (s *Server) reportDecodeError(session *Session, frame []byte, err error) {
+	if s.onDecodeError != nil && err != nil && !errors.Is(err, jtt.ErrMessageNotRegistered) {
+		s.onDecodeError(session, frame, err)
+	}
+}
+
+func (s *Server) reportError(session *Session, m *jtt.Message, err error) {
+	if s.onError != nil && err != nil {
+		s.onError(session, m, err)
+	}
+}
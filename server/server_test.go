@@ -0,0 +1,288 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+func TestServer_Dispatch(t *testing.T) {
+	received := make(chan *Request, 1)
+	router := NewRouter()
+	router.HandleFunc(jtt.MsgT808_0x0002, func(ctx context.Context, req *Request) error {
+		received <- req
+		return req.Session.Send(&jtt.T808_0x8001{
+			ReplyMsgSerialNo: req.Message.Header.SerialNumber,
+			ReplyMsgID:       req.Message.Header.MsgID,
+			Result:           0,
+		})
+	})
+	srv := New(router)
+	addr := startServer(t, srv)
+
+	term := dialTerminal(t, "tcp", addr, "13812345678")
+	term.version = jtt.Version2019
+	header := term.send(&jtt.T808_0x0002{})
+
+	var req *Request
+	select {
+	case req = <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler not called")
+	}
+	if got := req.Message.Header.SerialNumber; got != header.SerialNumber {
+		t.Errorf("SerialNumber = %d, want %d", got, header.SerialNumber)
+	}
+
+	session, ok := srv.Session(term.phone)
+	if !ok {
+		t.Fatalf("Session(%s) not found", term.phone)
+	}
+	if session != req.Session {
+		t.Errorf("Session(%s) is not the session of the request", term.phone)
+	}
+	if session.PhoneNumber() != term.phone {
+		t.Errorf("PhoneNumber() = %s, want %s", session.PhoneNumber(), term.phone)
+	}
+	if session.Version() != jtt.Version2019 {
+		t.Errorf("Version() = %d, want %d", session.Version(), jtt.Version2019)
+	}
+	if session.RemoteAddr().String() != term.conn.LocalAddr().String() {
+		t.Errorf("RemoteAddr() = %s, want %s", session.RemoteAddr(), term.conn.LocalAddr())
+	}
+	if session.LastActive().Before(session.CreatedAt()) {
+		t.Errorf("LastActive() %v is before CreatedAt() %v", session.LastActive(), session.CreatedAt())
+	}
+
+	reply := term.receive()
+	if reply.Header.MsgID != jtt.MsgT808_0x8001 {
+		t.Fatalf("reply MsgID = %s, want %s", reply.Header.MsgID, jtt.MsgT808_0x8001)
+	}
+	if reply.Header.PhoneNumber != term.phone || reply.Header.Version != jtt.Version2019 {
+		t.Errorf("reply header = %+v, want phone %s and version 2019", reply.Header, term.phone)
+	}
+	if reply.Header.SerialNumber == 0 {
+		t.Error("reply SerialNumber = 0, want a generated serial number")
+	}
+	ack := reply.Body.(*jtt.T808_0x8001)
+	if ack.ReplyMsgSerialNo != header.SerialNumber || ack.ReplyMsgID != jtt.MsgT808_0x0002 {
+		t.Errorf("reply = %+v, want ack of %s #%d", ack, jtt.MsgT808_0x0002, header.SerialNumber)
+	}
+}
+
+func TestServer_Segments(t *testing.T) {
+	received := make(chan *jtt.Message, 2)
+	router := NewRouter()
+	router.HandleFunc(jtt.MsgT808_0x0900, func(ctx context.Context, req *Request) error {
+		received <- req.Message
+		return nil
+	})
+	router.HandleFunc(jtt.MsgT808_0x0002, func(ctx context.Context, req *Request) error {
+		received <- req.Message
+		return nil
+	})
+	srv := New(router)
+	addr := startServer(t, srv)
+	term := dialTerminal(t, "tcp", addr, "13812345678")
+
+	content := bytes.Repeat([]byte("0123456789"), 250)
+	m := &jtt.Message{Header: term.header(), Body: &jtt.T808_0x0900{TransparentMsgType: 0xF0, TransparentMsgContent: content}}
+	frames, err := m.EncodeSegments(0, func() uint16 { term.serial++; return term.serial })
+	if err != nil {
+		t.Fatalf("EncodeSegments: %v", err)
+	}
+	if len(frames) < 2 {
+		t.Fatalf("EncodeSegments returned %d frames, want a segmented message", len(frames))
+	}
+	_, heartbeat := term.encode(&jtt.T808_0x0002{})
+	// all frames in a single write, the server must split them
+	term.write(append(frames, heartbeat)...)
+
+	for _, want := range []jtt.MsgID{jtt.MsgT808_0x0900, jtt.MsgT808_0x0002} {
+		select {
+		case got := <-received:
+			if got.Header.MsgID != want {
+				t.Fatalf("received %s, want %s", got.Header.MsgID, want)
+			}
+			if body, ok := got.Body.(*jtt.T808_0x0900); ok && !bytes.Equal(body.TransparentMsgContent, content) {
+				t.Errorf("reassembled content length = %d, want %d", len(body.TransparentMsgContent), len(content))
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s not received", want)
+		}
+	}
+}
+
+func TestServer_ErrorHandler(t *testing.T) {
+	errs := make(chan error, 1)
+	srv := New(NewRouter(), WithErrorHandler(func(session *Session, m *jtt.Message, err error) {
+		errs <- err
+	}))
+	addr := startServer(t, srv)
+	term := dialTerminal(t, "tcp", addr, "13812345678")
+	term.send(&jtt.T808_0x0002{})
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, jtt.ErrMethodNotImplemented) {
+			t.Errorf("error = %v, want %v", err, jtt.ErrMethodNotImplemented)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("error handler not called")
+	}
+}
+
+func TestServer_DiscardAndDecodeErrorHandlers(t *testing.T) {
+	discards := make(chan jtt.DiscardReason, 1)
+	decodeErrs := make(chan error, 1)
+	srv := New(NewRouter(),
+		WithDiscardHandler(func(session *Session, reason jtt.DiscardReason, data []byte) {
+			discards <- reason
+		}),
+		WithDecodeErrorHandler(func(session *Session, frame []byte, err error) {
+			decodeErrs <- err
+		}),
+	)
+	addr := startServer(t, srv)
+	term := dialTerminal(t, "tcp", addr, "13812345678")
+
+	_, corrupted := term.encode(&jtt.T808_0x0002{})
+	corrupted[len(corrupted)-2] ^= 0x01
+	term.write(corrupted)
+	select {
+	case reason := <-discards:
+		if reason != jtt.DiscardChecksum {
+			t.Errorf("discard reason = %s, want %s", reason, jtt.DiscardChecksum)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("discard handler not called")
+	}
+
+	// a location report too short for its body
+	term.send(&jtt.RawMsg{ID: jtt.MsgT808_0x0200, Data: []byte{0x01, 0x02}})
+	select {
+	case err := <-decodeErrs:
+		if err == nil || errors.Is(err, jtt.ErrMessageNotRegistered) {
+			t.Errorf("unexpected decode error %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("decode error handler not called")
+	}
+}
+
+func TestServer_ReplacesStaleSession(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc(jtt.MsgT808_0x0002, func(ctx context.Context, req *Request) error { return nil })
+	srv := New(router)
+	addr := startServer(t, srv)
+
+	first := dialTerminal(t, "tcp", addr, "13812345678")
+	first.send(&jtt.T808_0x0002{})
+	waitSession(t, srv, first)
+	stale, _ := srv.Session(first.phone)
+
+	second := dialTerminal(t, "tcp", addr, first.phone)
+	second.send(&jtt.T808_0x0002{})
+	select {
+	case <-stale.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("stale session not closed")
+	}
+	if session, ok := srv.Session(first.phone); !ok || session == stale {
+		t.Errorf("Session(%s) = %v, want the new session", first.phone, session)
+	}
+}
+
+func TestServer_PhoneChangeUnbindsSession(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc(jtt.MsgT808_0x0002, func(ctx context.Context, req *Request) error { return nil })
+	srv := New(router)
+	addr := startServer(t, srv)
+
+	term := dialTerminal(t, "tcp", addr, "13812345678")
+	term.send(&jtt.T808_0x0002{})
+	waitSession(t, srv, term)
+	oldPhone := term.phone
+	term.phone = "13812345679"
+	term.send(&jtt.T808_0x0002{})
+	_ = term.conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(srv.Sessions()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("session not removed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for _, phone := range []string{oldPhone, term.phone} {
+		if session, ok := srv.Session(phone); ok {
+			t.Errorf("Session(%s) = %s after the connection closed", phone, session.ID())
+		}
+	}
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router := NewRouter()
+	router.HandleFunc(jtt.MsgT808_0x0002, func(ctx context.Context, req *Request) error {
+		close(started)
+		<-release
+		return nil
+	})
+	srv := New(router)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ln) }()
+
+	term := dialTerminal(t, "tcp", ln.Addr().String(), "13812345678")
+	term.send(&jtt.T808_0x0002{})
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- srv.Shutdown(context.Background()) }()
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v before the handler returned", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Errorf("Shutdown: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown didn't return")
+	}
+	if err := <-served; !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Serve = %v, want %v", err, ErrServerClosed)
+	}
+	if sessions := srv.Sessions(); len(sessions) != 0 {
+		t.Errorf("Sessions() = %d sessions after Shutdown, want 0", len(sessions))
+	}
+	if err := srv.Serve(ln); !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Serve after Shutdown = %v, want %v", err, ErrServerClosed)
+	}
+}
+
+func waitSession(t *testing.T, srv *Server, term *terminal) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := srv.Session(term.phone); ok {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Session(%s) not found", term.phone)
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+// transport writes frames to the terminal of a session.
+type transport interface {
+	// write writes the frames in order.
+	write(frames [][]byte) error
+	// stopReading stops the read loop of the session after the current message.
+	stopReading()
+	close() error
+}
+
+// Session is the state of a terminal connection. It's safe for concurrent use.
+type Session struct {
+	id        string
+	network   string
+	server    *Server
+	transport transport
+	createdAt time.Time
+
+	mu            sync.RWMutex
+	phoneNumber   string
+	authenticated bool
+	version       jtt.VersionType
+	remoteAddr    net.Addr
+	lastActive    time.Time
+	retryPolicy   RetryPolicy
+	heartbeat     time.Duration
+	liveness      *time.Timer
+	closeErr      error
+
+	values sync.Map
+
+	// phone number the session is indexed by, guarded by server.mu
+	boundPhone string
+
+	// sent messages waiting for a reply by serial number
+	pendingMu sync.Mutex
+	pending   map[uint16]*pending
+
+	writeMu   sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newSession(server *Server, network string, t transport, remoteAddr net.Addr) *Session {
+	now := time.Now()
+	session := &Session{
+		id:         server.newSessionID(network),
+		network:    network,
+		server:     server,
+		transport:  t,
+		createdAt:  now,
+		remoteAddr: remoteAddr,
+		lastActive: now,
+		done:       make(chan struct{}),
+		pending:    make(map[uint16]*pending),
+	}
+	if network == "udp" {
+		session.retryPolicy = server.udpRetry
+	} else {
+		session.retryPolicy = server.tcpRetry
+	}
+	session.heartbeat = server.heartbeat
+	session.scheduleLiveness(server.heartbeat)
+	return session
+}
+
+// ID returns the unique ID of the session.
+func (s *Session) ID() string { return s.id }
+
+// Network returns the network of the session, "tcp" or "udp".
+func (s *Session) Network() string { return s.network }
+
+// CreatedAt returns the time the session was created.
+func (s *Session) CreatedAt() time.Time { return s.createdAt }
+
+// PhoneNumber returns the phone number of the terminal, taken from the first message received. It doesn't change
+// afterwards, a message with another phone number closes the session with ErrPhoneMismatch.
+func (s *Session) PhoneNumber() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.phoneNumber
+}
+
+// Authenticated reports whether the terminal has been authenticated.
+func (s *Session) Authenticated() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.authenticated
+}
+
+// SetAuthenticated sets the authentication state of the terminal, EventAuthenticated is fired
+// when the session becomes authenticated. An authenticated session is indexed by its phone number
+// (see Server.Session) and replaces the previous session of the terminal.
+func (s *Session) SetAuthenticated(authenticated bool) {
+	s.mu.Lock()
+	changed := s.authenticated != authenticated
+	s.authenticated = authenticated
+	s.mu.Unlock()
+	if changed && authenticated {
+		s.server.bindPhone(s)
+		s.server.emit(EventAuthenticated, s, nil)
+	}
+}
+
+// Version returns the protocol version of the terminal, taken from the last message received.
+func (s *Session) Version() jtt.VersionType {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.version
+}
+
+// RemoteAddr returns the address of the terminal.
+func (s *Session) RemoteAddr() net.Addr {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.remoteAddr
+}
+
+// LastActive returns the time the last message was received.
+func (s *Session) LastActive() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastActive
+}
+
+// RetryPolicy returns the retransmission schedule of the messages sent to the terminal.
+func (s *Session) RetryPolicy() RetryPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.retryPolicy
+}
+
+// SetRetryPolicy sets the retransmission schedule of the messages sent to the terminal.
+func (s *Session) SetRetryPolicy(policy RetryPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retryPolicy = policy
+}
+
+// ApplyParams updates the session from terminal parameters, e.g. those set by 0x8103 or queried by 0x0104.
+// The heartbeat interval is taken from ParamHeartbeatInterval and the retry policy from ParamTCPRetryInterval
+// and ParamTCPRetryTimes, or from ParamUDPRetryInterval and ParamUDPRetryTimes for UDP sessions.
+//
+// The parameters of received 0x0104 replies and of 0x8103 requests (see Request) acknowledged by the terminal
+// are applied automatically.
+func (s *Session) ApplyParams(params []*jtt.Param) {
+	s.mu.Lock()
+	if s.network == "udp" {
+		s.retryPolicy = applyRetryParams(s.retryPolicy, params, jtt.ParamUDPRetryInterval, jtt.ParamUDPRetryTimes)
+	} else {
+		s.retryPolicy = applyRetryParams(s.retryPolicy, params, jtt.ParamTCPRetryInterval, jtt.ParamTCPRetryTimes)
+	}
+	s.mu.Unlock()
+
+	for _, param := range params {
+		if param != nil && param.ID() == jtt.ParamHeartbeatInterval {
+			if v, err := param.GetHeartbeatInterval(); err == nil {
+				s.SetHeartbeatInterval(time.Duration(v) * time.Second)
+			}
+		}
+	}
+}
+
+// Value returns the value stored in the session for key.
+func (s *Session) Value(key any) (any, bool) {
+	return s.values.Load(key)
+}
+
+// SetValue stores a value in the session, e.g. application state of the terminal.
+func (s *Session) SetValue(key, value any) {
+	s.values.Store(key, value)
+}
+
+// Done returns a channel that's closed when the session is closed.
+func (s *Session) Done() <-chan struct{} { return s.done }
+
+// Close closes the session and its connection.
+func (s *Session) Close() error {
+	return s.closeWithError(nil)
+}
+
+// closeWithError closes the session for the reason reported by the EventOffline event.
+func (s *Session) closeWithError(reason error) error {
+	var err error
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closeErr = reason
+		if s.liveness != nil {
+			s.liveness.Stop()
+		}
+		s.mu.Unlock()
+		close(s.done)
+		s.stopPending()
+		err = s.transport.close()
+	})
+	return err
+}
+
+func (s *Session) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// observe updates the session from the header of a received message, first reports whether the header set
+// the phone number of the session. It fails with ErrPhoneMismatch if the header has another phone number.
+func (s *Session) observe(header *jtt.MsgHeader) (first bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if header.PhoneNumber != "" && header.PhoneNumber != s.phoneNumber {
+		if s.phoneNumber != "" {
+			return false, fmt.Errorf("%w: %s on the session of %s", ErrPhoneMismatch, header.PhoneNumber, s.phoneNumber)
+		}
+		s.phoneNumber, first = header.PhoneNumber, true
+	}
+	s.lastActive = time.Now()
+	s.version = header.Version
+	return first, nil
+}
+
+func (s *Session) setRemoteAddr(addr net.Addr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remoteAddr = addr
+}
+
+// Send sends a message body to the terminal, see Write.
+func (s *Session) Send(msg jtt.Msg) error {
+	return s.Write(&jtt.Message{Header: &jtt.MsgHeader{}, Body: msg})
+}
+
+// Write sends a message to the terminal. Missing header fields are filled from the session:
+// the phone number, the protocol version (also set on jtt.VersionedMsg bodies) and, if the serial number
+// is 0, a serial number from the server's serial generator. Bodies longer than a single packet are segmented.
+//
+// On UDP sessions, messages other than replies are retransmitted following the session's RetryPolicy
+// until the terminal answers them, see Request to wait for the reply.
+//
+// After Write returns, m.Header.SerialNumber is the serial number of the (first) packet sent.
+func (s *Session) Write(m *jtt.Message) error {
+	frames, last, err := s.encode(m)
+	if err != nil {
+		return err
+	}
+	if s.network == "udp" && expectsReply(m.Body) && s.RetryPolicy().Enabled() {
+		s.track(newPending(m, frames, last, nil))
+	}
+	return s.writeFrames(frames)
+}
+
+// encode encodes m for the terminal of the session, see jtt.Codec.EncodeFrames.
+func (s *Session) encode(m *jtt.Message) (frames [][]byte, last uint16, err error) {
+	if s.closed() {
+		return nil, 0, ErrSessionClosed
+	}
+	return s.server.codec.EncodeFrames(m, s.PhoneNumber(), s.Version(), s.server.serials)
+}
+
+func (s *Session) writeFrames(frames [][]byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.closed() {
+		return ErrSessionClosed
+	}
+	return s.transport.write(frames)
+}
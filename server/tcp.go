@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net"
+	"time"
+)
+
+// tcpQueueSize is the number of received messages queued for the handlers of a TCP session,
+// the session stops reading while its queue is full.
+const tcpQueueSize = 64
+
+// tcpTransport is the transport of a TCP connection.
+type tcpTransport struct {
+	conn         net.Conn
+	writeTimeout time.Duration
+}
+
+func (t *tcpTransport) write(frames [][]byte) error {
+	if t.writeTimeout > 0 {
+		_ = t.conn.SetWriteDeadline(time.Now().Add(t.writeTimeout))
+	}
+	// WriteTo consumes the buffers, keep frames intact for retransmissions
+	buffers := append(net.Buffers(nil), frames...)
+	_, err := buffers.WriteTo(t.conn)
+	return err
+}
+
+func (t *tcpTransport) stopReading() {
+	_ = t.conn.SetReadDeadline(time.Now())
+}
+
+func (t *tcpTransport) close() error {
+	return t.conn.Close()
+}
+
+// serveConn runs the read loop of a TCP connection, the handlers of the session run in their own goroutine
+// so that the replies they wait for are read meanwhile.
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.conns.Done()
+
+	session := newSession(s, "tcp", &tcpTransport{conn: conn, writeTimeout: s.writeTimeout}, conn.RemoteAddr())
+	s.addSession(session)
+	queue := make(chan inbound, tcpQueueSize)
+	handled := make(chan struct{})
+	go func() {
+		defer close(handled)
+		for in := range queue {
+			s.dispatch(session, in.m, in.replyTo)
+		}
+	}()
+	defer func() {
+		// let the handlers process the queued messages before closing the session
+		close(queue)
+		<-handled
+		_ = session.Close()
+		s.removeSession(session)
+	}()
+	if s.shuttingDown() {
+		return
+	}
+
+	scanner := s.newFrameScanner(conn, session)
+	for scanner.Scan() {
+		if in, ok := s.handleFrame(session, scanner.Frame()); ok {
+			queue <- in
+		}
+		if s.shuttingDown() || session.closed() {
+			return
+		}
+	}
+}
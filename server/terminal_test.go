@@ -0,0 +1,111 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+// terminal is an in-process terminal simulator for tests.
+type terminal struct {
+	t       *testing.T
+	conn    net.Conn
+	scanner *jtt.FrameScanner
+	phone   string
+	version jtt.VersionType
+	serial  uint16
+}
+
+func dialTerminal(t *testing.T, network, addr, phone string) *terminal {
+	t.Helper()
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return &terminal{t: t, conn: conn, scanner: jtt.NewFrameScanner(conn), phone: phone}
+}
+
+func (c *terminal) header() *jtt.MsgHeader {
+	c.serial++
+	header := &jtt.MsgHeader{PhoneNumber: c.phone, SerialNumber: c.serial, Version: c.version}
+	if c.version == jtt.Version2019 {
+		header.ProtocolVersion = 1
+	}
+	return header
+}
+
+// encode encodes the body as the next message of the terminal.
+func (c *terminal) encode(body jtt.Msg) (*jtt.MsgHeader, []byte) {
+	c.t.Helper()
+	m := &jtt.Message{Header: c.header(), Body: body}
+	data, err := m.Encode()
+	if err != nil {
+		c.t.Fatalf("encode %s: %v", body.MsgID(), err)
+	}
+	return m.Header, data
+}
+
+// send sends the body as the next message of the terminal and returns its header.
+func (c *terminal) send(body jtt.Msg) *jtt.MsgHeader {
+	c.t.Helper()
+	header, data := c.encode(body)
+	c.write(data)
+	return header
+}
+
+func (c *terminal) write(data ...[]byte) {
+	c.t.Helper()
+	buffers := net.Buffers(data)
+	if _, err := buffers.WriteTo(c.conn); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+}
+
+// receive reads the next message sent by the platform.
+func (c *terminal) receive() *jtt.Message {
+	c.t.Helper()
+	m, err := c.receiveWithin(2 * time.Second)
+	if err != nil {
+		c.t.Fatalf("receive: %v", err)
+	}
+	return m
+}
+
+// receiveWithin reads the next message sent by the platform within the timeout.
+func (c *terminal) receiveWithin(timeout time.Duration) (*jtt.Message, error) {
+	_ = c.conn.SetReadDeadline(time.Now().Add(timeout))
+	if !c.scanner.Scan() {
+		err := c.scanner.Err()
+		// a scanner stops after an error, the terminal may read again
+		c.scanner = jtt.NewFrameScanner(c.conn)
+		return nil, err
+	}
+	return jtt.DecodeMessage(c.scanner.Frame())
+}
+
+// startServer starts a server on a random local port and returns its address.
+func startServer(t *testing.T, srv *Server) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return ln.Addr().String()
+}
+
+// startUDPServer starts a server on a random local UDP port and returns its address.
+func startUDPServer(t *testing.T, srv *Server) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = srv.ServeUDP(conn) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return conn.LocalAddr().String()
+}
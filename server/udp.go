@@ -0,0 +1,210 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+const (
+	// maxDatagramSize is the maximum size of a UDP datagram.
+	maxDatagramSize = 64 * 1024
+	// udpQueueSize is the number of received messages queued for the handlers of a UDP session.
+	udpQueueSize = 64
+)
+
+// udpTransport is the transport of a UDP session, it writes to the last address the terminal sent from.
+type udpTransport struct {
+	conn    net.PacketConn
+	session *Session
+	queue   chan inbound
+}
+
+func (t *udpTransport) write(frames [][]byte) error {
+	addr := t.session.RemoteAddr()
+	for _, frame := range frames {
+		if _, err := t.conn.WriteTo(frame, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stopReading is a no-op, the read loop is shared by the sessions of the connection.
+func (t *udpTransport) stopReading() {}
+
+// close doesn't close the shared connection.
+func (t *udpTransport) close() error { return nil }
+
+// ListenAndServeUDP listens on the UDP address and serves terminals, see ServeUDP.
+func (s *Server) ListenAndServeUDP(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeUDP(conn)
+}
+
+// ServeUDP reads datagrams from the connection, each holding one or more frames, and serves the terminals
+// in sessions keyed by phone number. A session follows the terminal when its source address changes
+// (e.g. NAT rebinding) and is closed after the UDP idle timeout without received messages.
+// The connection is closed when ServeUDP returns.
+//
+// It always returns a non-nil error, ErrServerClosed after Shutdown or Close.
+func (s *Server) ServeUDP(conn net.PacketConn) error {
+	if !s.trackPacketConn(conn, true) || !s.addConn() {
+		s.trackPacketConn(conn, false)
+		_ = conn.Close()
+		return ErrServerClosed
+	}
+	defer s.conns.Done()
+	defer s.trackPacketConn(conn, false)
+
+	uc := &udpConn{conn: conn, stop: make(chan struct{}), sessions: make(map[string]*Session)}
+	defer func() {
+		// let the sessions handle their queued messages before closing the connection
+		close(uc.stop)
+		uc.wg.Wait()
+		_ = conn.Close()
+	}()
+
+	buf := make([]byte, maxDatagramSize)
+	var backoff time.Duration
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				backoff = min(max(2*backoff, 5*time.Millisecond), time.Second)
+				time.Sleep(backoff)
+				continue
+			}
+			return err
+		}
+		backoff = 0
+
+		scanner := s.newFrameScanner(bytes.NewReader(buf[:n]), nil)
+		for scanner.Scan() {
+			s.handleDatagramFrame(uc, addr, scanner.Frame())
+		}
+	}
+}
+
+// udpConn is a connection served by ServeUDP.
+type udpConn struct {
+	conn net.PacketConn
+	stop chan struct{} // closed when the read loop stops
+	wg   sync.WaitGroup
+
+	// sessions of the terminals on the connection by phone number, including the sessions that aren't
+	// indexed by the server yet (see WithAuthRequired)
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// handleDatagramFrame decodes a frame received from addr and queues it to the session of its terminal.
+func (s *Server) handleDatagramFrame(uc *udpConn, addr net.Addr, frame []byte) {
+	m, err := s.decodeFrame(frame)
+	if m.Header == nil {
+		s.reportDecodeError(nil, frame, err)
+		s.reportError(nil, nil, err)
+		return
+	}
+	session, t := s.udpSession(uc, m.Header.PhoneNumber, addr)
+	if session == nil {
+		return
+	}
+	s.reportDecodeError(session, frame, err)
+	session.observe(m.Header)
+	session.setRemoteAddr(addr)
+	in, ok := s.receive(session, m, err)
+	if !ok {
+		return
+	}
+
+	select {
+	case t.queue <- in:
+	default:
+		s.reportError(session, m, ErrSessionBusy)
+	}
+}
+
+// udpSession returns the session of the terminal on the connection, creating it if needed.
+// It returns nil if the server is shutting down.
+func (s *Server) udpSession(uc *udpConn, phone string, addr net.Addr) (*Session, *udpTransport) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	if session, ok := uc.sessions[phone]; ok && !session.closed() {
+		return session, session.transport.(*udpTransport)
+	}
+	if !s.addConn() {
+		return nil, nil
+	}
+
+	t := &udpTransport{conn: uc.conn, queue: make(chan inbound, udpQueueSize)}
+	session := newSession(s, "udp", t, addr)
+	t.session = session
+	session.observe(&jtt.MsgHeader{PhoneNumber: phone})
+	uc.sessions[phone] = session
+	s.addSession(session)
+	if !s.authRequired {
+		s.bindPhone(session)
+	}
+
+	uc.wg.Add(1)
+	go func() {
+		defer uc.wg.Done()
+		defer s.conns.Done()
+		s.serveUDPSession(uc, session, t)
+	}()
+	return session, t
+}
+
+// serveUDPSession runs the handlers of a UDP session until it's closed, idle or the read loop stops.
+func (s *Server) serveUDPSession(uc *udpConn, session *Session, t *udpTransport) {
+	defer func() {
+		_ = session.Close()
+		uc.mu.Lock()
+		if phone := session.PhoneNumber(); uc.sessions[phone] == session {
+			delete(uc.sessions, phone)
+		}
+		uc.mu.Unlock()
+		s.removeSession(session)
+	}()
+
+	var idle <-chan time.Time
+	if s.udpIdle > 0 {
+		ticker := time.NewTicker(min(s.udpIdle, time.Second))
+		defer ticker.Stop()
+		idle = ticker.C
+	}
+	for {
+		select {
+		case in := <-t.queue:
+			s.dispatch(session, in.m, in.replyTo)
+		case <-idle:
+			if time.Since(session.LastActive()) >= s.udpIdle {
+				_ = session.closeWithError(ErrIdleTimeout)
+				return
+			}
+		case <-session.done:
+			return
+		case <-uc.stop:
+			for {
+				select {
+				case in := <-t.queue:
+					s.dispatch(session, in.m, in.replyTo)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
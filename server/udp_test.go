@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ryan961/jtt"
+)
+
+func TestServer_ServeUDP(t *testing.T) {
+	received := make(chan *Request, 4)
+	router := NewRouter()
+	handle := func(ctx context.Context, req *Request) error {
+		received <- req
+		return nil
+	}
+	router.HandleFunc(jtt.MsgT808_0x0002, handle)
+	router.HandleFunc(jtt.MsgT808_0x0200, handle)
+	srv := New(router)
+	addr := startUDPServer(t, srv)
+
+	term := dialTerminal(t, "udp", addr, "13812345678")
+	_, heartbeat := term.encode(&jtt.T808_0x0002{})
+	_, location := term.encode(&jtt.T808_0x0200{})
+	// several frames in a single datagram
+	term.write(bytes.Join([][]byte{heartbeat, location}, nil))
+
+	var session *Session
+	for _, want := range []jtt.MsgID{jtt.MsgT808_0x0002, jtt.MsgT808_0x0200} {
+		select {
+		case req := <-received:
+			if req.Message.Header.MsgID != want {
+				t.Fatalf("received %s, want %s", req.Message.Header.MsgID, want)
+			}
+			session = req.Session
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s not received", want)
+		}
+	}
+	if session.Network() != "udp" {
+		t.Errorf("Network() = %s, want udp", session.Network())
+	}
+	if got, _ := srv.Session(term.phone); got != session {
+		t.Errorf("Session(%s) is not the session of the requests", term.phone)
+	}
+
+	// the terminal's source address changes, e.g. NAT rebinding
+	rebound := dialTerminal(t, "udp", addr, term.phone)
+	rebound.serial = term.serial
+	rebound.send(&jtt.T808_0x0002{})
+	select {
+	case req := <-received:
+		if req.Session != session {
+			t.Fatal("rebound terminal got a new session")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message from the new address not received")
+	}
+	if session.RemoteAddr().String() != rebound.conn.LocalAddr().String() {
+		t.Errorf("RemoteAddr() = %s, want %s", session.RemoteAddr(), rebound.conn.LocalAddr())
+	}
+
+	if err := session.Send(&jtt.T808_0x8001{ReplyMsgSerialNo: rebound.serial, ReplyMsgID: jtt.MsgT808_0x0002}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if reply := rebound.receive(); reply.Header.MsgID != jtt.MsgT808_0x8001 {
+		t.Errorf("received %s at the new address, want %s", reply.Header.MsgID, jtt.MsgT808_0x8001)
+	}
+}
+
+func TestServer_UDPRetransmission(t *testing.T) {
+	errs := make(chan error, 1)
+	srv := New(NewRouter(),
+		WithUDPRetryPolicy(RetryPolicy{Timeout: 50 * time.Millisecond, Times: 2}),
+		WithErrorHandler(func(session *Session, m *jtt.Message, err error) {
+			if m != nil && m.Header.MsgID == jtt.MsgT808_0x8104 {
+				errs <- err
+			}
+		}),
+	)
+	addr := startUDPServer(t, srv)
+	term := dialTerminal(t, "udp", addr, "13812345678")
+	term.send(&jtt.T808_0x0002{})
+	waitSession(t, srv, term)
+	session, _ := srv.Session(term.phone)
+
+	// unanswered: sent once and retransmitted twice
+	query := &jtt.Message{Body: &jtt.T808_0x8104{}}
+	if err := session.Write(query); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		m := term.receive()
+		if m.Header.MsgID != jtt.MsgT808_0x8104 || m.Header.SerialNumber != query.Header.SerialNumber {
+			t.Fatalf("transmission %d = %s #%d, want %s #%d", i, m.Header.MsgID, m.Header.SerialNumber,
+				jtt.MsgT808_0x8104, query.Header.SerialNumber)
+		}
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrNoReply) {
+			t.Errorf("error = %v, want %v", err, ErrNoReply)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("unanswered message not reported")
+	}
+
+	// answered: the reply stops the retransmissions and its parameters are applied
+	query = &jtt.Message{Body: &jtt.T808_0x8104{}}
+	if err := session.Write(query); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	term.receive()
+	term.send(&jtt.T808_0x0104{
+		ReplyMsgSerialNo: query.Header.SerialNumber,
+		Params: []*jtt.Param{
+			(&jtt.Param{}).SetUDPRetryInterval(5),
+			(&jtt.Param{}).SetUDPRetryTimes(1),
+		},
+	})
+	if m, err := term.receiveWithin(200 * time.Millisecond); err == nil {
+		t.Fatalf("received %s #%d after the reply", m.Header.MsgID, m.Header.SerialNumber)
+	}
+	if got, want := session.RetryPolicy(), (RetryPolicy{Timeout: 5 * time.Second, Times: 1}); got != want {
+		t.Errorf("RetryPolicy() = %+v, want %+v", got, want)
+	}
+}
+
+func TestServer_UDPShutdown(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc(jtt.MsgT808_0x0002, func(ctx context.Context, req *Request) error { return nil })
+	srv := New(router)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.ServeUDP(conn) }()
+
+	term := dialTerminal(t, "udp", conn.LocalAddr().String(), "13812345678")
+	term.send(&jtt.T808_0x0002{})
+	waitSession(t, srv, term)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := <-served; !errors.Is(err, ErrServerClosed) {
+		t.Errorf("ServeUDP = %v, want %v", err, ErrServerClosed)
+	}
+	if sessions := srv.Sessions(); len(sessions) != 0 {
+		t.Errorf("Sessions() = %d sessions after Shutdown, want 0", len(sessions))
+	}
+}
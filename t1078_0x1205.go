@@ -1,9 +1,15 @@
 package jtt
 
+import (
+	"errors"
+	"fmt"
+)
+
 // T1078_0x1205 终端上传音视频资源列表
 type T1078_0x1205 struct {
-	ReplyMsgSerialNo uint16 `json:"replyMsgSerialNo"` // 流水号，对应查询音视频资源列表消息的流水号
-	MediaCount       uint32 `json:"mediaCount"`       // 音视频资源总数
+	ReplyMsgSerialNo uint16        `json:"replyMsgSerialNo"` // 流水号，对应查询音视频资源列表消息的流水号
+	MediaCount       uint32        `json:"mediaCount"`       // 音视频资源总数
+	MediaList        []DeviceMedia `json:"mediaList"`        // 音视频资源列表
 }
 
 func (entity *T1078_0x1205) MsgID() MsgID {
@@ -11,16 +17,70 @@ func (entity *T1078_0x1205) MsgID() MsgID {
 }
 
 func (entity *T1078_0x1205) Encode() ([]byte, error) {
-	return nil, nil
+	writer := NewWriter()
+	writer.WriteWord(entity.ReplyMsgSerialNo)
+	writer.WriteDWord(uint32(len(entity.MediaList)))
+	for i := range entity.MediaList {
+		media, err := entity.MediaList[i].Encode()
+		if err != nil {
+			return nil, fmt.Errorf("encode media %d: %w", i, err)
+		}
+		writer.Write(media)
+	}
+	return writer.Bytes(), nil
 }
 
 func (entity *T1078_0x1205) Decode(data []byte) (int, error) {
-	return 0, nil
+	if len(data) < 6 {
+		return 0, fmt.Errorf("invalid body for T1078_0x1205: %w (need >=6 bytes, got %d)", ErrInvalidBody, len(data))
+	}
+	reader := NewReader(data)
+
+	var err error
+	if entity.ReplyMsgSerialNo, err = reader.ReadWord(); err != nil {
+		return 0, fmt.Errorf("read ReplyMsgSerialNo: %w", err)
+	}
+	if entity.MediaCount, err = reader.ReadDWord(); err != nil {
+		return 0, fmt.Errorf("read MediaCount: %w", err)
+	}
+	if int(entity.MediaCount) > reader.Len()/deviceMediaSize {
+		return 0, fmt.Errorf("invalid body for T1078_0x1205: %w (%d medias, %d bytes left)", ErrInvalidBody, entity.MediaCount, reader.Len())
+	}
+
+	entity.MediaList = make([]DeviceMedia, entity.MediaCount)
+	for i := range entity.MediaList {
+		media, err := reader.Read(deviceMediaSize)
+		if err != nil {
+			return 0, fmt.Errorf("read media %d: %w", i, err)
+		}
+		if _, err := entity.MediaList[i].Decode(media); err != nil {
+			return 0, fmt.Errorf("decode media %d: %w", i, err)
+		}
+	}
+	return len(data) - reader.Len(), nil
 }
 
+// Validate 校验音视频资源列表中的枚举取值
+func (entity *T1078_0x1205) Validate() error {
+	for i := range entity.MediaList {
+		if err := entity.MediaList[i].Validate(); err != nil {
+			var decodeErr *DecodeError
+			if errors.As(err, &decodeErr) {
+				decodeErr.Field = fmt.Sprintf("mediaList[%d].%s", i, decodeErr.Field)
+				decodeErr.Offset += 6 + i*deviceMediaSize
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// deviceMediaSize 单个音视频资源的长度
+const deviceMediaSize = deviceMediaQuerySize + 4
+
 type DeviceMedia struct {
 	DeviceMediaQuery
-	Size uint32 // 文件大小，单位Byte
+	Size uint32 `json:"size"` // 文件大小，单位Byte
 }
 
 func (m *DeviceMedia) Encode() ([]byte, error) {
@@ -47,5 +107,5 @@ func (m *DeviceMedia) Decode(data []byte) (int, error) {
 		return 0, err
 	}
 
-	return 0, nil
+	return len(data) - reader.Len(), nil
 }
@@ -11,6 +11,9 @@ func (entity *T1078_0x9205) MsgID() MsgID {
 	return MsgT1078_0x9205
 }
 
+// deviceMediaQuerySize 查询资源列表消息体的长度
+const deviceMediaQuerySize = 24
+
 type DeviceMediaQuery struct {
 	LogicChannelID byte      `json:"logicChannelId"` // 逻辑通道号
 	StartTime      time.Time `json:"startTime"`      // YY-MM-DD-HH-MM-SS，全 0 表示无起始时间条件
@@ -35,7 +38,7 @@ func (entity *DeviceMediaQuery) Encode() ([]byte, error) {
 }
 
 func (entity *DeviceMediaQuery) Decode(data []byte) (int, error) {
-	if len(data) < 24 {
+	if len(data) < deviceMediaQuerySize {
 		return 0, ErrInvalidBody
 	}
 	reader := NewReader(data)
@@ -84,3 +87,14 @@ func (entity *DeviceMediaQuery) Decode(data []byte) (int, error) {
 
 	return len(data) - reader.Len(), nil
 }
+
+// Validate 校验音视频类型、码流类型及存储器类型的取值范围
+func (entity *DeviceMediaQuery) Validate() error {
+	if err := checkEnum("mediaType", 21, entity.MediaType, 3); err != nil {
+		return err
+	}
+	if err := checkEnum("streamType", 22, entity.StreamType, 2); err != nil {
+		return err
+	}
+	return checkEnum("storageType", 23, entity.StorageType, 2)
+}
@@ -9,6 +9,11 @@ type T808_0x0001 struct {
 	Result           byte   `json:"result"`           // 结果，0;成功/确认;1:失败;2;消息有误;3:不支持
 }
 
+// NewTerminalReply 创建对平台消息的终端通用应答，result 取值见 ReplyResult
+func NewTerminalReply(header *MsgHeader, result byte) *T808_0x0001 {
+	return &T808_0x0001{ReplyMsgSerialNo: header.SerialNumber, ReplyMsgID: header.MsgID, Result: result}
+}
+
 func (entity *T808_0x0001) MsgID() MsgID {
 	return MsgT808_0x0001
 }
@@ -55,3 +60,8 @@ func (entity *T808_0x0001) Decode(data []byte) (int, error) {
 	entity.Result = result
 	return len(data) - reader.Len(), nil
 }
+
+// Validate 校验结果的取值范围
+func (entity *T808_0x0001) Validate() error {
+	return checkEnum("result", 4, entity.Result, 3)
+}
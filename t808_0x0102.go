@@ -20,7 +20,14 @@ type T808_0x0102 struct {
 
 func (entity *T808_0x0102) MsgID() MsgID { return MsgT808_0x0102 }
 
+// ProtocolVersion 获取协议版本
+func (entity *T808_0x0102) ProtocolVersion() VersionType {
+	return entity.protocolVersion
+}
+
 // GetProtocolVersion 获取协议版本
+//
+// Deprecated: 使用 ProtocolVersion。
 func (entity *T808_0x0102) GetProtocolVersion() VersionType {
 	return entity.protocolVersion
 }
@@ -457,3 +457,12 @@ func (c CommAttrs) GetOther() bool {
 func (c *CommAttrs) SetOther(v bool) {
 	SetBitByte((*byte)(c), 7, v)
 }
+
+// Validate 校验 ICCID 为合法的 BCD 数字
+func (m *T808_0x0107) Validate() error {
+	offset := 34 // 终端类型 2 + 制造商 ID 5 + 终端型号 20 + 终端 ID 7
+	if m.protocolVersion == Version2019 {
+		offset = 67 // 终端类型 2 + 制造商 ID 5 + 终端型号 30 + 终端 ID 30
+	}
+	return checkBCD("iccid", offset, m.ICCID)
+}
@@ -40,3 +40,8 @@ func (m *T808_0x0108) Decode(data []byte) (int, error) {
 	m.Result = b
 	return len(data) - r.Len(), nil
 }
+
+// Validate 校验升级结果的取值范围
+func (m *T808_0x0108) Validate() error {
+	return checkEnum("result", 1, m.Result, 2)
+}
@@ -110,7 +110,8 @@ func (msg *T808_0x0200) Decode(data []byte) (int, error) {
 	if len(data) < 28 {
 		return 0, fmt.Errorf("data length error: %d", len(data))
 	}
-	reader := NewReader(data)
+	var reader Reader
+	reader.Reset(data)
 
 	// 读取警告标志
 	var err error
@@ -169,7 +170,7 @@ func (msg *T808_0x0200) Decode(data []byte) (int, error) {
 	}
 
 	// 解码附加信息
-	extras := make([]T808_0x0200_Extra, 0)
+	extras := msg.Extras[:0] // 复用已有的底层数组
 	buffer := data[len(data)-reader.Len():]
 	for len(buffer) >= 2 {
 		id, length := buffer[0], int(buffer[1])
@@ -184,12 +185,15 @@ func (msg *T808_0x0200) Decode(data []byte) (int, error) {
 		})
 		buffer = buffer[length:]
 	}
-	if len(extras) > 0 {
-		msg.Extras = extras
-	}
+	msg.Extras = extras
 	return len(data) - reader.Len(), nil
 }
 
+// Reset 重置消息体以便复用，保留 Extras 的底层数组
+func (msg *T808_0x0200) Reset() {
+	*msg = T808_0x0200{Extras: msg.Extras[:0]}
+}
+
 // T808_0x0200_Status 状态位
 // 位定义：
 //
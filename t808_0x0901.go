@@ -1,9 +1,15 @@
 package jtt
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io"
 )
 
+// DefaultMaxDecompressedSize 数据压缩上报解压后的默认最大长度，防止解压炸弹
+const DefaultMaxDecompressedSize = 1 << 20
+
 // T808_0x0901 数据压缩上报
 type T808_0x0901 struct {
 	// 压缩消息长度
@@ -50,3 +56,103 @@ func (entity *T808_0x0901) Decode(data []byte) (int, error) {
 
 	return len(data) - r.Len(), nil
 }
+
+// NewCompressed 将消息体编码为完整的数据帧（消息头仅包含 MsgID）并经 GZIP 压缩，生成数据压缩上报
+//
+//	解压时内层消息头的终端手机号从外层消息头继承，见 DecodeOptions.Decompress。
+func NewCompressed(msg Msg) (*T808_0x0901, error) {
+	return NewCompressedMessage(&Message{Header: &MsgHeader{}, Body: msg})
+}
+
+// NewCompressedMessage 将一个或多个消息包编码为完整的数据帧并经 GZIP 压缩，生成数据压缩上报
+func NewCompressedMessage(msgs ...*Message) (*T808_0x0901, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	for _, m := range msgs {
+		frame, err := m.Encode()
+		if err != nil {
+			return nil, fmt.Errorf("encode compressed message: %w", err)
+		}
+		if _, err := zw.Write(frame); err != nil {
+			return nil, fmt.Errorf("compress message: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("compress message: %w", err)
+	}
+	return &T808_0x0901{CompressedMsgLength: uint32(buf.Len()), CompressedMsgBody: buf.Bytes()}, nil
+}
+
+// Decompress 解压压缩消息体，解压后长度超过 DefaultMaxDecompressedSize 时返回 ErrDecompressedTooLarge
+func (entity *T808_0x0901) Decompress() ([]byte, error) {
+	return entity.DecompressWithLimit(DefaultMaxDecompressedSize)
+}
+
+// DecompressWithLimit 解压压缩消息体，解压后长度超过 limit 时返回 ErrDecompressedTooLarge
+func (entity *T808_0x0901) DecompressWithLimit(limit int) ([]byte, error) {
+	if int(entity.CompressedMsgLength) != len(entity.CompressedMsgBody) {
+		return nil, fmt.Errorf("decompress 0x0901: %w (compressed length %d, actual %d)", ErrInvalidBody, entity.CompressedMsgLength, len(entity.CompressedMsgBody))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(entity.CompressedMsgBody))
+	if err != nil {
+		return nil, fmt.Errorf("decompress 0x0901: %w: %w", ErrInvalidBody, err)
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(io.LimitReader(zr, int64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("decompress 0x0901: %w: %w", ErrInvalidBody, err)
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("decompress 0x0901: %w (limit %d)", ErrDecompressedTooLarge, limit)
+	}
+	return data, nil
+}
+
+// Decompress 解压数据压缩上报（0x0901）并按解码选项将其中的消息逐个解码为消息包，m 不是数据压缩上报时返回 nil
+//
+//	解压后的数据为一个或多个完整的数据帧；不以标识位开头时视为单个未转义的消息（消息头 + 消息体 + 校验码）。
+//	内层消息头未填写终端手机号时继承外层消息头的终端手机号。
+//	解码失败时返回已解码的消息包及错误。
+func (opts DecodeOptions) Decompress(m *Message) ([]*Message, error) {
+	compressed, ok := m.Body.(*T808_0x0901)
+	if !ok {
+		return nil, nil
+	}
+	limit := opts.MaxDecompressedSize
+	if limit <= 0 {
+		limit = DefaultMaxDecompressedSize
+	}
+	data, err := compressed.DecompressWithLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 && data[0] != boundaryMark {
+		data = Escape(data)
+	}
+
+	var (
+		msgs      []*Message
+		discarded int
+	)
+	scanner := NewFrameScanner(bytes.NewReader(data), WithDiscardHandler(func(data []byte) {
+		discarded += len(data)
+	}))
+	for scanner.Scan() {
+		inner, err := opts.Decode(scanner.Frame())
+		if err != nil {
+			return msgs, fmt.Errorf("decode compressed message %d: %w", len(msgs), err)
+		}
+		if inner.Header.PhoneNumber == "" && m.Header != nil {
+			inner.Header.PhoneNumber = m.Header.PhoneNumber
+		}
+		msgs = append(msgs, inner)
+	}
+	if err := scanner.Err(); err != nil {
+		return msgs, fmt.Errorf("decode compressed message: %w", err)
+	}
+	if discarded > 0 {
+		return msgs, fmt.Errorf("decode compressed message: %w (%d invalid bytes)", ErrInvalidMessage, discarded)
+	}
+	return msgs, nil
+}
@@ -0,0 +1,79 @@
+package jtt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"testing"
+)
+
+func TestDecodeOptions_Decompress(t *testing.T) {
+	const phone = "13800138000"
+	location := &T808_0x0200{Speed: 600, Direction: 90}
+	heartbeat := &Message{Header: &MsgHeader{PhoneNumber: phone, SerialNumber: 9}, Body: &T808_0x0002{}}
+
+	single, err := NewCompressed(location)
+	if err != nil {
+		t.Fatalf("new compressed: %v", err)
+	}
+	batch, err := NewCompressedMessage(&Message{Header: &MsgHeader{}, Body: location}, heartbeat)
+	if err != nil {
+		t.Fatalf("new compressed message: %v", err)
+	}
+
+	for name, body := range map[string]*T808_0x0901{"single": single, "batch": batch} {
+		t.Run(name, func(t *testing.T) {
+			data, err := (&Message{Header: &MsgHeader{PhoneNumber: phone}, Body: body}).Encode()
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			m, err := DecodeMessage(data)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			msgs, err := DecodeOptions{Strict: true}.Decompress(m)
+			if err != nil {
+				t.Fatalf("decompress: %v", err)
+			}
+			if len(msgs) == 0 {
+				t.Fatal("expect decompressed messages")
+			}
+			got, ok := msgs[0].Body.(*T808_0x0200)
+			if !ok || got.Speed != 600 || got.Direction != 90 {
+				t.Fatalf("unexpected inner body %#v", msgs[0].Body)
+			}
+			if msgs[0].Header.PhoneNumber != phone {
+				t.Errorf("expect phone number inherited, got %q", msgs[0].Header.PhoneNumber)
+			}
+			if name == "batch" {
+				if len(msgs) != 2 || msgs[1].Header.MsgID != MsgT808_0x0002 || msgs[1].Header.SerialNumber != 9 {
+					t.Errorf("unexpected batch %+v", msgs)
+				}
+			}
+		})
+	}
+
+	if msgs, err := (DecodeOptions{}).Decompress(heartbeat); msgs != nil || err != nil {
+		t.Fatalf("expect nil for non-compressed message, got %v %v", msgs, err)
+	}
+}
+
+func TestT808_0x0901_DecompressLimit(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(make([]byte, 4096))
+	_ = zw.Close()
+	bomb := &T808_0x0901{CompressedMsgLength: uint32(buf.Len()), CompressedMsgBody: buf.Bytes()}
+
+	if _, err := bomb.DecompressWithLimit(1024); !errors.Is(err, ErrDecompressedTooLarge) {
+		t.Fatalf("expect ErrDecompressedTooLarge, got %v", err)
+	}
+	if data, err := bomb.DecompressWithLimit(4096); err != nil || len(data) != 4096 {
+		t.Fatalf("expect 4096 bytes, got %d %v", len(data), err)
+	}
+
+	bomb.CompressedMsgLength++
+	if _, err := bomb.Decompress(); !errors.Is(err, ErrInvalidBody) {
+		t.Fatalf("expect ErrInvalidBody for length mismatch, got %v", err)
+	}
+}
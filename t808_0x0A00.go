@@ -1,6 +1,7 @@
 package jtt
 
 import (
+	"crypto/rsa"
 	"fmt"
 )
 
@@ -48,3 +49,18 @@ func (entity *T808_0x0A00) Decode(data []byte) (int, error) {
 
 	return len(data) - r.Len(), nil
 }
+
+// PublicKey 由 {e, n} 构造终端RSA 公钥
+func (entity *T808_0x0A00) PublicKey() (*rsa.PublicKey, error) {
+	return NewRSAPublicKey(entity.E, entity.N)
+}
+
+// SetPublicKey 将终端RSA 公钥写入 {e, n}，仅支持不超过 1024 位的密钥
+func (entity *T808_0x0A00) SetPublicKey(key *rsa.PublicKey) error {
+	e, n, err := encodeRSAPublicKey(key)
+	if err != nil {
+		return err
+	}
+	entity.E, entity.N = e, n
+	return nil
+}
@@ -1,6 +1,18 @@
 package jtt
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+// 通用应答结果，即 T808_0x0001 与 T808_0x8001 的 Result
+const (
+	ReplyResultSuccess        byte = 0 // 成功/确认
+	ReplyResultFailure        byte = 1 // 失败
+	ReplyResultInvalid        byte = 2 // 消息有误
+	ReplyResultUnsupported    byte = 3 // 不支持
+	ReplyResultAlarmConfirmed byte = 4 // 报警处理确认，仅平台通用应答
+)
 
 // T808_0x8001 平台通用应答
 type T808_0x8001 struct {
@@ -9,6 +21,52 @@ type T808_0x8001 struct {
 	Result           byte   `json:"result"`           // 结果，0;成功/确认;1:失败;2;消息有误;3:不支持;4:报警处理确认(2013、2019新增)
 }
 
+// NewPlatformReply 创建对终端消息的平台通用应答，header 为被应答消息（分包时为对应分包）的消息头
+func NewPlatformReply(header *MsgHeader, result byte) *T808_0x8001 {
+	return &T808_0x8001{ReplyMsgSerialNo: header.SerialNumber, ReplyMsgID: header.MsgID, Result: result}
+}
+
+// ReplyResult 将消息的处理结果映射为通用应答结果：
+//
+//	nil: ReplyResultSuccess
+//	ErrMethodNotImplemented、ErrMessageNotRegistered: ReplyResultUnsupported
+//	解码错误（ErrInvalidMessage、ErrInvalidHeader、ErrInvalidBody、ErrInvalidCheckSum、*DecodeError 等）: ReplyResultInvalid
+//	其他错误: ReplyResultFailure
+func ReplyResult(err error) byte {
+	var decodeErr *DecodeError
+	switch {
+	case err == nil:
+		return ReplyResultSuccess
+	case errors.Is(err, ErrMethodNotImplemented), errors.Is(err, ErrMessageNotRegistered):
+		return ReplyResultUnsupported
+	case errors.As(err, &decodeErr),
+		errors.Is(err, ErrInvalidMessage), errors.Is(err, ErrInvalidHeader), errors.Is(err, ErrInvalidBody),
+		errors.Is(err, ErrInvalidCheckSum), errors.Is(err, ErrEntityDecode), errors.Is(err, ErrInvalidExtraLength),
+		errors.Is(err, ErrInvalidBCD), errors.Is(err, ErrInvalidEnum), errors.Is(err, ErrVersionMismatch):
+		return ReplyResultInvalid
+	default:
+		return ReplyResultFailure
+	}
+}
+
+// ReplyError 通用应答（T808_0x0001/T808_0x8001）结果不为成功时的错误
+type ReplyError struct {
+	MsgID  MsgID // 被应答消息的 ID
+	Result byte  // 应答结果
+}
+
+func (e *ReplyError) Error() string {
+	return fmt.Sprintf("reply to %s with result %d", e.MsgID, e.Result)
+}
+
+// ReplyResultError 将通用应答结果映射为错误，ReplyResultSuccess 与 ReplyResultAlarmConfirmed 返回 nil，其他结果返回 *ReplyError
+func ReplyResultError(msgID MsgID, result byte) error {
+	if result == ReplyResultSuccess || result == ReplyResultAlarmConfirmed {
+		return nil
+	}
+	return &ReplyError{MsgID: msgID, Result: result}
+}
+
 func (entity *T808_0x8001) MsgID() MsgID { return MsgT808_0x8001 }
 
 func (entity *T808_0x8001) Encode() ([]byte, error) {
@@ -54,3 +112,8 @@ func (entity *T808_0x8001) Decode(data []byte) (int, error) {
 
 	return len(data) - reader.Len(), nil
 }
+
+// Validate 校验结果的取值范围
+func (entity *T808_0x8001) Validate() error {
+	return checkEnum("result", 4, entity.Result, 4)
+}
@@ -0,0 +1,54 @@
+package jtt
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestReplyResult(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want byte
+	}{
+		{"nil", nil, ReplyResultSuccess},
+		{"not implemented", fmt.Errorf("handle: %w", ErrMethodNotImplemented), ReplyResultUnsupported},
+		{"not registered", ErrMessageNotRegistered, ReplyResultUnsupported},
+		{"invalid body", fmt.Errorf("decode body: %w", ErrInvalidBody), ReplyResultInvalid},
+		{"strict", &DecodeError{MsgID: MsgT808_0x0200, Field: "body.status", Err: errors.New("bad")}, ReplyResultInvalid},
+		{"other", errors.New("database unavailable"), ReplyResultFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReplyResult(tt.err); got != tt.want {
+				t.Errorf("ReplyResult() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPlatformReply(t *testing.T) {
+	header := &MsgHeader{MsgID: MsgT808_0x0200, SerialNumber: 42}
+	reply := NewPlatformReply(header, ReplyResultSuccess)
+	if reply.ReplyMsgSerialNo != 42 || reply.ReplyMsgID != MsgT808_0x0200 || reply.Result != ReplyResultSuccess {
+		t.Errorf("NewPlatformReply() = %+v", reply)
+	}
+	ack := NewTerminalReply(&MsgHeader{MsgID: MsgT808_0x8103, SerialNumber: 7}, ReplyResultUnsupported)
+	if ack.ReplyMsgSerialNo != 7 || ack.ReplyMsgID != MsgT808_0x8103 || ack.Result != ReplyResultUnsupported {
+		t.Errorf("NewTerminalReply() = %+v", ack)
+	}
+}
+
+func TestReplyResultError(t *testing.T) {
+	for _, result := range []byte{ReplyResultSuccess, ReplyResultAlarmConfirmed} {
+		if err := ReplyResultError(MsgT808_0x0200, result); err != nil {
+			t.Errorf("ReplyResultError(%d) = %v, want nil", result, err)
+		}
+	}
+	var replyErr *ReplyError
+	err := ReplyResultError(MsgT808_0x0200, ReplyResultUnsupported)
+	if !errors.As(err, &replyErr) || replyErr.MsgID != MsgT808_0x0200 || replyErr.Result != ReplyResultUnsupported {
+		t.Errorf("ReplyResultError(%d) = %v, want a *ReplyError", ReplyResultUnsupported, err)
+	}
+}
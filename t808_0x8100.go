@@ -2,6 +2,15 @@ package jtt
 
 import "fmt"
 
+// 终端注册应答结果，即 T808_0x8100 的 Result
+const (
+	RegisterResultSuccess            byte = 0 // 成功
+	RegisterResultVehicleRegistered  byte = 1 // 车辆已被注册
+	RegisterResultVehicleNotFound    byte = 2 // 数据库中无该车辆
+	RegisterResultTerminalRegistered byte = 3 // 终端已被注册
+	RegisterResultTerminalNotFound   byte = 4 // 数据库中无该终端
+)
+
 // T808_0x8100 终端注册应答
 type T808_0x8100 struct {
 	// 应答流水号，对应的终端注册消息的流水号
@@ -45,3 +54,8 @@ func (entity *T808_0x8100) Decode(data []byte) (int, error) {
 	}
 	return len(data) - reader.Len(), nil
 }
+
+// Validate 校验结果的取值范围
+func (entity *T808_0x8100) Validate() error {
+	return checkEnum("result", 2, entity.Result, 4)
+}
@@ -113,10 +113,14 @@ func (entity *T808_0x8300) SetFlag(flag *T808_0x8300_Flag) {
 	entity.flag = flag
 }
 
+// SetProtocolVersion 设置协议版本
 func (entity *T808_0x8300) SetProtocolVersion(protocolVersion VersionType) {
 	entity.protocolVersion = protocolVersion
 }
 
+// ProtocolVersion 获取协议版本
+func (entity *T808_0x8300) ProtocolVersion() VersionType { return entity.protocolVersion }
+
 func (entity *T808_0x8300) Encode() ([]byte, error) {
 	writer := NewWriter()
 	if entity.flag != nil {
@@ -33,8 +33,20 @@ type T808_0x8500_Item struct {
 
 func (m *T808_0x8500) MsgID() MsgID { return MsgT808_0x8500 }
 
+// SetProtocolVersion 设置协议版本
+func (m *T808_0x8500) SetProtocolVersion(v VersionType) { m.protoVersion = v }
+
+// ProtocolVersion 获取协议版本
+func (m *T808_0x8500) ProtocolVersion() VersionType { return m.protoVersion }
+
+// SetProtoVersion 设置协议版本
+//
+// Deprecated: 使用 SetProtocolVersion。
 func (m *T808_0x8500) SetProtoVersion(v VersionType) { m.protoVersion = v }
 
+// ProtoVersion 获取协议版本
+//
+// Deprecated: 使用 ProtocolVersion。
 func (m *T808_0x8500) ProtoVersion() VersionType { return m.protoVersion }
 
 func (m *T808_0x8500) Encode() ([]byte, error) {
@@ -20,7 +20,14 @@ func (entity *T808_0x8600) SetProtocolVersion(protocolVersion VersionType) {
 	entity.protocolVersion = protocolVersion
 }
 
+// ProtocolVersion 获取协议版本
+func (entity *T808_0x8600) ProtocolVersion() VersionType {
+	return entity.protocolVersion
+}
+
 // GetProtocolVersion 获取协议版本
+//
+// Deprecated: 使用 ProtocolVersion。
 func (entity *T808_0x8600) GetProtocolVersion() VersionType {
 	return entity.protocolVersion
 }
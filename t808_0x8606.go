@@ -24,7 +24,14 @@ func (entity *T808_0x8606) SetProtocolVersion(protocolVersion VersionType) {
 	entity.protocolVersion = protocolVersion
 }
 
+// ProtocolVersion 获取协议版本
+func (entity *T808_0x8606) ProtocolVersion() VersionType {
+	return entity.protocolVersion
+}
+
 // GetProtocolVersion 获取协议版本
+//
+// Deprecated: 使用 ProtocolVersion。
 func (entity *T808_0x8606) GetProtocolVersion() VersionType {
 	return entity.protocolVersion
 }
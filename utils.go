@@ -38,7 +38,11 @@ const (
 
 // Unescape 返回反转义后的数据包，不影响原始数据包（去头尾以及反转义）
 func Unescape(src []byte) (res []byte) {
-	dst := make([]byte, 0)
+	return UnescapeTo(make([]byte, 0, len(src)), src)
+}
+
+// UnescapeTo 将反转义后的数据包追加至 dst 并返回（去头尾以及反转义），复用 dst 可避免内存分配
+func UnescapeTo(dst, src []byte) []byte {
 	i, n := 1, len(src)
 	for i < n-1 {
 		if i < n-2 && src[i] == 0x7d && src[i+1] == 0x02 {
@@ -57,7 +61,11 @@ func Unescape(src []byte) (res []byte) {
 
 // Escape 返回转义以后的数据包，不影响原始数据包（加头尾以及转义）
 func Escape(src []byte) (res []byte) {
-	dst := make([]byte, 0)
+	return EscapeTo(make([]byte, 0, len(src)+len(src)/8+2), src)
+}
+
+// EscapeTo 将转义以后的数据包追加至 dst 并返回（加头尾以及转义），复用 dst 可避免内存分配
+func EscapeTo(dst, src []byte) []byte {
 	dst = append(dst, boundaryMark)
 	for _, v := range src {
 		switch v {
@@ -170,6 +178,16 @@ func StringToBCD(s string, size ...int) []byte {
 	return ret
 }
 
+// InvalidBCD 返回 data 中第一个包含非十进制半字节（>9）的字节下标，全部合法时返回 -1
+func InvalidBCD(data []byte) int {
+	for i, b := range data {
+		if b>>4 > 9 || b&0x0F > 9 {
+			return i
+		}
+	}
+	return -1
+}
+
 // BcdToString BCD 转字符串， ignorePadding 是否忽略前置 0
 //
 //	ignorePadding 不传或传 false 表示忽略前置 0，例如终端手机号 015321115156 -> 15321115156
@@ -250,16 +268,15 @@ func FromBCDTimeInLocation(bcd []byte, loc *time.Location) (time.Time, error) {
 //	lat 纬度，以度为单位的维度值乘以10的6次方，精确到百万分之一度
 //	lon 经度，以度为单位的维度值乘以10的6次方，精确到百万分之一度
 func GetGeoPointForWGS84(lat uint32, south bool, lng uint32, west bool) (decimal.Decimal, decimal.Decimal) {
-	div := decimal.NewFromFloat(1000000)
-	fLat := decimal.NewFromInt(int64(lat)).Div(div)
-	fLon := decimal.NewFromInt(int64(lng)).Div(div)
+	// 直接以 10^-6 为指数构造，避免除法带来的内存分配
+	iLat, iLon := int64(lat), int64(lng)
 	if south {
-		fLat = decimal.Zero.Sub(fLat)
+		iLat = -iLat
 	}
 	if west {
-		fLon = decimal.Zero.Sub(fLon)
+		iLon = -iLon
 	}
-	return fLat.Truncate(6), fLon.Truncate(6)
+	return decimal.New(iLat, -6), decimal.New(iLon, -6)
 }
 
 // GetGeoPointForGCJ02 获取经纬度（GCJ02 坐标系，高德、腾讯）
@@ -1,6 +1,7 @@
 package jtt
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 	"time"
@@ -501,6 +502,15 @@ func Test_StringToBCD(t *testing.T) {
 	}
 }
 
+func Test_InvalidBCD(t *testing.T) {
+	if got := InvalidBCD([]byte{0x01, 0x38, 0x00}); got != -1 {
+		t.Fatalf("expect -1, got %d", got)
+	}
+	if got := InvalidBCD([]byte{0x01, 0x3A, 0xF0}); got != 1 {
+		t.Fatalf("expect 1, got %d", got)
+	}
+}
+
 func Test_BcdToString(t *testing.T) {
 	// leading zero byte(s) should be stripped before conversion per current logic
 	if s := BcdToString([]byte{0x00, 0x12, 0x34}); s != "1234" {
@@ -551,6 +561,36 @@ func Test_Unescape_EmptyBody(t *testing.T) {
 	}
 }
 
+func Test_EscapeTo_UnescapeTo_ReuseBuffer(t *testing.T) {
+	src := []byte{0x01, 0x7e, 0x02, 0x7d, 0x03}
+	buf := make([]byte, 0, 32)
+	esc := EscapeTo(buf, src)
+	if string(esc) != string(Escape(src)) || &esc[0] != &buf[:1][0] {
+		t.Fatalf("escape to: got % X", esc)
+	}
+	got := UnescapeTo(buf[:0], Escape(src))
+	if string(got) != string(src) || &got[0] != &buf[:1][0] {
+		t.Fatalf("unescape to: want % X, got % X", src, got)
+	}
+}
+
+func BenchmarkUnescape(b *testing.B) {
+	pkt := Escape(bytes.Repeat([]byte{0x01, 0x7e, 0x02, 0x7d, 0x03}, 20))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = Unescape(pkt)
+	}
+}
+
+func BenchmarkUnescapeTo(b *testing.B) {
+	pkt := Escape(bytes.Repeat([]byte{0x01, 0x7e, 0x02, 0x7d, 0x03}, 20))
+	buf := make([]byte, 0, len(pkt))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = UnescapeTo(buf[:0], pkt)
+	}
+}
+
 // -------- BCD time tests --------
 func Test_ToBCDTime_Zero(t *testing.T) {
 	if b := ToBCDTime(time.Unix(0, 0)); string(b) != string(StringToBCD("000000000000", 6)) {
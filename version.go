@@ -0,0 +1,134 @@
+package jtt
+
+import "sync"
+
+// 终端注册（0x0100）消息体中终端型号、终端 ID 之前的固定长度：省域 ID 2 + 市县域 ID 2 + 制造商 ID 5
+const registerModelOffset = 9
+
+// DetectRegisterVersion 根据终端注册（0x0100）消息体的长度及补位特征推断终端协议版本
+//
+//	消息头版本标识为 2019 时直接返回 Version2019；2011 与 2013 的消息头无法区分，按消息体判断：
+//	  - 2013：终端型号 BYTE[20] 右补 0x00，终端 ID BYTE[7] 右补 0x00，消息体长度 >= 37；
+//	  - 2011：终端型号 BYTE[8] 右补空格 0x20，终端 ID 固定 BYTE[7]，消息体长度 >= 25。
+//	两种布局均不匹配时按 2013 处理。
+func DetectRegisterVersion(header *MsgHeader, body []byte) VersionType {
+	if header != nil && header.Version == Version2019 {
+		return Version2019
+	}
+	if isRegisterLayout2013(body) {
+		return Version2013
+	}
+	if isRegisterLayout2011(body) {
+		return Version2011
+	}
+	return Version2013
+}
+
+func isRegisterLayout2013(body []byte) bool {
+	if len(body) < registerModelOffset+20+7+1 {
+		return false
+	}
+	model := body[registerModelOffset : registerModelOffset+20]
+	id := body[registerModelOffset+20 : registerModelOffset+27]
+	return isRightZeroPadded(model) &&
+		isRightZeroPadded(id) && isTerminalID(trimRightZeros(id)) &&
+		isPlateColor(body[registerModelOffset+27])
+}
+
+func isRegisterLayout2011(body []byte) bool {
+	if len(body) < registerModelOffset+8+7+1 {
+		return false
+	}
+	model := body[registerModelOffset : registerModelOffset+8]
+	id := body[registerModelOffset+8 : registerModelOffset+15]
+	for _, b := range model {
+		if b == 0x00 {
+			return false
+		}
+	}
+	return isTerminalID(id) && isPlateColor(body[registerModelOffset+15])
+}
+
+// isRightZeroPadded 判断 b 为「非 0x00 内容 + 右补 0x00」的形式
+func isRightZeroPadded(b []byte) bool {
+	content := trimRightZeros(b)
+	for _, c := range b[len(content):] {
+		if c != 0x00 {
+			return false
+		}
+	}
+	return true
+}
+
+// isTerminalID 判断 b 非空且仅由大写字母和数字组成
+func isTerminalID(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	for _, c := range b {
+		if (c < '0' || c > '9') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// isPlateColor 判断 c 为 JT/T 415 定义的车牌颜色（0 表示未上牌）
+func isPlateColor(c byte) bool {
+	return c <= 5 || c == 9
+}
+
+// VersionRegistry 按终端手机号记录终端协议版本，可并发使用
+//
+//	2011 与 2013 版本的消息头相同，需根据终端注册（0x0100）消息推断版本（见 DetectRegisterVersion），
+//	并应用于该终端后续的消息；配合 DecodeOptions.Versions 使用。
+type VersionRegistry struct {
+	mu       sync.RWMutex
+	versions map[string]VersionType
+}
+
+// NewVersionRegistry 创建终端协议版本注册表
+func NewVersionRegistry() *VersionRegistry {
+	return &VersionRegistry{versions: make(map[string]VersionType)}
+}
+
+// Get 返回终端已记录的协议版本
+func (r *VersionRegistry) Get(phoneNumber string) (VersionType, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	v, ok := r.versions[phoneNumber]
+	return v, ok
+}
+
+// Set 记录终端的协议版本
+func (r *VersionRegistry) Set(phoneNumber string, version VersionType) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.versions[phoneNumber] = version
+}
+
+// Delete 删除终端的协议版本记录，如终端注销时
+func (r *VersionRegistry) Delete(phoneNumber string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.versions, phoneNumber)
+}
+
+// Observe 处理解码后的消息头及消息体数据：终端注册（0x0100）时推断并记录协议版本，
+// 其余消息按已记录的版本修正 MsgHeader.Version，返回修正后的版本
+//
+//	消息头版本标识为 2019 时以消息头为准；分包消息不做推断。
+func (r *VersionRegistry) Observe(header *MsgHeader, body []byte) VersionType {
+	if header.MsgID == MsgT808_0x0100 && !header.IsSegment() {
+		header.Version = DetectRegisterVersion(header, body)
+		r.Set(header.PhoneNumber, header.Version)
+		return header.Version
+	}
+	if header.Version == Version2019 {
+		return header.Version
+	}
+	if v, ok := r.Get(header.PhoneNumber); ok && v == Version2011 {
+		header.Version = Version2011
+	}
+	return header.Version
+}
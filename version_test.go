@@ -0,0 +1,113 @@
+package jtt
+
+import "testing"
+
+func TestDetectRegisterVersion(t *testing.T) {
+	encode := func(version VersionType, body *T808_0x0100) []byte {
+		body.SetProtocolVersion(version)
+		data, err := body.Encode()
+		if err != nil {
+			t.Fatalf("encode %d: %v", version, err)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name   string
+		header *MsgHeader
+		body   []byte
+		want   VersionType
+	}{
+		{
+			name:   "2011",
+			header: &MsgHeader{},
+			body:   encode(Version2011, &T808_0x0100{ManufacturerID: "MF001", TerminalModel: "M1", TerminalID: "AB12345", PlateColor: 1, PlateNumber: "京A12345"}),
+			want:   Version2011,
+		},
+		{
+			name:   "2011 full model",
+			header: &MsgHeader{},
+			body:   encode(Version2011, &T808_0x0100{ManufacturerID: "MF001", TerminalModel: "MODEL-01", TerminalID: "AB12345", PlateColor: 2, PlateNumber: "粤B00001"}),
+			want:   Version2011,
+		},
+		{
+			name:   "2013",
+			header: &MsgHeader{},
+			body:   encode(Version2013, &T808_0x0100{ManufacturerID: "MF001", TerminalModel: "M1", TerminalID: "AB123", PlateColor: 1, PlateNumber: "京A12345"}),
+			want:   Version2013,
+		},
+		{
+			name:   "2013 vin",
+			header: &MsgHeader{},
+			body:   encode(Version2013, &T808_0x0100{ManufacturerID: "MF001", TerminalModel: "MODEL-2013", TerminalID: "AB12345", PlateNumber: "LSVAU2180N2183294"}),
+			want:   Version2013,
+		},
+		{
+			name:   "2019 header",
+			header: &MsgHeader{Version: Version2019},
+			body:   []byte{0x00},
+			want:   Version2019,
+		},
+		{
+			name:   "unknown layout",
+			header: &MsgHeader{},
+			body:   []byte{0x00, 0x01},
+			want:   Version2013,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectRegisterVersion(tt.header, tt.body); got != tt.want {
+				t.Errorf("expect %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestVersionRegistry_Decode(t *testing.T) {
+	const phone = "13800138000"
+	register := &T808_0x0100{ManufacturerID: "MF001", TerminalModel: "M1", TerminalID: "AB12345", PlateColor: 1, PlateNumber: "京A12345"}
+	register.SetProtocolVersion(Version2011)
+	data, err := (&Message{Header: &MsgHeader{Version: Version2011, PhoneNumber: phone}, Body: register}).Encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	versions := NewVersionRegistry()
+	opts := DecodeOptions{Strict: true, Versions: versions}
+	m, err := opts.Decode(data)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	got := m.Body.(*T808_0x0100)
+	if m.Header.Version != Version2011 || got.TerminalModel != "M1" || got.TerminalID != "AB12345" || got.PlateNumber != "京A12345" {
+		t.Fatalf("expect 2011 registration, got version %d body %+v", m.Header.Version, got)
+	}
+	if v, ok := versions.Get(phone); !ok || v != Version2011 {
+		t.Fatalf("expect 2011 recorded, got %d %v", v, ok)
+	}
+
+	data, err = (&Message{Header: &MsgHeader{PhoneNumber: phone, SerialNumber: 2}, Body: &T808_0x0002{}}).Encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if m, err = opts.Decode(data); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if m.Header.Version != Version2011 {
+		t.Fatalf("expect recorded version applied, got %d", m.Header.Version)
+	}
+
+	versions.Delete(phone)
+	if m, err = opts.Decode(data); err != nil || m.Header.Version != Version2013 {
+		t.Fatalf("expect 2013 after delete, got %d %v", m.Header.Version, err)
+	}
+}
+
+func TestVersionType_String(t *testing.T) {
+	for version, want := range map[VersionType]string{Version2011: "2011", Version2013: "2013", Version2019: "2019", 2: "unknown"} {
+		if got := version.String(); got != want {
+			t.Errorf("VersionType(%d).String() = %q, want %q", version, got, want)
+		}
+	}
+}